@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/playlist"
+	"go.senan.xyz/gonic/scanner"
+)
+
+var (
+	errUnknownCommand = errors.New("unknown command")
+	errUsage          = errors.New("wrong number of arguments")
+)
+
+const commandsUsage = `commands, which run against the database without starting the server:
+  scan [-full] [-dry-run] [-excluded] [path]
+  user add [-admin] <name> [password]
+  user del <name>
+  user passwd <name> [password]
+  user list
+  playlist import <user> <file.m3u>...
+  playlist export <user> <dir>
+  db vacuum
+  db check
+  db backup [file.db]
+  db restore <file.db>
+
+passwords not given as an argument are read from stdin`
+
+// commandEnv is what the commands need from the server's config
+type commandEnv struct {
+	db            *db.DB
+	scanner       *scanner.Scanner
+	newScanner    func(*db.DB) *scanner.Scanner // for dry runs, with a scanner on a copy of the db
+	playlistStore *playlist.Store
+	backups       *db.Backups        // nil without a backup path
+	migrate       func(*db.DB) error // for restored backups from older versions
+	stdin         io.Reader
+	stdout        io.Writer
+}
+
+// runCommand runs one of the admin subcommands, like "scan" or "user add"
+func runCommand(env *commandEnv, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	name, args := args[0], args[1:]
+	var sub string
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	switch {
+	case name == "scan":
+		return cmdScan(env, args)
+	case name == "user" && sub == "add":
+		return cmdUserAdd(env, args[1:])
+	case name == "user" && sub == "del":
+		return cmdUserDel(env, args[1:])
+	case name == "user" && sub == "passwd":
+		return cmdUserPasswd(env, args[1:])
+	case name == "user" && sub == "list":
+		return cmdUserList(env, args[1:])
+	case name == "playlist" && sub == "import":
+		return cmdPlaylistImport(env, args[1:])
+	case name == "playlist" && sub == "export":
+		return cmdPlaylistExport(env, args[1:])
+	case name == "db" && sub == "vacuum":
+		return cmdDBVacuum(env, args[1:])
+	case name == "db" && sub == "check":
+		return cmdDBCheck(env, args[1:])
+	case name == "db" && sub == "backup":
+		return cmdDBBackup(env, args[1:])
+	case name == "db" && sub == "restore":
+		return cmdDBRestore(env, args[1:])
+	}
+	return fmt.Errorf("%w %q\n%s", errUnknownCommand, strings.TrimSpace(name+" "+sub), commandsUsage)
+}
+
+func cmdScan(env *commandEnv, args []string) error {
+	set := flag.NewFlagSet("scan", flag.ContinueOnError)
+	full := set.Bool("full", false, "don't skip files which haven't changed since the last scan")
+	dryRun := set.Bool("dry-run", false, "scan a copy of the database, to see what would change")
+	listExcluded := set.Bool("excluded", false, "list the paths which were excluded, and the rule which excluded each")
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	if set.NArg() > 1 {
+		return errUsage
+	}
+
+	scannr := env.scanner
+	if *dryRun {
+		dryDB, cleanup, err := copyDB(env.db)
+		if err != nil {
+			return fmt.Errorf("copy db for dry run: %w", err)
+		}
+		defer cleanup()
+		scannr = env.newScanner(dryDB)
+	}
+
+	opts := scanner.ScanOptions{IsFull: *full}
+	if path := set.Arg(0); path != "" {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("make absolute: %w", err)
+		}
+		opts.Paths = append(opts.Paths, absPath)
+	}
+
+	start := time.Now()
+	c, err := scannr.ScanAndClean(opts)
+	if c == nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "took\t%s\n", time.Since(start).Truncate(time.Millisecond))
+	fmt.Fprintf(w, "tracks seen\t%d\n", c.SeenTracks())
+	fmt.Fprintf(w, "tracks new\t%d\n", c.SeenTracksNew())
+	fmt.Fprintf(w, "tracks moved\t%d\n", c.TracksMoved())
+	fmt.Fprintf(w, "tracks missing\t%d\n", c.TracksMissing())
+	fmt.Fprintf(w, "tracks removed\t%d\n", c.TracksRemoved())
+	fmt.Fprintf(w, "albums missing\t%d\n", c.AlbumsMissing())
+	fmt.Fprintf(w, "albums removed\t%d\n", c.AlbumsRemoved())
+	fmt.Fprintf(w, "artists removed\t%d\n", c.ArtistsMissing())
+	fmt.Fprintf(w, "genres removed\t%d\n", c.GenresMissing())
+	fmt.Fprintf(w, "paths excluded\t%d\n", len(c.Excluded()))
+	if *listExcluded {
+		for _, excl := range c.Excluded() {
+			fmt.Fprintf(w, "excluded %s\t%s\n", excl.Path, excl.Rule)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Fprintln(env.stdout, "dry run, nothing was changed")
+	}
+	return err
+}
+
+// copyDB copies the db to a temporary file, and opens it
+func copyDB(dbc *db.DB) (*db.DB, func(), error) {
+	if dbc.IsPostgres() {
+		return nil, nil, db.ErrSQLiteOnly
+	}
+	dir, err := os.MkdirTemp("", "gonic-dry-run-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("make temp dir: %w", err)
+	}
+	path := filepath.Join(dir, "gonic.db")
+	if err := dbc.Exec("VACUUM INTO ?", path).Error; err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, nil, fmt.Errorf("vacuum into: %w", err)
+	}
+	dryDB, err := db.New(path, db.DefaultOptions())
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, nil, fmt.Errorf("open: %w", err)
+	}
+	return dryDB, func() {
+		dryDB.Close()
+		_ = os.RemoveAll(dir)
+	}, nil
+}
+
+func cmdUserAdd(env *commandEnv, args []string) error {
+	set := flag.NewFlagSet("user add", flag.ContinueOnError)
+	admin := set.Bool("admin", false, "whether the user is an admin")
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	if set.NArg() < 1 || set.NArg() > 2 {
+		return errUsage
+	}
+	name := set.Arg(0)
+	password, err := argOrStdin(env, set.Arg(1))
+	if err != nil {
+		return fmt.Errorf("read password: %w", err)
+	}
+	if name == "" || password == "" {
+		return fmt.Errorf("please provide a name and password")
+	}
+	user := db.User{
+		Name:     name,
+		Password: password,
+		IsAdmin:  *admin,
+	}
+	if err := env.db.Create(&user).Error; err != nil {
+		return fmt.Errorf("create user %q: %w", name, err)
+	}
+	fmt.Fprintf(env.stdout, "created user %q\n", name)
+	return nil
+}
+
+func cmdUserDel(env *commandEnv, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	user := env.db.GetUserByName(args[0])
+	if user == nil {
+		return fmt.Errorf("couldn't find user %q", args[0])
+	}
+	if user.IsAdmin {
+		return fmt.Errorf("can't delete the admin user")
+	}
+	if err := env.db.Delete(user).Error; err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	fmt.Fprintf(env.stdout, "deleted user %q\n", user.Name)
+	return nil
+}
+
+func cmdUserPasswd(env *commandEnv, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+	user := env.db.GetUserByName(args[0])
+	if user == nil {
+		return fmt.Errorf("couldn't find user %q", args[0])
+	}
+	var arg string
+	if len(args) == 2 {
+		arg = args[1]
+	}
+	password, err := argOrStdin(env, arg)
+	if err != nil {
+		return fmt.Errorf("read password: %w", err)
+	}
+	if password == "" {
+		return fmt.Errorf("please provide a password")
+	}
+	if err := env.db.Model(user).Update("password", password).Error; err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	fmt.Fprintf(env.stdout, "changed password for user %q\n", user.Name)
+	return nil
+}
+
+func cmdUserList(env *commandEnv, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	var users []*db.User
+	if err := env.db.Order("id").Find(&users).Error; err != nil {
+		return fmt.Errorf("find users: %w", err)
+	}
+	w := tabwriter.NewWriter(env.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "id\tname\tadmin\tcreated")
+	for _, user := range users {
+		fmt.Fprintf(w, "%d\t%s\t%t\t%s\n", user.ID, user.Name, user.IsAdmin, user.CreatedAt.Format(time.DateOnly))
+	}
+	return w.Flush()
+}
+
+// cmdPlaylistImport adds m3u files to a user's playlists. relative paths in them are relative to the file
+func cmdPlaylistImport(env *commandEnv, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	user := env.db.GetUserByName(args[0])
+	if user == nil {
+		return fmt.Errorf("couldn't find user %q", args[0])
+	}
+	for _, path := range args[1:] {
+		items, err := readM3U(path)
+		if err != nil {
+			return fmt.Errorf("read %q: %w", path, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		pl := playlist.Playlist{
+			UpdatedAt: time.Now(),
+			UserID:    user.ID,
+			Name:      name,
+			Items:     items,
+		}
+		if err := env.playlistStore.Write(playlist.NewPath(user.ID, name), &pl); err != nil {
+			return fmt.Errorf("write %q: %w", name, err)
+		}
+		fmt.Fprintf(env.stdout, "imported %q with %d tracks\n", name, len(items))
+	}
+	return nil
+}
+
+func readM3U(path string) ([]string, error) {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("make absolute: %w", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var items []string
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+		items = append(items, filepath.Clean(line))
+	}
+	return items, nil
+}
+
+// cmdPlaylistExport writes a user's playlists to dir as plain m3u files
+func cmdPlaylistExport(env *commandEnv, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	user := env.db.GetUserByName(args[0])
+	if user == nil {
+		return fmt.Errorf("couldn't find user %q", args[0])
+	}
+	dir := args[1]
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("make dir: %w", err)
+	}
+
+	relPaths, err := env.playlistStore.List()
+	if err != nil {
+		return fmt.Errorf("list playlists: %w", err)
+	}
+	for _, relPath := range relPaths {
+		pl, err := env.playlistStore.Read(relPath)
+		if err != nil {
+			return fmt.Errorf("read %q: %w", relPath, err)
+		}
+		if pl.UserID != user.ID {
+			continue
+		}
+		var m3u strings.Builder
+		fmt.Fprintln(&m3u, "#EXTM3U")
+		for _, item := range pl.Items {
+			fmt.Fprintln(&m3u, item)
+		}
+		path := filepath.Join(dir, filepath.Base(relPath))
+		if err := os.WriteFile(path, []byte(m3u.String()), 0600); err != nil {
+			return fmt.Errorf("write %q: %w", path, err)
+		}
+		fmt.Fprintf(env.stdout, "exported %q to %q\n", pl.Name, path)
+	}
+	return nil
+}
+
+func cmdDBVacuum(env *commandEnv, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if err := env.db.Exec("VACUUM").Error; err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+	fmt.Fprintln(env.stdout, "vacuumed")
+	return nil
+}
+
+var errDBCheck = errors.New("database check failed")
+
+func cmdDBCheck(env *commandEnv, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if env.db.IsPostgres() {
+		return fmt.Errorf("db check: %w", db.ErrSQLiteOnly)
+	}
+	var problems []string
+	integrity, err := pragmaRows(env.db.DB, "PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	if len(integrity) != 1 || integrity[0] != "ok" {
+		problems = append(problems, integrity...)
+	}
+	foreignKeys, err := pragmaRows(env.db.DB, "PRAGMA foreign_key_check")
+	if err != nil {
+		return fmt.Errorf("foreign key check: %w", err)
+	}
+	for _, row := range foreignKeys {
+		problems = append(problems, fmt.Sprintf("foreign key: %s", row))
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(env.stdout, problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %d problems", errDBCheck, len(problems))
+	}
+	fmt.Fprintln(env.stdout, "ok")
+	return nil
+}
+
+// cmdDBBackup backs up the database to a file, or to the backup path, while the server may be running
+func cmdDBBackup(env *commandEnv, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	if len(args) == 1 {
+		if err := env.db.Backup(args[0]); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		fmt.Fprintf(env.stdout, "backed up to %q\n", args[0])
+		return nil
+	}
+	if env.backups == nil {
+		return fmt.Errorf("please provide a file, or set db-backup-path")
+	}
+	backup, err := env.backups.Create()
+	if err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	fmt.Fprintf(env.stdout, "backed up to %q\n", backup.Path)
+	return nil
+}
+
+// cmdDBRestore replaces the database with a backup, then migrates it
+func cmdDBRestore(env *commandEnv, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	if err := env.db.Restore(args[0]); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	if err := env.migrate(env.db); err != nil {
+		return fmt.Errorf("migrate restored db: %w", err)
+	}
+	fmt.Fprintf(env.stdout, "restored from %q\n", args[0])
+	return nil
+}
+
+// pragmaRows runs a pragma, returning each row with its columns joined by spaces
+func pragmaRows(dbc *gorm.DB, pragma string) ([]string, error) {
+	rows, err := dbc.Raw(pragma).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for rows.Next() {
+		values := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		strs := make([]string, len(values))
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			strs[i] = fmt.Sprint(v)
+		}
+		out = append(out, strings.Join(strs, " "))
+	}
+	return out, rows.Err()
+}
+
+// argOrStdin is the arg if there is one, otherwise the first line of stdin
+func argOrStdin(env *commandEnv, arg string) (string, error) {
+	if arg != "" {
+		return arg, nil
+	}
+	line, err := bufio.NewReader(env.stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
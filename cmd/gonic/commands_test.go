@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/playlist"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func newTestEnv(t *testing.T, stdin string) (*commandEnv, *bytes.Buffer) {
+	t.Helper()
+
+	dbc, err := db.NewMock()
+	require.NoError(t, err)
+	t.Cleanup(func() { dbc.Close() })
+	require.NoError(t, dbc.Migrate(db.MigrationContext{}))
+
+	playlistStore, err := playlist.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	var stdout bytes.Buffer
+	return &commandEnv{
+		db:            dbc,
+		playlistStore: playlistStore,
+		migrate:       func(dbc *db.DB) error { return dbc.Migrate(db.MigrationContext{}) },
+		stdin:         strings.NewReader(stdin),
+		stdout:        &stdout,
+	}, &stdout
+}
+
+func TestRunCommandUnknown(t *testing.T) {
+	t.Parallel()
+	env, _ := newTestEnv(t, "")
+
+	require.ErrorIs(t, runCommand(env, nil), errUsage)
+	require.ErrorIs(t, runCommand(env, []string{"nope"}), errUnknownCommand)
+	require.ErrorIs(t, runCommand(env, []string{"user", "nope"}), errUnknownCommand)
+	require.ErrorIs(t, runCommand(env, []string{"user"}), errUnknownCommand)
+	require.ErrorIs(t, runCommand(env, []string{"user", "del"}), errUsage)
+	require.ErrorIs(t, runCommand(env, []string{"db", "vacuum", "extra"}), errUsage)
+}
+
+func TestUserCommands(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	env, stdout := newTestEnv(t, "from-stdin\n")
+
+	// a password as an argument, and from stdin
+	require.NoError(runCommand(env, []string{"user", "add", "-admin", "alice", "secret"}))
+	require.NoError(runCommand(env, []string{"user", "add", "bob"}))
+	require.Equal("created user \"alice\"\ncreated user \"bob\"\n", stdout.String())
+
+	alice := env.db.GetUserByName("alice")
+	require.NotNil(alice)
+	require.True(alice.IsAdmin)
+	require.Equal("secret", alice.Password)
+	bob := env.db.GetUserByName("bob")
+	require.NotNil(bob)
+	require.False(bob.IsAdmin)
+	require.Equal("from-stdin", bob.Password)
+
+	stdout.Reset()
+	require.NoError(runCommand(env, []string{"user", "list"}))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(lines, 4) // with the header, and the default admin
+	require.Equal([]string{"id", "name", "admin", "created"}, strings.Fields(lines[0]))
+	require.Equal([]string{"admin", "true"}, strings.Fields(lines[1])[1:3])
+	require.Equal([]string{"alice", "true"}, strings.Fields(lines[2])[1:3])
+	require.Equal([]string{"bob", "false"}, strings.Fields(lines[3])[1:3])
+
+	stdout.Reset()
+	env.stdin = strings.NewReader("new-password\n")
+	require.NoError(runCommand(env, []string{"user", "passwd", "bob"}))
+	require.Equal("changed password for user \"bob\"\n", stdout.String())
+	require.Equal("new-password", env.db.GetUserByName("bob").Password)
+
+	// stdin is empty now
+	require.Error(runCommand(env, []string{"user", "passwd", "bob"}))
+	require.Error(runCommand(env, []string{"user", "passwd", "nobody", "password"}))
+	require.Error(runCommand(env, []string{"user", "add", "carol"}))
+	require.Nil(env.db.GetUserByName("carol"))
+
+	stdout.Reset()
+	require.NoError(runCommand(env, []string{"user", "del", "bob"}))
+	require.Equal("deleted user \"bob\"\n", stdout.String())
+	require.Nil(env.db.GetUserByName("bob"))
+	require.Error(runCommand(env, []string{"user", "del", "bob"}))
+	require.Error(runCommand(env, []string{"user", "del", "alice"})) // an admin
+	require.NotNil(env.db.GetUserByName("alice"))
+}
+
+func TestPlaylistImportExport(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	env, stdout := newTestEnv(t, "")
+
+	dir := t.TempDir()
+	m3uPath := filepath.Join(dir, "road trip.m3u")
+	require.NoError(os.WriteFile(m3uPath, []byte("#EXTM3U\n#EXTINF:123,artist - title\nalbum/track-1.flac\n\n/music/album/track-2.flac\n"), 0o600))
+
+	require.NoError(runCommand(env, []string{"playlist", "import", "admin", m3uPath}))
+	require.Equal("imported \"road trip\" with 2 tracks\n", stdout.String())
+	require.Error(runCommand(env, []string{"playlist", "import", "nobody", m3uPath}))
+
+	stdout.Reset()
+	exportDir := filepath.Join(t.TempDir(), "export")
+	require.NoError(runCommand(env, []string{"playlist", "export", "admin", exportDir}))
+	require.Contains(stdout.String(), "exported \"road trip\"")
+
+	exported, err := filepath.Glob(filepath.Join(exportDir, "*.m3u"))
+	require.NoError(err)
+	require.Len(exported, 1)
+	m3u, err := os.ReadFile(exported[0])
+	require.NoError(err)
+	// relative paths were relative to the file
+	require.Equal("#EXTM3U\n"+filepath.Join(dir, "album/track-1.flac")+"\n/music/album/track-2.flac\n", string(m3u))
+
+	// and they're read back the same
+	stdout.Reset()
+	require.NoError(runCommand(env, []string{"playlist", "import", "admin", exported[0]}))
+	require.Contains(stdout.String(), "with 2 tracks")
+}
+
+func TestDBCheck(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	env, stdout := newTestEnv(t, "")
+	if env.db.IsPostgres() {
+		require.ErrorIs(runCommand(env, []string{"db", "check"}), db.ErrSQLiteOnly)
+		return
+	}
+
+	require.NoError(runCommand(env, []string{"db", "check"}))
+	require.Equal("ok\n", stdout.String())
+
+	// lyrics for a track that doesn't exist
+	require.NoError(env.db.Exec("PRAGMA foreign_keys=OFF").Error)
+	require.NoError(env.db.Exec("INSERT INTO track_lyrics (track_id, text) VALUES (?, ?)", 1234, "lyrics").Error)
+	require.NoError(env.db.Exec("PRAGMA foreign_keys=ON").Error)
+
+	stdout.Reset()
+	require.ErrorIs(runCommand(env, []string{"db", "check"}), errDBCheck)
+	require.Contains(stdout.String(), "foreign key: track_lyrics")
+}
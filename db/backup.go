@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrSQLiteOnly   = errors.New("only supported with sqlite")
+	ErrNotGonicDB   = errors.New("not a gonic database")
+	ErrNoBackupPath = errors.New("no backup path")
+)
+
+// Backup copies the database to path with sqlite's online backup api, so it's safe while the database is
+// in use. the copy is written next to path first, so that path is only ever a whole backup
+func (db *DB) Backup(path string) error {
+	if db.IsPostgres() {
+		return ErrSQLiteOnly
+	}
+	tmp := path + ".tmp"
+	dest, err := New(tmp, url.Values{})
+	if err != nil {
+		return fmt.Errorf("open %q: %w", tmp, err)
+	}
+	err = copySQLite(dest, db)
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("copy: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("rename: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces everything in the database with the backup at path. the backup may be from an older
+// version of gonic, so migrate after
+func (db *DB) Restore(path string) error {
+	if db.IsPostgres() {
+		return ErrSQLiteOnly
+	}
+	if _, err := os.Stat(path); err != nil {
+		return err // and don't create an empty one by opening it
+	}
+	src, err := New(path, url.Values{})
+	if err != nil {
+		return fmt.Errorf("open %q: %w", path, err)
+	}
+	defer src.Close()
+	if !src.HasTable("migrations") {
+		return fmt.Errorf("%q: %w", path, ErrNotGonicDB)
+	}
+	if err := copySQLite(db, src); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	return nil
+}
+
+func copySQLite(dest, src *DB) error {
+	ctx := context.Background()
+	connSrc, err := src.DB.DB().Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get src conn: %w", err)
+	}
+	defer connSrc.Close()
+	connDest, err := dest.DB.DB().Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get dest conn: %w", err)
+	}
+	defer connDest.Close()
+
+	return connDest.Raw(func(connDest any) error {
+		return connSrc.Raw(func(connSrc any) error {
+			bk, err := connDest.(*sqlite3.SQLiteConn).Backup("main", connSrc.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return fmt.Errorf("start backup: %w", err)
+			}
+			for {
+				done, err := bk.Step(-1)
+				if err != nil {
+					_ = bk.Finish()
+					return fmt.Errorf("step backup: %w", err)
+				}
+				if done {
+					break
+				}
+				time.Sleep(100 * time.Millisecond) // busy or locked, try again
+			}
+			return bk.Finish()
+		})
+	})
+}
+
+const backupTimeFormat = "2006-01-02-150405"
+
+// BackupFile is a backup in a Backups dir
+type BackupFile struct {
+	Path string
+	Time time.Time
+	Size int64
+}
+
+// Backups keeps backups of a database in a dir, named by when they were made, like
+// gonic-2006-01-02-150405.db. after each new one, all but the newest keep are removed
+type Backups struct {
+	db   *DB
+	dir  string
+	keep int
+}
+
+// NewBackups makes dir if it doesn't exist. a keep of 0 keeps every backup
+func NewBackups(db *DB, dir string, keep int) (*Backups, error) {
+	if dir == "" {
+		return nil, ErrNoBackupPath
+	}
+	if db.IsPostgres() {
+		return nil, ErrSQLiteOnly
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("make dir: %w", err)
+	}
+	return &Backups{db: db, dir: dir, keep: keep}, nil
+}
+
+func (b *Backups) Dir() string { return b.dir }
+
+// Create backs up the database to a new file in the dir, then removes old backups
+func (b *Backups) Create() (*BackupFile, error) {
+	now := time.Now()
+	path := filepath.Join(b.dir, fmt.Sprintf("gonic-%s.db", now.Format(backupTimeFormat)))
+	if err := b.db.Backup(path); err != nil {
+		return nil, fmt.Errorf("backup to %q: %w", path, err)
+	}
+	backups, err := b.List()
+	if err != nil {
+		return nil, fmt.Errorf("list backups: %w", err)
+	}
+	if b.keep > 0 && len(backups) > b.keep {
+		for _, old := range backups[b.keep:] {
+			if err := os.Remove(old.Path); err != nil {
+				return nil, fmt.Errorf("remove old backup: %w", err)
+			}
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &BackupFile{Path: path, Time: now, Size: info.Size()}, nil
+}
+
+// List finds the backups in the dir, newest first
+func (b *Backups) List() ([]*BackupFile, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []*BackupFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "gonic-") || filepath.Ext(name) != ".db" {
+			continue
+		}
+		t, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, "gonic-"), ".db"), time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, &BackupFile{Path: filepath.Join(b.dir, name), Time: t, Size: info.Size()})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups, nil
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupRestore(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	dir := t.TempDir()
+	testDB, err := New(filepath.Join(dir, "gonic.db"), DefaultOptions())
+	require.NoError(err)
+	t.Cleanup(func() { testDB.Close() })
+	require.NoError(testDB.Migrate(MigrationContext{}))
+	require.NoError(testDB.SetSetting("key", "before"))
+
+	backupPath := filepath.Join(dir, "backup.db")
+	require.NoError(testDB.Backup(backupPath))
+	require.NoFileExists(backupPath + ".tmp")
+
+	require.NoError(testDB.SetSetting("key", "after"))
+	require.NoError(testDB.Restore(backupPath))
+	value, err := testDB.GetSetting("key")
+	require.NoError(err)
+	require.Equal("before", value)
+
+	// not a backup
+	notBackupPath := filepath.Join(dir, "empty.db")
+	emptyDB, err := New(notBackupPath, url.Values{})
+	require.NoError(err)
+	require.NoError(emptyDB.Close())
+	require.ErrorIs(testDB.Restore(notBackupPath), ErrNotGonicDB)
+	require.ErrorIs(testDB.Restore(filepath.Join(dir, "missing.db")), os.ErrNotExist)
+}
+
+func TestBackupsKeep(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	testDB, err := NewMock()
+	require.NoError(err)
+	t.Cleanup(func() { testDB.Close() })
+	if testDB.IsPostgres() {
+		t.Skip("backups are only supported with sqlite")
+	}
+	require.NoError(testDB.Migrate(MigrationContext{}))
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	backups, err := NewBackups(testDB, dir, 2)
+	require.NoError(err)
+
+	// made before, and not removed as they're not backups
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"gonic-" + old.Format(backupTimeFormat) + ".db", "gonic.db", "notes.txt"} {
+		require.NoError(os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+
+	created, err := backups.Create()
+	require.NoError(err)
+	require.NotZero(created.Size)
+
+	list, err := backups.List()
+	require.NoError(err)
+	require.Len(list, 2)
+	require.Equal(created.Path, list[0].Path)
+
+	// with keep 2, the oldest is removed
+	oldest := filepath.Join(dir, "gonic-"+old.Add(-time.Hour).Format(backupTimeFormat)+".db")
+	require.NoError(os.WriteFile(oldest, nil, 0o600))
+	_, err = backups.Create()
+	require.NoError(err)
+	list, err = backups.List()
+	require.NoError(err)
+	require.Len(list, 2)
+	require.NoFileExists(oldest)
+	require.FileExists(filepath.Join(dir, "gonic.db"))
+	require.FileExists(filepath.Join(dir, "notes.txt"))
+}
@@ -6,7 +6,9 @@ import (
 	"math/rand"
 	"os"
 	"testing"
+	"time"
 
+	_ "github.com/jinzhu/gorm/dialects/postgres"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/stretchr/testify/require"
 )
@@ -46,7 +48,59 @@ func TestGetSetting(t *testing.T) {
 	require.Equal(value, actual)
 }
 
+func TestNoCase(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	testDB, err := NewMock()
+	require.NoError(err)
+	t.Cleanup(func() { testDB.Close() })
+	require.NoError(testDB.Migrate(MigrationContext{}))
+	require.NoError(testDB.SetSetting("Mixed Case", "value"))
+
+	var setting Setting
+	require.NoError(testDB.Where(testDB.NoCase("key")+"="+testDB.NoCase("?"), "mixed CASE").First(&setting).Error)
+	require.Equal("Mixed Case", setting.Key)
+	require.NoError(testDB.Where("key "+testDB.ILike()+" ?", "%d c%").First(&setting).Error)
+	require.Equal("Mixed Case", setting.Key)
+}
+
 func TestMain(m *testing.M) {
 	log.SetOutput(io.Discard)
 	os.Exit(m.Run())
 }
+
+func TestMigrateListensKeepsPlays(t *testing.T) {
+	require := require.New(t)
+
+	testDB, err := NewMock()
+	require.NoError(err)
+	t.Cleanup(func() { testDB.Close() })
+	require.NoError(testDB.Migrate(MigrationContext{}))
+	if testDB.IsPostgres() {
+		// which start from the current schema, without plays
+		require.NoError(testDB.AutoMigrate(play{}).Error)
+	}
+
+	user := testDB.GetUserByName("admin")
+	require.NotNil(user)
+	album := Album{RootDir: "/music", LeftPath: "artist/", RightPath: "album"}
+	require.NoError(testDB.Create(&album).Error)
+	lastPlay := time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(testDB.Create(&play{UserID: user.ID, AlbumID: album.ID, Time: lastPlay, Count: 12, Length: 3600}).Error)
+
+	require.NoError(migrateListens(testDB.DB, MigrationContext{}))
+
+	var listens []*Listen
+	require.NoError(testDB.Find(&listens).Error)
+	require.Len(listens, 1)
+	require.True(listens[0].Aggregate)
+	require.Equal(12, listens[0].Count)
+	require.Equal(3600, listens[0].Length)
+	require.Zero(listens[0].TrackID)
+	require.True(lastPlay.Equal(listens[0].Time))
+
+	var plays int
+	require.NoError(testDB.Table("plays").Count(&plays).Error)
+	require.Equal(1, plays)
+}
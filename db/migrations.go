@@ -15,6 +15,19 @@ import (
 	"gopkg.in/gormigrate.v1"
 )
 
+// play was an album's play count and length for a user, until it was replaced by Listen. the plays
+// table is kept, but no longer used
+type play struct {
+	ID      int `gorm:"primary_key"`
+	User    *User
+	UserID  int `gorm:"not null; index" sql:"default: null; type:int REFERENCES users(id) ON DELETE CASCADE"`
+	Album   *Album
+	AlbumID int       `gorm:"not null; index" sql:"default: null; type:int REFERENCES albums(id) ON DELETE CASCADE"`
+	Time    time.Time `sql:"default: null"`
+	Count   int
+	Length  int
+}
+
 type MigrationContext struct {
 	OriginalMusicPath string
 	PlaylistsPath     string
@@ -58,11 +71,87 @@ func (db *DB) Migrate(ctx MigrationContext) error {
 		construct(ctx, "202305301718", migratePlayCountToLength),
 		construct(ctx, "202307281628", migrateAlbumArtistsMany2Many),
 		construct(ctx, "202309070009", migrateDeleteArtistCoverField),
+		construct(ctx, "202610171105", migrateTrackHash),
+		construct(ctx, "202610171240", migrateTrackCue),
+		construct(ctx, "202610171415", migrateAlbumEmbeddedCover),
+		construct(ctx, "202610171530", migrateTrackLyrics),
+		construct(ctx, "202610171610", migrateTrackReplayGain),
+		construct(ctx, "202610171705", migrateExtendedTags),
+		construct(ctx, "202610171740", migrateArtistBrainzID),
+		construct(ctx, "202610171815", migrateTrackArtists),
+		construct(ctx, "202610171900", migrateSortTags),
+		construct(ctx, "202610171930", migrateScanErrors),
+		construct(ctx, "202610172000", migrateAlbumMergedInto),
+		construct(ctx, "202610172030", migrateAlbumGrouping),
+		construct(ctx, "202610172100", migrateTrackAudioProperties),
+		construct(ctx, "202610172200", migrateListens),
+		construct(ctx, "202610172300", migrateMissingSince),
+	}
+
+	m := gormigrate.New(db.DB, options, migrations)
+	if db.IsPostgres() {
+		// the older migrations are written for sqlite, so a new postgres database is created with the
+		// current schema, and all of the migrations are marked as done
+		m.InitSchema(migratePostgresSchema)
+	}
+	if err := m.Migrate(); err != nil {
+		return err
+	}
+	db.searchIndex.Store(!db.IsPostgres() && db.Dialect().HasTable(SearchTable("tracks")))
+	return nil
+}
+
+func migratePostgresSchema(tx *gorm.DB) error {
+	// in order of their foreign keys
+	step := tx.AutoMigrate(
+		User{},
+		Setting{},
+		Genre{},
+		Artist{},
+		Album{},
+		Track{},
+		Listen{},
+		TrackPlay{},
+		PlayQueue{},
+		TranscodePreference{},
+		AlbumStar{},
+		AlbumRating{},
+		ArtistStar{},
+		ArtistRating{},
+		TrackStar{},
+		TrackRating{},
+		TrackLyrics{},
+		ScanError{},
+		Podcast{},
+		PodcastEpisode{},
+		Bookmark{},
+		InternetRadioStation{},
+	)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step auto migrate: %w", err)
+	}
+
+	// auto migrating the many to many fields creates the join tables without their foreign keys
+	step = tx.DropTable(
+		AlbumArtist{},
+		TrackArtist{},
+		TrackGenre{},
+		AlbumGenre{},
+	)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step drop join tables: %w", err)
+	}
+	step = tx.AutoMigrate(
+		AlbumArtist{},
+		TrackArtist{},
+		TrackGenre{},
+		AlbumGenre{},
+	)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step auto migrate join tables: %w", err)
 	}
 
-	return gormigrate.
-		New(db.DB, options, migrations).
-		Migrate()
+	return migrateCreateInitUser(tx, MigrationContext{})
 }
 
 func construct(ctx MigrationContext, id string, f func(*gorm.DB, MigrationContext) error) *gormigrate.Migration {
@@ -92,7 +181,7 @@ func migrateInitSchema(tx *gorm.DB, _ MigrationContext) error {
 		Artist{},
 		User{},
 		Setting{},
-		Play{},
+		play{},
 		Album{},
 		PlayQueue{},
 	).
@@ -523,7 +612,7 @@ func migratePlaylistsToM3U(tx *gorm.DB, ctx MigrationContext) error {
 
 func migratePlayCountToLength(tx *gorm.DB, _ MigrationContext) error {
 	step := tx.AutoMigrate(
-		Play{},
+		play{},
 	)
 	if err := step.Error; err != nil {
 		return fmt.Errorf("step auto migrate: %w", err)
@@ -605,3 +694,180 @@ func migrateDeleteArtistCoverField(tx *gorm.DB, _ MigrationContext) error {
 
 	return nil
 }
+
+func migrateTrackHash(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		Track{},
+	).
+		Error
+}
+
+func migrateTrackCue(tx *gorm.DB, _ MigrationContext) error {
+	// the unique index now includes the cue track, and will be recreated by auto migrate
+	step := tx.Exec(`
+		DROP INDEX IF EXISTS idx_folder_filename;
+	`)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step drop idx: %w", err)
+	}
+
+	step = tx.AutoMigrate(
+		Track{},
+	)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step auto migrate: %w", err)
+	}
+	return nil
+}
+
+func migrateAlbumEmbeddedCover(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		Album{},
+	).
+		Error
+}
+
+func migrateTrackLyrics(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		TrackLyrics{},
+	).
+		Error
+}
+
+func migrateTrackReplayGain(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		Track{},
+	).
+		Error
+}
+
+func migrateExtendedTags(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		Track{},
+		Album{},
+	).
+		Error
+}
+
+func migrateArtistBrainzID(tx *gorm.DB, _ MigrationContext) error {
+	// artists with the same name can now be told apart by their musicbrainz ID
+	step := tx.Exec(`
+		DROP INDEX IF EXISTS uix_artists_name;
+	`)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step drop idx: %w", err)
+	}
+
+	step = tx.AutoMigrate(
+		Artist{},
+	)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step auto migrate: %w", err)
+	}
+	return nil
+}
+
+func migrateTrackArtists(tx *gorm.DB, _ MigrationContext) error {
+	// earlier auto migrates of tracks create the join table without its foreign keys
+	step := tx.Exec(`
+		DROP TABLE IF EXISTS track_artists;
+	`)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step drop join table: %w", err)
+	}
+
+	step = tx.AutoMigrate(
+		TrackArtist{},
+	)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step auto migrate: %w", err)
+	}
+	return nil
+}
+
+func migrateSortTags(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		Artist{},
+		Album{},
+		Track{},
+	).
+		Error
+}
+
+func migrateScanErrors(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		ScanError{},
+	).
+		Error
+}
+
+func migrateAlbumMergedInto(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		Album{},
+	).
+		Error
+}
+
+func migrateAlbumGrouping(tx *gorm.DB, _ MigrationContext) error {
+	// the unique index now includes the tag group, and will be recreated by auto migrate
+	step := tx.Exec(`
+		DROP INDEX IF EXISTS idx_album_abs_path;
+	`)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step drop idx: %w", err)
+	}
+
+	step = tx.AutoMigrate(
+		Album{},
+		Track{},
+	)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step auto migrate: %w", err)
+	}
+
+	step = tx.Exec(`
+		UPDATE tracks SET tag_album_id=album_id;
+	`)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step set tag album: %w", err)
+	}
+	return nil
+}
+
+func migrateTrackAudioProperties(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		Track{},
+	).
+		Error
+}
+
+func migrateListens(tx *gorm.DB, _ MigrationContext) error {
+	step := tx.AutoMigrate(
+		Listen{},
+		TrackPlay{},
+	)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step auto migrate: %w", err)
+	}
+
+	// the plays don't say which tracks were played, or when except for the last, so they're kept as
+	// aggregates for the frequent and recent lists, but not listening stats. the plays table is left as it was
+	step = tx.Exec(`
+		INSERT INTO listens (user_id, album_id, time, length, count, aggregate)
+			SELECT user_id, album_id, time, length, count, ?
+			FROM plays
+			WHERE time IS NOT NULL;
+	`, true)
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step migrate plays: %w", err)
+	}
+	return nil
+}
+
+func migrateMissingSince(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		Album{},
+		Track{},
+	).
+		Error
+}
@@ -45,8 +45,10 @@ func joinIds(in []specid.ID, sep string) string {
 
 type Artist struct {
 	ID            int      `gorm:"primary_key"`
-	Name          string   `gorm:"not null; unique_index"`
+	Name          string   `gorm:"not null; index"`
 	NameUDec      string   `sql:"default: null"`
+	NameSort      string   `sql:"default: null"`              // from the artistsort or albumartistsort tags
+	BrainzID      string   `gorm:"index" sql:"default: null"` // musicbrainz artist ID, which tells apart artists with the same name
 	Albums        []*Album `gorm:"many2many:album_artists"`
 	AlbumCount    int      `sql:"-"`
 	ArtistStar    *ArtistStar
@@ -83,26 +85,78 @@ type AudioFile interface {
 }
 
 type Track struct {
-	ID             int `gorm:"primary_key"`
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Filename       string `gorm:"not null; unique_index:idx_folder_filename" sql:"default: null"`
-	FilenameUDec   string `sql:"default: null"`
-	Album          *Album
-	AlbumID        int      `gorm:"not null; unique_index:idx_folder_filename" sql:"default: null; type:int REFERENCES albums(id) ON DELETE CASCADE"`
-	Genres         []*Genre `gorm:"many2many:track_genres"`
-	Size           int      `sql:"default: null"`
-	Length         int      `sql:"default: null"`
-	Bitrate        int      `sql:"default: null"`
-	TagTitle       string   `sql:"default: null"`
-	TagTitleUDec   string   `sql:"default: null"`
-	TagTrackArtist string   `sql:"default: null"`
-	TagTrackNumber int      `sql:"default: null"`
-	TagDiscNumber  int      `sql:"default: null"`
-	TagBrainzID    string   `sql:"default: null"`
-	TrackStar      *TrackStar
-	TrackRating    *TrackRating
-	AverageRating  float64 `sql:"default: null"`
+	ID                  int `gorm:"primary_key"`
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Filename            string `gorm:"not null; unique_index:idx_folder_filename" sql:"default: null"`
+	FilenameUDec        string `sql:"default: null"`
+	Album               *Album
+	AlbumID             int       `gorm:"not null; unique_index:idx_folder_filename" sql:"default: null; type:int REFERENCES albums(id) ON DELETE CASCADE"`
+	Genres              []*Genre  `gorm:"many2many:track_genres"`
+	Artists             []*Artist `gorm:"many2many:track_artists"`
+	Size                int       `sql:"default: null"`
+	Length              int       `sql:"default: null"`
+	Bitrate             int       `sql:"default: null"`
+	SampleRate          int       `sql:"default: null"`
+	BitDepth            int       `sql:"default: null"`
+	Channels            int       `sql:"default: null"`
+	TagTitle            string    `sql:"default: null"`
+	TagTitleUDec        string    `sql:"default: null"`
+	TagTitleSort        string    `sql:"default: null"`
+	TagTrackArtist      string    `sql:"default: null"`
+	TagTrackNumber      int       `sql:"default: null"`
+	TagDiscNumber       int       `sql:"default: null"`
+	TagBrainzID         string    `sql:"default: null"`
+	Hash                string    `sql:"default: null"`                                                // of the start and end of the file, to find moved tracks
+	CueTrack            int       `gorm:"not null; unique_index:idx_folder_filename" sql:"default: 0"` // if the file is split by a cue sheet
+	CueStart            int       `sql:"default: null"`                                                // in milliseconds
+	CueEnd              int       `sql:"default: null"`                                                // in milliseconds, or 0 for the end of the file
+	ReplayGainTrackGain float32   `sql:"default: null"`                                                // in dB
+	ReplayGainTrackPeak float32   `sql:"default: null"`
+	ReplayGainAlbumGain float32   `sql:"default: null"` // in dB
+	ReplayGainAlbumPeak float32   `sql:"default: null"`
+	R128TrackGain       int       `sql:"default: null"` // in Q7.8 fixed point dB, relative to -23 LUFS
+	R128AlbumGain       int       `sql:"default: null"`
+	TagComposer         string    `sql:"default: null"`
+	TagConductor        string    `sql:"default: null"`
+	TagLyricist         string    `sql:"default: null"`
+	TagComment          string    `sql:"default: null"`
+	TagBPM              int       `sql:"default: null"`
+	TagDiscSubtitle     string    `sql:"default: null"`
+	TrackStar           *TrackStar
+	TrackRating         *TrackRating
+	TrackPlay           *TrackPlay
+	AverageRating       float64 `sql:"default: null"`
+
+	// when a scan last couldn't find it. it's kept for a while, hidden, in case it comes back
+	MissingSince *time.Time `sql:"default: null"`
+
+	// the album the track is in when browsing by tags. that's its folder's, unless albums are grouped by
+	// tags and the track's album tags are different to the folder's
+	TagAlbum   *Album
+	TagAlbumID *int `gorm:"index" sql:"type:int REFERENCES albums(id) ON DELETE SET NULL"`
+}
+
+// AlbumByTags is the album the track is in when browsing by tags, if TagAlbum is loaded, or else its
+// folder's album
+func (t *Track) AlbumByTags() *Album {
+	if t.TagAlbum != nil {
+		return t.TagAlbum
+	}
+	return t.Album
+}
+
+// CueRange is the part of the file the track covers if it's from a cue sheet. a zero
+// duration means until the end of the file
+func (t *Track) CueRange() (start, duration time.Duration) {
+	if t.CueTrack == 0 {
+		return 0, 0
+	}
+	start = time.Duration(t.CueStart) * time.Millisecond
+	if t.CueEnd > t.CueStart {
+		duration = time.Duration(t.CueEnd-t.CueStart) * time.Millisecond
+	}
+	return start, duration
 }
 
 func (t *Track) AudioLength() int  { return t.Length }
@@ -176,41 +230,74 @@ type Setting struct {
 	Value string `sql:"default: null"`
 }
 
-type Play struct {
+// Listen is a play of a track by a user, from a scrobble submission, or from streaming the track
+type Listen struct {
 	ID      int `gorm:"primary_key"`
 	User    *User
 	UserID  int `gorm:"not null; index" sql:"default: null; type:int REFERENCES users(id) ON DELETE CASCADE"`
+	Track   *Track
+	TrackID int `gorm:"index" sql:"default: null; type:int REFERENCES tracks(id) ON DELETE SET NULL"` // or null if the track was deleted
 	Album   *Album
-	AlbumID int       `gorm:"not null; index" sql:"default: null; type:int REFERENCES albums(id) ON DELETE CASCADE"`
-	Time    time.Time `sql:"default: null"`
+	AlbumID int       `gorm:"not null; index" sql:"default: null; type:int REFERENCES albums(id) ON DELETE CASCADE"` // the track's album when browsing by tags
+	Time    time.Time `gorm:"not null; index" sql:"default: null"`
+	Client  string    `sql:"default: null"`
+	Length  int       `sql:"default: null"` // in seconds
+	Count   int       `gorm:"not null" sql:"default: 1"`
+
+	// Aggregate is all of a user's plays of an album from before listens were recorded, with their total
+	// Count and Length, and Time of the last. they have no track, and no time for each play
+	Aggregate bool `gorm:"not null" sql:"default: false"`
+}
+
+// TrackPlay is the count of a user's listens of a track, and the time of their last
+type TrackPlay struct {
+	UserID  int `gorm:"primary_key; not null" sql:"default: null; type:int REFERENCES users(id) ON DELETE CASCADE"`
+	TrackID int `gorm:"primary_key; not null" sql:"default: null; type:int REFERENCES tracks(id) ON DELETE CASCADE"`
 	Count   int
-	Length  int
+	Time    time.Time
 }
 
 type Album struct {
-	ID            int `gorm:"primary_key"`
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	ModifiedAt    time.Time
-	LeftPath      string `gorm:"unique_index:idx_album_abs_path"`
-	RightPath     string `gorm:"not null; unique_index:idx_album_abs_path" sql:"default: null"`
-	RightPathUDec string `sql:"default: null"`
-	Parent        *Album
-	ParentID      int       `sql:"default: null; type:int REFERENCES albums(id) ON DELETE CASCADE"`
-	RootDir       string    `gorm:"unique_index:idx_album_abs_path" sql:"default: null"`
-	Genres        []*Genre  `gorm:"many2many:album_genres"`
-	Cover         string    `sql:"default: null"`
-	Artists       []*Artist `gorm:"many2many:album_artists"`
-	TagTitle      string    `sql:"default: null"`
-	TagTitleUDec  string    `sql:"default: null"`
-	TagBrainzID   string    `sql:"default: null"`
-	TagYear       int       `sql:"default: null"`
-	Tracks        []*Track
-	ChildCount    int `sql:"-"`
-	Duration      int `sql:"-"`
-	AlbumStar     *AlbumStar
-	AlbumRating   *AlbumRating
-	AverageRating float64 `sql:"default: null"`
+	ID               int `gorm:"primary_key"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	ModifiedAt       time.Time
+	LeftPath         string `gorm:"unique_index:idx_album_abs_path"`
+	RightPath        string `gorm:"not null; unique_index:idx_album_abs_path" sql:"default: null"`
+	RightPathUDec    string `sql:"default: null"`
+	Parent           *Album
+	ParentID         int       `sql:"default: null; type:int REFERENCES albums(id) ON DELETE CASCADE"`
+	RootDir          string    `gorm:"unique_index:idx_album_abs_path" sql:"default: null"`
+	Genres           []*Genre  `gorm:"many2many:album_genres"`
+	Cover            string    `sql:"default: null"`
+	EmbeddedCover    string    `sql:"default: null"` // a track with an embedded cover, used if there's no cover file
+	Artists          []*Artist `gorm:"many2many:album_artists"`
+	TagTitle         string    `sql:"default: null"`
+	TagTitleUDec     string    `sql:"default: null"`
+	TagTitleSort     string    `sql:"default: null"`
+	TagBrainzID      string    `sql:"default: null"`
+	TagYear          int       `sql:"default: null"`
+	TagOriginalDate  string    `sql:"default: null"` // like 2006, 2006-01, or 2006-01-02
+	TagLabel         string    `sql:"default: null"`
+	TagCatalogNumber string    `sql:"default: null"`
+	TagCompilation   bool      `sql:"default: null"`
+	TagReleaseTypes  string    `sql:"default: null"` // separated by ";"
+	Tracks           []*Track
+	ChildCount       int `sql:"-"`
+	Duration         int `sql:"-"`
+	AlbumStar        *AlbumStar
+	AlbumRating      *AlbumRating
+	AverageRating    float64 `sql:"default: null"`
+
+	// the first disc's album, if this folder is a later disc of a multi-disc album
+	MergedIntoID *int `gorm:"index" sql:"type:int REFERENCES albums(id) ON DELETE SET NULL"`
+
+	// when a scan last couldn't find it. it's kept for a while, hidden, in case it comes back
+	MissingSince *time.Time `sql:"default: null"`
+
+	// for albums which aren't a folder themselves, but group some of a folder's tracks by their album
+	// tags, the key of those tags. empty for folders
+	TagGroup string `gorm:"not null; unique_index:idx_album_abs_path" sql:"default: ''"`
 }
 
 func (a *Album) SID() *specid.ID {
@@ -221,6 +308,39 @@ func (a *Album) ParentSID() *specid.ID {
 	return &specid.ID{Type: specid.Album, Value: a.ParentID}
 }
 
+// TagAlbumID is the album which a's tracks belong to when browsing by tags. it's a different folder's
+// if a is one of the discs of a multi-disc album
+func (a *Album) TagAlbumID() int {
+	if a.MergedIntoID != nil {
+		return *a.MergedIntoID
+	}
+	return a.ID
+}
+
+func (a *Album) TagSID() *specid.ID {
+	return &specid.ID{Type: specid.Album, Value: a.TagAlbumID()}
+}
+
+// IsFolder is false for albums which only group tracks by their tags
+func (a *Album) IsFolder() bool {
+	return a.TagGroup == ""
+}
+
+func (a *Album) AbsPath() string {
+	return path.Join(a.RootDir, a.LeftPath, a.RightPath)
+}
+
+func (a *Album) ReleaseTypes() []string {
+	if a.TagReleaseTypes == "" {
+		return nil
+	}
+	return strings.Split(a.TagReleaseTypes, ";")
+}
+
+func (a *Album) HasCover() bool {
+	return a.Cover != "" || a.EmbeddedCover != ""
+}
+
 func (a *Album) IndexRightPath() string {
 	if len(a.RightPathUDec) > 0 {
 		return a.RightPathUDec
@@ -287,6 +407,13 @@ type AlbumArtist struct {
 	ArtistID int `gorm:"not null; unique_index:idx_album_id_artist_id" sql:"default: null; type:int REFERENCES artists(id) ON DELETE CASCADE"`
 }
 
+type TrackArtist struct {
+	Track    *Track
+	TrackID  int `gorm:"not null; unique_index:idx_track_id_artist_id" sql:"default: null; type:int REFERENCES tracks(id) ON DELETE CASCADE"`
+	Artist   *Artist
+	ArtistID int `gorm:"not null; unique_index:idx_track_id_artist_id" sql:"default: null; type:int REFERENCES artists(id) ON DELETE CASCADE"`
+}
+
 type TrackGenre struct {
 	Track   *Track
 	TrackID int `gorm:"not null; unique_index:idx_track_id_genre_id" sql:"default: null; type:int REFERENCES tracks(id) ON DELETE CASCADE"`
@@ -337,6 +464,33 @@ type TrackRating struct {
 	Rating  int `gorm:"not null; check:(rating >= 1 AND rating <= 5)"`
 }
 
+type TrackLyrics struct {
+	ID      int `gorm:"primary_key"`
+	Track   *Track
+	TrackID int    `gorm:"not null; index" sql:"default: null; type:int REFERENCES tracks(id) ON DELETE CASCADE"`
+	Source  string `sql:"default: null"` // the sidecar file, or empty if embedded in the track
+	Text    string `sql:"default: null"` // plain, or lrc formatted if synced
+}
+
+type ScanErrorKind string
+
+const (
+	ScanErrorKindFolder ScanErrorKind = "folder" // the folder couldn't be read
+	ScanErrorKindFile   ScanErrorKind = "file"   // a file couldn't be read
+	ScanErrorKindTags   ScanErrorKind = "tags"   // a file's tags couldn't be read
+	ScanErrorKindWrite  ScanErrorKind = "write"  // the folder couldn't be saved
+)
+
+// ScanError is a file or folder which couldn't be scanned. they're replaced each time their path is scanned,
+// so the ones which have been fixed go away
+type ScanError struct {
+	ID       int           `gorm:"primary_key"`
+	ScanTime time.Time     `gorm:"not null; index"` // when the scan which found it started
+	Path     string        `gorm:"not null; index"` // absolute
+	Kind     ScanErrorKind `gorm:"not null"`
+	Message  string        `sql:"default: null"`
+}
+
 type PodcastAutoDownload string
 
 const (
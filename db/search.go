@@ -0,0 +1,190 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// the search index is made of sqlite fts5 tables, one for each of the searchable tables, with rows
+// by the same ID. go-sqlite3 only has fts5 with the sqlite_fts5 build tag, so without it, or with
+// postgres, there's no index and searches fall back to LIKE queries
+
+type searchTable struct {
+	table   string
+	columns string // of the fts5 table, in the order of the values selected by rows
+	weights string // of the columns, for bm25 ranking
+	rows    string // selects the index's rows for the IDs matched by its WHERE clause
+}
+
+// diacritics are removed, so "bjork" finds Björk. the *UDec fields, for the words of other scripts, are
+// in a column of their own so that they don't count twice for words which are already latin
+var searchTables = []searchTable{
+	{
+		table:   "artists",
+		columns: "name, decoded",
+		weights: "10.0, 1.0",
+		rows: `SELECT artists.id, artists.name, artists.name_u_dec
+		FROM artists
+		WHERE %s`,
+	},
+	{
+		table:   "albums",
+		columns: "title, artist, path, decoded",
+		weights: "10.0, 5.0, 1.0, 1.0",
+		rows: `SELECT albums.id, albums.tag_title, album_artists.names, albums.right_path,
+			coalesce(albums.tag_title_u_dec, '') || ' ' || coalesce(album_artists.names_u_dec, '') || ' ' || coalesce(albums.right_path_u_dec, '')
+		FROM albums
+		LEFT JOIN (
+			SELECT album_artists.album_id, group_concat(artists.name, ' ') names, group_concat(artists.name_u_dec, ' ') names_u_dec
+			FROM album_artists JOIN artists ON artists.id=album_artists.artist_id
+			GROUP BY album_artists.album_id
+		) album_artists ON album_artists.album_id=albums.id
+		WHERE %s`,
+	},
+	{
+		table:   "tracks",
+		columns: "title, album, artist, path, decoded",
+		weights: "10.0, 3.0, 5.0, 1.0, 1.0",
+		rows: `SELECT tracks.id, tracks.tag_title, albums.tag_title, track_artists.names, tracks.filename,
+			coalesce(tracks.tag_title_u_dec, '') || ' ' || coalesce(albums.tag_title_u_dec, '') || ' ' || coalesce(track_artists.names_u_dec, '') || ' ' || coalesce(tracks.filename_u_dec, '')
+		FROM tracks
+		LEFT JOIN albums ON albums.id=tracks.tag_album_id
+		LEFT JOIN (
+			SELECT track_artists.track_id, group_concat(artists.name, ' ') names, group_concat(artists.name_u_dec, ' ') names_u_dec
+			FROM track_artists JOIN artists ON artists.id=track_artists.artist_id
+			GROUP BY track_artists.track_id
+		) track_artists ON track_artists.track_id=tracks.id
+		WHERE %s`,
+	},
+}
+
+// SearchTable is the search index's table for table, which has the ID of the row in table as its rowid,
+// and a rank column to order the matches by
+func SearchTable(table string) string {
+	return table + "_fts"
+}
+
+// HasSearchIndex is true if the search index has been created, by UpdateSearchIndex
+func (db *DB) HasSearchIndex() bool {
+	return db.searchIndex.Load()
+}
+
+// CanSearchIndex is true if the search index can be created, which needs sqlite with fts5
+func (db *DB) CanSearchIndex() (bool, error) {
+	if db.IsPostgres() {
+		return false, nil
+	}
+	var fts5 bool
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Row().Scan(&fts5); err != nil {
+		return false, fmt.Errorf("check compile options: %w", err)
+	}
+	return fts5, nil
+}
+
+// UpdateSearchIndex creates the search index if it can, removes what's no longer in the library from it,
+// and indexes anything not in it yet. trackIDs and albumIDs are updated tracks and albums to index again,
+// along with their artists, and the tracks of the albums
+func (db *DB) UpdateSearchIndex(trackIDs, albumIDs []int64) error {
+	if ok, err := db.CanSearchIndex(); err != nil || !ok {
+		return err
+	}
+
+	var err error
+	var artistIDs []int64
+	if trackIDs, err = db.relatedIDs(trackIDs, "tracks", "id", "tag_album_id", albumIDs); err != nil {
+		return fmt.Errorf("find tracks of albums: %w", err)
+	}
+	if artistIDs, err = db.relatedIDs(nil, "track_artists", "artist_id", "track_id", trackIDs); err != nil {
+		return fmt.Errorf("find artists of tracks: %w", err)
+	}
+	if artistIDs, err = db.relatedIDs(artistIDs, "album_artists", "artist_id", "album_id", albumIDs); err != nil {
+		return fmt.Errorf("find artists of albums: %w", err)
+	}
+
+	updated := map[string][]int64{
+		"artists": artistIDs,
+		"albums":  albumIDs,
+		"tracks":  trackIDs,
+	}
+	for _, st := range searchTables {
+		if err := db.updateSearchTable(st, updated[st.table]); err != nil {
+			return fmt.Errorf("%s: %w", st.table, err)
+		}
+	}
+	db.searchIndex.Store(true)
+	return nil
+}
+
+func (db *DB) updateSearchTable(st searchTable, ids []int64) error {
+	fts := SearchTable(st.table)
+	insert := fmt.Sprintf("INSERT INTO %s(rowid, %s) %s", fts, st.columns, st.rows)
+
+	if !db.Dialect().HasTable(fts) {
+		step := db.Exec(fmt.Sprintf(`CREATE VIRTUAL TABLE %s USING fts5(%s, tokenize='unicode61 remove_diacritics 2', prefix='2 3')`, fts, st.columns))
+		if err := step.Error; err != nil {
+			return fmt.Errorf("step create: %w", err)
+		}
+		step = db.Exec(fmt.Sprintf(`INSERT INTO %[1]s(%[1]s, rank) VALUES('rank', 'bm25(%[2]s)')`, fts, st.weights))
+		if err := step.Error; err != nil {
+			return fmt.Errorf("step set rank: %w", err)
+		}
+	}
+
+	step := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE rowid NOT IN (SELECT id FROM %s)", fts, st.table))
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step delete missing: %w", err)
+	}
+	err := db.TransactionChunked(ids, func(tx *gorm.DB, chunk []int64) error {
+		if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE rowid IN (?)", fts), chunk).Error; err != nil {
+			return err
+		}
+		return tx.Exec(fmt.Sprintf(insert, st.table+".id IN (?)"), chunk).Error
+	})
+	if err != nil {
+		return fmt.Errorf("step update: %w", err)
+	}
+	step = db.Exec(fmt.Sprintf(insert, fmt.Sprintf("%s.id NOT IN (SELECT rowid FROM %s)", st.table, fts)))
+	if err := step.Error; err != nil {
+		return fmt.Errorf("step insert new: %w", err)
+	}
+	return nil
+}
+
+// relatedIDs adds the column of the rows of table with whereCol in ids to into, without duplicates
+func (db *DB) relatedIDs(into []int64, table, column, whereCol string, ids []int64) ([]int64, error) {
+	seen := make(map[int64]struct{}, len(into))
+	for _, id := range into {
+		seen[id] = struct{}{}
+	}
+	err := db.TransactionChunked(ids, func(tx *gorm.DB, chunk []int64) error {
+		var related []int64
+		if err := tx.Table(table).Where(whereCol+" IN (?)", chunk).Pluck(column, &related).Error; err != nil {
+			return err
+		}
+		for _, id := range related {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				into = append(into, id)
+			}
+		}
+		return nil
+	})
+	return into, err
+}
+
+// SearchMatch makes an fts5 query from a search query, which matches rows with words starting with each of
+// the query's words, in any column. it's empty if there are no words to search for
+func SearchMatch(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		word = strings.Trim(word, `*"'`)
+		if word == "" {
+			continue
+		}
+		// as a quoted string, so that fts5 syntax like "-" and "OR" in the query is searched for
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var ErrUnknownListenRange = errors.New("unknown range")
+
+// ListenRange is the time range to summarise listens in, by its name. "week", "month", and "year" end now,
+// "all" is open at both ends, and a year like "2023" is that calendar year, for a year in review
+func ListenRange(name string, now time.Time) (from, to time.Time, err error) {
+	switch name {
+	case "week":
+		return now.AddDate(0, 0, -7), now, nil
+	case "month":
+		return now.AddDate(0, -1, 0), now, nil
+	case "year":
+		return now.AddDate(-1, 0, 0), now, nil
+	case "all":
+		return time.Time{}, time.Time{}, nil
+	}
+	if year, err := strconv.Atoi(name); err == nil && len(name) == 4 {
+		from = time.Date(year, time.January, 1, 0, 0, 0, 0, now.Location())
+		return from, from.AddDate(1, 0, 0), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("%q: %w", name, ErrUnknownListenRange)
+}
+
+// ListenStat is how much a user listened to an artist, album, track, or genre
+type ListenStat struct {
+	ID      int
+	Name    string
+	Artist  string // for tracks
+	Listens int
+	Length  int // in seconds
+}
+
+// ListenPeriod is how much a user listened in a day, like "2006-01-02", or a month, like "2006-01"
+type ListenPeriod struct {
+	Period  string
+	Listens int
+	Length  int // in seconds
+}
+
+type ListenStats struct {
+	Listens int
+	Length  int // in seconds
+	Tracks  int // the number of different tracks listened to
+	Albums  int
+	Artists int
+
+	TopArtists []*ListenStat
+	TopAlbums  []*ListenStat
+	TopTracks  []*ListenStat
+	TopGenres  []*ListenStat
+
+	Days       []*ListenPeriod // only those with listens, in order
+	Months     []*ListenPeriod
+	BusiestDay *ListenPeriod
+}
+
+// ListenStats summarises a user's listens from from until to, with up to count of the most listened to
+// artists, albums, tracks, and genres. a zero from or to leaves the range open at that end. days and months
+// are in loc. aggregates of plays from before listens were recorded aren't counted, since there's no
+// telling when they were
+func (db *DB) ListenStats(userID int, from, to time.Time, loc *time.Location, count int) (*ListenStats, error) {
+	q := db.Table("listens").Where("listens.user_id=? AND listens.aggregate=?", userID, false)
+	if !from.IsZero() {
+		q = q.Where("listens.time>=?", from)
+	}
+	if !to.IsZero() {
+		q = q.Where("listens.time<?", to)
+	}
+
+	var stats ListenStats
+	err := q.
+		Select("count(*), coalesce(sum(listens.length), 0), count(DISTINCT listens.track_id), count(DISTINCT listens.album_id)").
+		Row().
+		Scan(&stats.Listens, &stats.Length, &stats.Tracks, &stats.Albums)
+	if err != nil {
+		return nil, fmt.Errorf("count listens: %w", err)
+	}
+	err = q.
+		Joins("JOIN track_artists ON track_artists.track_id=listens.track_id").
+		Select("count(DISTINCT track_artists.artist_id)").
+		Row().
+		Scan(&stats.Artists)
+	if err != nil {
+		return nil, fmt.Errorf("count artists: %w", err)
+	}
+
+	artists := q.
+		Joins("JOIN track_artists ON track_artists.track_id=listens.track_id").
+		Joins("JOIN artists ON artists.id=track_artists.artist_id")
+	if stats.TopArtists, err = topListens(artists, "artists.id", "artists.name", "", count); err != nil {
+		return nil, fmt.Errorf("top artists: %w", err)
+	}
+	albums := q.
+		Joins("JOIN albums ON albums.id=listens.album_id")
+	if stats.TopAlbums, err = topListens(albums, "albums.id", "albums.tag_title", "", count); err != nil {
+		return nil, fmt.Errorf("top albums: %w", err)
+	}
+	tracks := q.
+		Joins("JOIN tracks ON tracks.id=listens.track_id")
+	if stats.TopTracks, err = topListens(tracks, "tracks.id", "tracks.tag_title", "tracks.tag_track_artist", count); err != nil {
+		return nil, fmt.Errorf("top tracks: %w", err)
+	}
+	genres := q.
+		Joins("JOIN track_genres ON track_genres.track_id=listens.track_id").
+		Joins("JOIN genres ON genres.id=track_genres.genre_id")
+	if stats.TopGenres, err = topListens(genres, "genres.id", "genres.name", "", count); err != nil {
+		return nil, fmt.Errorf("top genres: %w", err)
+	}
+
+	rows, err := q.
+		Select("listens.time, coalesce(listens.length, 0)").
+		Order("listens.time").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("days: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var listenTime time.Time
+		var length int
+		if err := rows.Scan(&listenTime, &length); err != nil {
+			return nil, fmt.Errorf("scan day: %w", err)
+		}
+		stats.Days = addListenPeriod(stats.Days, listenTime.In(loc).Format("2006-01-02"), length)
+		stats.Months = addListenPeriod(stats.Months, listenTime.In(loc).Format("2006-01"), length)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("days: %w", err)
+	}
+	for _, day := range stats.Days {
+		if stats.BusiestDay == nil || day.Length > stats.BusiestDay.Length {
+			stats.BusiestDay = day
+		}
+	}
+	return &stats, nil
+}
+
+// addListenPeriod adds a listen to the last of periods, or a new one if it's in a later period
+func addListenPeriod(periods []*ListenPeriod, period string, length int) []*ListenPeriod {
+	if n := len(periods); n == 0 || periods[n-1].Period != period {
+		periods = append(periods, &ListenPeriod{Period: period})
+	}
+	periods[len(periods)-1].Listens++
+	periods[len(periods)-1].Length += length
+	return periods
+}
+
+// topListens finds the most listened to of what q joins listens to, by its id and name columns, and its
+// artist column if it has one
+func topListens(q *gorm.DB, id, name, artist string, count int) ([]*ListenStat, error) {
+	group := fmt.Sprintf("%s, %s", id, name)
+	if artist != "" {
+		group += ", " + artist
+	} else {
+		artist = "''"
+	}
+	var stats []*ListenStat
+	err := q.
+		Select(fmt.Sprintf("%s id, %s name, %s artist, count(*) listens, coalesce(sum(listens.length), 0) length", id, name, artist)).
+		Group(group).
+		Order("listens DESC, length DESC, name").
+		Limit(count).
+		Scan(&stats).
+		Error
+	return stats, err
+}
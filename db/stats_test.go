@@ -0,0 +1,59 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenStatsDays(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	testDB, err := NewMock()
+	require.NoError(err)
+	t.Cleanup(func() { testDB.Close() })
+	require.NoError(testDB.Migrate(MigrationContext{}))
+
+	user := testDB.GetUserByName("admin")
+	require.NotNil(user)
+	album := Album{RootDir: "/music", LeftPath: "artist/", RightPath: "album"}
+	require.NoError(testDB.Create(&album).Error)
+
+	for _, listen := range []*Listen{
+		{Time: time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC), Length: 3600, Count: 12, Aggregate: true},
+		{Time: time.Date(2021, time.March, 1, 23, 10, 0, 0, time.UTC), Length: 100},
+		{Time: time.Date(2021, time.March, 2, 10, 0, 0, 0, time.UTC), Length: 200},
+	} {
+		listen.UserID = user.ID
+		listen.AlbumID = album.ID
+		require.NoError(testDB.Create(listen).Error)
+	}
+
+	// the aggregate isn't counted
+	stats, err := testDB.ListenStats(user.ID, time.Time{}, time.Time{}, time.UTC, 10)
+	require.NoError(err)
+	require.Equal(2, stats.Listens)
+	require.Equal(300, stats.Length)
+	require.Len(stats.TopAlbums, 1)
+	require.Equal(2, stats.TopAlbums[0].Listens)
+	require.Equal([]*ListenPeriod{{"2021-03-01", 1, 100}, {"2021-03-02", 1, 200}}, stats.Days)
+	require.Equal([]*ListenPeriod{{"2021-03", 2, 300}}, stats.Months)
+	require.Equal("2021-03-02", stats.BusiestDay.Period)
+
+	// 23:10 UTC is 01:10 the next day here
+	stats, err = testDB.ListenStats(user.ID, time.Time{}, time.Time{}, time.FixedZone("UTC+2", 2*60*60), 10)
+	require.NoError(err)
+	require.Equal([]*ListenPeriod{{"2021-03-02", 2, 300}}, stats.Days)
+	require.Equal("2021-03-02", stats.BusiestDay.Period)
+
+	// and the aggregate's last play isn't a listen in its year
+	from, to, err := ListenRange("2020", time.Now())
+	require.NoError(err)
+	stats, err = testDB.ListenStats(user.ID, from, to, time.UTC, 10)
+	require.NoError(err)
+	require.Zero(stats.Listens)
+	require.Empty(stats.Days)
+	require.Nil(stats.BusiestDay)
+}
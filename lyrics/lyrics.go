@@ -0,0 +1,111 @@
+// Package lyrics parses plain text and lrc formatted lyrics
+package lyrics
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Lyrics struct {
+	Lang   string        // from the [la:] tag, if any
+	Synced bool          // if every line has a start time
+	Offset time.Duration // from the [offset:] tag, to add to every line's start
+	Lines  []Line
+}
+
+type Line struct {
+	Start time.Duration // zero if the lyrics aren't synced
+	Value string
+}
+
+var (
+	expTimestamp = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+	expTag       = regexp.MustCompile(`^\[([a-zA-Z]+):(.*)\]$`)
+	expWordTime  = regexp.MustCompile(`<\d+:\d{1,2}(?:[.:]\d{1,3})?>`) // from enhanced lrc
+)
+
+// Parse parses lyrics, which are synced if any line has an lrc timestamp. lines
+// with more than one timestamp, like a repeated chorus, are repeated for each
+func Parse(text string) *Lyrics {
+	var lyrics Lyrics
+	var synced, unsynced []Line
+	for _, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		raw = strings.TrimSpace(raw)
+
+		var starts []time.Duration
+		for {
+			match := expTimestamp.FindStringSubmatch(raw)
+			if match == nil {
+				break
+			}
+			starts = append(starts, parseTimestamp(match[1], match[2], match[3]))
+			raw = raw[len(match[0]):]
+		}
+		if len(starts) > 0 {
+			value := strings.TrimSpace(expWordTime.ReplaceAllString(raw, ""))
+			for _, start := range starts {
+				synced = append(synced, Line{Start: start, Value: value})
+			}
+			continue
+		}
+
+		if match := expTag.FindStringSubmatch(raw); match != nil {
+			value := strings.TrimSpace(match[2])
+			switch strings.ToLower(match[1]) {
+			case "la", "lang":
+				lyrics.Lang = value
+			case "offset":
+				ms, _ := strconv.Atoi(value)
+				lyrics.Offset = time.Duration(ms) * time.Millisecond
+			}
+			continue
+		}
+		unsynced = append(unsynced, Line{Value: raw})
+	}
+
+	if len(synced) > 0 {
+		sort.SliceStable(synced, func(i, j int) bool { return synced[i].Start < synced[j].Start })
+		lyrics.Synced = true
+		lyrics.Lines = synced
+		return &lyrics
+	}
+	lyrics.Lines = trimBlankLines(unsynced)
+	return &lyrics
+}
+
+// String formats the lyrics as plain text, without any timestamps
+func (l *Lyrics) String() string {
+	values := make([]string, 0, len(l.Lines))
+	for _, line := range l.Lines {
+		values = append(values, line.Value)
+	}
+	return strings.Join(values, "\n")
+}
+
+func parseTimestamp(minutes, seconds, fraction string) time.Duration {
+	m, _ := strconv.Atoi(minutes)
+	s, _ := strconv.Atoi(seconds)
+	d := time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+	if fraction != "" {
+		// .5 is half a second, .05 is five hundredths, and .005 is five thousandths
+		f, _ := strconv.Atoi(fraction)
+		for i := len(fraction); i < 3; i++ {
+			f *= 10
+		}
+		d += time.Duration(f) * time.Millisecond
+	}
+	return d
+}
+
+func trimBlankLines(lines []Line) []Line {
+	for len(lines) > 0 && lines[0].Value == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1].Value == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,41 @@
+package lyrics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.senan.xyz/gonic/lyrics"
+)
+
+func TestParseSynced(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	l := lyrics.Parse("[ar:Artist]\r\n[la:eng]\n[offset:-250]\n[00:01.5]first\n[00:12.30][01:02.300]chorus <00:12.80>again\n[00:05:00]second\n")
+	require.True(l.Synced)
+	require.Equal("eng", l.Lang)
+	require.Equal(-250*time.Millisecond, l.Offset)
+	require.Equal([]lyrics.Line{
+		{Start: 1500 * time.Millisecond, Value: "first"},
+		{Start: 5 * time.Second, Value: "second"},
+		{Start: 12300 * time.Millisecond, Value: "chorus again"},
+		{Start: time.Minute + 2300*time.Millisecond, Value: "chorus again"},
+	}, l.Lines)
+	require.Equal("first\nsecond\nchorus again\nchorus again", l.String())
+}
+
+func TestParseUnsynced(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	l := lyrics.Parse("\nfirst line\n\nsecond verse\n\n")
+	require.False(l.Synced)
+	require.Equal("", l.Lang)
+	require.Equal([]lyrics.Line{
+		{Value: "first line"},
+		{Value: ""},
+		{Value: "second verse"},
+	}, l.Lines)
+	require.Equal("first line\n\nsecond verse", l.String())
+}
@@ -17,6 +17,27 @@ var supportedAudioTypes = map[string]string{
 	".opus": "audio/ogg",
 	".wma":  "audio/x-ms-wma",
 	".wav":  "audio/x-wav",
+	".aiff": "audio/x-aiff",
+	".aif":  "audio/x-aiff",
+	".ape":  "audio/x-ape",
+	".wv":   "audio/x-wavpack",
+	".tta":  "audio/x-tta",
+	".mka":  "audio/x-matroska",
+	".dsf":  "audio/x-dsf",
+	".dff":  "audio/x-dff",
+}
+
+// nonNativeAudioTypes are formats which browsers and most clients can't play, so they're transcoded
+// unless the client asks for the raw file
+var nonNativeAudioTypes = map[string]struct{}{
+	".aiff": {},
+	".aif":  {},
+	".ape":  {},
+	".wv":   {},
+	".tta":  {},
+	".mka":  {},
+	".dsf":  {},
+	".dff":  {},
 }
 
 //nolint:gochecknoinits
@@ -38,3 +59,8 @@ func TypeByAudioExtension(ext string) string {
 	}
 	return stdmime.TypeByExtension(ext)
 }
+
+func IsNativeAudioExtension(ext string) bool {
+	_, ok := nonNativeAudioTypes[strings.ToLower(ext)]
+	return !ok
+}
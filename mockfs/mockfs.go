@@ -7,12 +7,14 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/mattn/go-sqlite3"
 	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/playlist"
 	"go.senan.xyz/gonic/scanner"
 	"go.senan.xyz/gonic/scanner/tags"
 )
@@ -20,11 +22,12 @@ import (
 var ErrPathNotFound = errors.New("path not found")
 
 type MockFS struct {
-	t         testing.TB
-	scanner   *scanner.Scanner
-	dir       string
-	tagReader *tagReader
-	db        *db.DB
+	t             testing.TB
+	scanner       *scanner.Scanner
+	dir           string
+	tagReader     *tagReader
+	playlistStore *playlist.Store
+	db            *db.DB
 }
 
 func New(t testing.TB) *MockFS                        { return newMockFS(t, []string{""}, "") }
@@ -32,8 +35,21 @@ func NewWithDirs(t testing.TB, dirs []string) *MockFS { return newMockFS(t, dirs
 func NewWithExcludePattern(t testing.TB, excludePattern string) *MockFS {
 	return newMockFS(t, []string{""}, excludePattern)
 }
+func NewWithWorkers(t testing.TB, workers int) *MockFS {
+	return newMockFSWith(t, []string{""}, "", scanner.AlbumGroupingFolder, workers, 0)
+}
+func NewWithAlbumGrouping(t testing.TB, albumGrouping scanner.AlbumGrouping) *MockFS {
+	return newMockFSWith(t, []string{""}, "", albumGrouping, runtime.NumCPU(), 0)
+}
+func NewWithMissingGracePeriod(t testing.TB, missingGracePeriod time.Duration) *MockFS {
+	return newMockFSWith(t, []string{""}, "", scanner.AlbumGroupingFolder, runtime.NumCPU(), missingGracePeriod)
+}
 
 func newMockFS(t testing.TB, dirs []string, excludePattern string) *MockFS {
+	return newMockFSWith(t, dirs, excludePattern, scanner.AlbumGroupingFolder, runtime.NumCPU(), 0)
+}
+
+func newMockFSWith(t testing.TB, dirs []string, excludePattern string, albumGrouping scanner.AlbumGrouping, workers int, missingGracePeriod time.Duration) *MockFS {
 	dbc, err := db.NewMock()
 	if err != nil {
 		t.Fatalf("create db: %v", err)
@@ -64,22 +80,31 @@ func newMockFS(t testing.TB, dirs []string, excludePattern string) *MockFS {
 	multiValueSettings := map[scanner.Tag]scanner.MultiValueSetting{
 		scanner.Genre:       {Mode: scanner.Delim, Delim: ";"},
 		scanner.AlbumArtist: {Mode: scanner.Multi},
+		scanner.Artist:      {Mode: scanner.Multi},
+	}
+
+	playlistStore, err := playlist.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("create playlist store: %v", err)
 	}
 
 	tagReader := &tagReader{paths: map[string]*tagReaderResult{}}
-	scanner := scanner.New(absDirs, dbc, multiValueSettings, tagReader, excludePattern)
+	scanner := scanner.New(absDirs, dbc, multiValueSettings, tagReader, playlistStore, excludePattern, scanner.DefaultMultiDiscPattern, albumGrouping, workers, missingGracePeriod)
 
 	return &MockFS{
-		t:         t,
-		scanner:   scanner,
-		dir:       tmpDir,
-		tagReader: tagReader,
-		db:        dbc,
+		t:             t,
+		scanner:       scanner,
+		dir:           tmpDir,
+		tagReader:     tagReader,
+		playlistStore: playlistStore,
+		db:            dbc,
 	}
 }
 
-func (m *MockFS) DB() *db.DB     { return m.db }
-func (m *MockFS) TmpDir() string { return m.dir }
+func (m *MockFS) DB() *db.DB                     { return m.db }
+func (m *MockFS) TmpDir() string                 { return m.dir }
+func (m *MockFS) Scanner() *scanner.Scanner      { return m.scanner }
+func (m *MockFS) PlaylistStore() *playlist.Store { return m.playlistStore }
 
 func (m *MockFS) ScanAndClean() *scanner.Context {
 	ctx, err := m.scanner.ScanAndClean(scanner.ScanOptions{})
@@ -142,6 +167,11 @@ func (m *MockFS) addItems(prefix string, onlyGlob string, covers bool) {
 	}
 }
 
+// SetReadDelay makes every tag read take at least d, to simulate slow disks
+func (m *MockFS) SetReadDelay(d time.Duration) {
+	m.tagReader.delay = d
+}
+
 func (m *MockFS) NumTracks() int {
 	return len(m.tagReader.paths)
 }
@@ -153,6 +183,25 @@ func (m *MockFS) RemoveAll(path string) {
 	}
 }
 
+// Rename moves a track or folder, taking its tags with it
+func (m *MockFS) Rename(from, to string) {
+	absFrom := filepath.Join(m.dir, from)
+	absTo := filepath.Join(m.dir, to)
+	if err := os.MkdirAll(filepath.Dir(absTo), os.ModePerm); err != nil {
+		m.t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.Rename(absFrom, absTo); err != nil {
+		m.t.Fatalf("rename: %v", err)
+	}
+	for k, v := range m.tagReader.paths {
+		if k != absFrom && !strings.HasPrefix(k, absFrom+string(filepath.Separator)) {
+			continue
+		}
+		delete(m.tagReader.paths, k)
+		m.tagReader.paths[absTo+strings.TrimPrefix(k, absFrom)] = v
+	}
+}
+
 func (m *MockFS) Symlink(src, dest string) {
 	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
 		m.t.Fatalf("mkdir: %v", err)
@@ -284,6 +333,17 @@ func (m *MockFS) AddCover(path string) {
 	defer f.Close()
 }
 
+// WriteFile writes a non-audio file, like a .gonicignore
+func (m *MockFS) WriteFile(path string, data string) {
+	abspath := filepath.Join(m.dir, path)
+	if err := os.MkdirAll(filepath.Dir(abspath), os.ModePerm); err != nil {
+		m.t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(abspath, []byte(data), 0o600); err != nil {
+		m.t.Fatalf("write file: %v", err)
+	}
+}
+
 func (m *MockFS) SetTags(path string, cb func(*Tags) error) {
 	abspath := filepath.Join(m.dir, path)
 	if err := os.Chtimes(abspath, time.Time{}, time.Now()); err != nil {
@@ -293,12 +353,14 @@ func (m *MockFS) SetTags(path string, cb func(*Tags) error) {
 	if _, ok := r.paths[abspath]; !ok {
 		r.paths[abspath] = &tagReaderResult{tags: &Tags{}}
 	}
-	if err := cb(r.paths[abspath].tags); err != nil {
-		r.paths[abspath].err = err
-	}
+	r.paths[abspath].err = cb(r.paths[abspath].tags)
 }
 
 func (m *MockFS) DumpDB(suffix ...string) {
+	if m.db.IsPostgres() {
+		m.t.Fatalf("dumping is only supported with sqlite")
+	}
+
 	var p []string
 	p = append(p,
 		"gonic", "dump",
@@ -356,9 +418,11 @@ type tagReaderResult struct {
 
 type tagReader struct {
 	paths map[string]*tagReaderResult
+	delay time.Duration
 }
 
 func (m *tagReader) Read(abspath string) (tags.Parser, error) {
+	time.Sleep(m.delay)
 	p, ok := m.paths[abspath]
 	if !ok {
 		return nil, ErrPathNotFound
@@ -376,25 +440,102 @@ type Tags struct {
 	RawAlbumArtists []string
 	RawGenre        string
 
-	RawBitrate int
-	RawLength  int
+	RawBitrate    int
+	RawLength     int
+	RawSampleRate int
+	RawBitDepth   int
+	RawChannels   int
+
+	RawBrainzID string
+	RawPicture  []byte
+	RawLyrics   []string
+
+	RawReplayGainTrackGain float32
+	RawReplayGainTrackPeak float32
+	RawReplayGainAlbumGain float32
+	RawReplayGainAlbumPeak float32
+	RawR128TrackGain       int
+	RawR128AlbumGain       int
+
+	RawComposer      string
+	RawConductor     string
+	RawLyricist      string
+	RawLabel         string
+	RawCatalogNumber string
+	RawComment       string
+	RawBPM           int
+	RawCompilation   bool
+	RawReleaseTypes  []string
+	RawOriginalDate  string
+	RawDiscSubtitle  string
+
+	RawArtistBrainzIDs      []string
+	RawAlbumArtistBrainzIDs []string
+
+	RawArtists []string
+
+	RawTitleSort        string
+	RawAlbumSort        string
+	RawArtistSorts      []string
+	RawAlbumArtistSorts []string
 }
 
 func (m *Tags) Title() string          { return m.RawTitle }
-func (m *Tags) BrainzID() string       { return "" }
+func (m *Tags) BrainzID() string       { return m.RawBrainzID }
 func (m *Tags) Artist() string         { return m.RawArtist }
+func (m *Tags) Artists() []string      { return m.RawArtists }
 func (m *Tags) Album() string          { return m.RawAlbum }
 func (m *Tags) AlbumArtist() string    { return m.RawAlbumArtist }
 func (m *Tags) AlbumArtists() []string { return m.RawAlbumArtists }
 func (m *Tags) AlbumBrainzID() string  { return "" }
-func (m *Tags) Genre() string          { return m.RawGenre }
-func (m *Tags) Genres() []string       { return []string{m.RawGenre} }
-func (m *Tags) TrackNumber() int       { return 1 }
-func (m *Tags) DiscNumber() int        { return 1 }
-func (m *Tags) Year() int              { return 2021 }
-
-func (m *Tags) Length() int  { return firstInt(100, m.RawLength) }
-func (m *Tags) Bitrate() int { return firstInt(100, m.RawBitrate) }
+
+func (m *Tags) ArtistBrainzIDs() []string      { return m.RawArtistBrainzIDs }
+func (m *Tags) AlbumArtistBrainzIDs() []string { return m.RawAlbumArtistBrainzIDs }
+func (m *Tags) TitleSort() string              { return m.RawTitleSort }
+func (m *Tags) AlbumSort() string              { return m.RawAlbumSort }
+func (m *Tags) ArtistSorts() []string          { return m.RawArtistSorts }
+func (m *Tags) AlbumArtistSorts() []string     { return m.RawAlbumArtistSorts }
+func (m *Tags) Genre() string                  { return m.RawGenre }
+func (m *Tags) Genres() []string               { return []string{m.RawGenre} }
+func (m *Tags) TrackNumber() int               { return 1 }
+func (m *Tags) DiscNumber() int                { return 1 }
+func (m *Tags) Year() int                      { return 2021 }
+
+func (m *Tags) Picture() ([]byte, error) {
+	if len(m.RawPicture) == 0 {
+		return nil, tags.ErrNoPicture
+	}
+	return m.RawPicture, nil
+}
+
+func (m *Tags) HasPicture() bool { return len(m.RawPicture) > 0 }
+
+func (m *Tags) Lyrics() []string { return m.RawLyrics }
+
+func (m *Tags) Composer() string       { return m.RawComposer }
+func (m *Tags) Conductor() string      { return m.RawConductor }
+func (m *Tags) Lyricist() string       { return m.RawLyricist }
+func (m *Tags) Label() string          { return m.RawLabel }
+func (m *Tags) CatalogNumber() string  { return m.RawCatalogNumber }
+func (m *Tags) Comment() string        { return m.RawComment }
+func (m *Tags) BPM() int               { return m.RawBPM }
+func (m *Tags) Compilation() bool      { return m.RawCompilation }
+func (m *Tags) ReleaseTypes() []string { return m.RawReleaseTypes }
+func (m *Tags) OriginalDate() string   { return m.RawOriginalDate }
+func (m *Tags) DiscSubtitle() string   { return m.RawDiscSubtitle }
+
+func (m *Tags) ReplayGainTrackGain() float32 { return m.RawReplayGainTrackGain }
+func (m *Tags) ReplayGainTrackPeak() float32 { return m.RawReplayGainTrackPeak }
+func (m *Tags) ReplayGainAlbumGain() float32 { return m.RawReplayGainAlbumGain }
+func (m *Tags) ReplayGainAlbumPeak() float32 { return m.RawReplayGainAlbumPeak }
+func (m *Tags) R128TrackGain() int           { return m.RawR128TrackGain }
+func (m *Tags) R128AlbumGain() int           { return m.RawR128AlbumGain }
+
+func (m *Tags) Length() int     { return firstInt(100, m.RawLength) }
+func (m *Tags) Bitrate() int    { return firstInt(100, m.RawBitrate) }
+func (m *Tags) SampleRate() int { return m.RawSampleRate }
+func (m *Tags) BitDepth() int   { return m.RawBitDepth }
+func (m *Tags) Channels() int   { return m.RawChannels }
 
 var _ tags.Parser = (*Tags)(nil)
 
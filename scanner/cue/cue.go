@@ -0,0 +1,202 @@
+// Package cue parses cue sheets, which describe the tracks inside single file album rips
+package cue
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoFiles     = errors.New("no files")
+	ErrTrackNoFile = errors.New("track before file")
+	ErrBadIndex    = errors.New("bad index")
+)
+
+// framesPerSecond is the resolution of cue sheet timestamps, from the sectors of a CD
+const framesPerSecond = 75
+
+type Sheet struct {
+	Title      string
+	Performer  string
+	Songwriter string
+	Genre      string
+	Year       int
+	Files      []*File
+
+	ReplayGainGain float32 // from REM REPLAYGAIN_ALBUM_GAIN, in dB
+	ReplayGainPeak float32
+}
+
+type File struct {
+	Name   string
+	Tracks []*Track
+}
+
+type Track struct {
+	Number     int
+	Title      string
+	Performer  string
+	Songwriter string
+	Start      time.Duration // from INDEX 01, the start of the track in the file
+
+	ReplayGainGain float32 // from REM REPLAYGAIN_TRACK_GAIN, in dB
+	ReplayGainPeak float32
+}
+
+func Parse(r io.Reader) (*Sheet, error) {
+	var sheet Sheet
+	var file *File
+	var track *Track
+
+	sc := bufio.NewScanner(r)
+	for line := 0; sc.Scan(); line++ {
+		text := sc.Text()
+		if line == 0 {
+			text = strings.TrimPrefix(text, "\ufeff") // byte order mark
+		}
+		fields := splitFields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		command, args := strings.ToUpper(fields[0]), fields[1:]
+		arg := func(i int) string {
+			if i < len(args) {
+				return args[i]
+			}
+			return ""
+		}
+
+		switch command {
+		case "REM":
+			switch strings.ToUpper(arg(0)) {
+			case "GENRE":
+				sheet.Genre = arg(1)
+			case "DATE":
+				sheet.Year, _ = strconv.Atoi(arg(1))
+			case "REPLAYGAIN_ALBUM_GAIN":
+				sheet.ReplayGainGain = parseFloat(arg(1))
+			case "REPLAYGAIN_ALBUM_PEAK":
+				sheet.ReplayGainPeak = parseFloat(arg(1))
+			case "REPLAYGAIN_TRACK_GAIN":
+				if track != nil {
+					track.ReplayGainGain = parseFloat(arg(1))
+				}
+			case "REPLAYGAIN_TRACK_PEAK":
+				if track != nil {
+					track.ReplayGainPeak = parseFloat(arg(1))
+				}
+			}
+		case "TITLE":
+			if track != nil {
+				track.Title = arg(0)
+			} else {
+				sheet.Title = arg(0)
+			}
+		case "PERFORMER":
+			if track != nil {
+				track.Performer = arg(0)
+			} else {
+				sheet.Performer = arg(0)
+			}
+		case "SONGWRITER":
+			if track != nil {
+				track.Songwriter = arg(0)
+			} else {
+				sheet.Songwriter = arg(0)
+			}
+		case "FILE":
+			file = &File{Name: arg(0)}
+			track = nil
+			sheet.Files = append(sheet.Files, file)
+		case "TRACK":
+			if file == nil {
+				return nil, fmt.Errorf("line %d: %w", line+1, ErrTrackNoFile)
+			}
+			number, _ := strconv.Atoi(arg(0))
+			track = &Track{Number: number}
+			file.Tracks = append(file.Tracks, track)
+		case "INDEX":
+			if track == nil || arg(0) != "01" {
+				continue
+			}
+			start, err := parseTimestamp(arg(1))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line+1, err)
+			}
+			track.Start = start
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+	if len(sheet.Files) == 0 {
+		return nil, ErrNoFiles
+	}
+	return &sheet, nil
+}
+
+// End finds where a track stops, which is the start of the track after it. zero means the track
+// runs to the end of the file
+func (f *File) End(i int) time.Duration {
+	if i+1 < len(f.Tracks) {
+		return f.Tracks[i+1].Start
+	}
+	return 0
+}
+
+// parseTimestamp parses a mm:ss:ff timestamp, where ff is frames
+func parseTimestamp(in string) (time.Duration, error) {
+	parts := strings.Split(in, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("%q: %w", in, ErrBadIndex)
+	}
+	var nums [3]int
+	for i, part := range parts {
+		num, err := strconv.Atoi(part)
+		if err != nil || num < 0 {
+			return 0, fmt.Errorf("%q: %w", in, ErrBadIndex)
+		}
+		nums[i] = num
+	}
+	minutes, seconds, frames := nums[0], nums[1], nums[2]
+	return time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second +
+		time.Duration(frames)*time.Second/framesPerSecond, nil
+}
+
+func parseFloat(in string) float32 {
+	out, _ := strconv.ParseFloat(in, 32)
+	return float32(out)
+}
+
+// splitFields splits a line on spaces, keeping double quoted strings together
+func splitFields(line string) []string {
+	var fields []string
+	line = strings.TrimSpace(line)
+	for line != "" {
+		var field string
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				field, line = line[1:], ""
+			} else {
+				field, line = line[1:end+1], line[end+2:]
+			}
+		} else {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				field, line = line, ""
+			} else {
+				field, line = line[:end], line[end:]
+			}
+		}
+		fields = append(fields, field)
+		line = strings.TrimLeft(line, " \t")
+	}
+	return fields
+}
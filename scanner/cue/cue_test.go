@@ -0,0 +1,83 @@
+package cue_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.senan.xyz/gonic/scanner/cue"
+)
+
+func TestParse(t *testing.T) {
+	require := require.New(t)
+
+	sheet, err := cue.Parse(strings.NewReader("\ufeff" + `REM GENRE "Post Rock"
+REM DATE 1997
+REM REPLAYGAIN_ALBUM_GAIN -7.89 dB
+REM REPLAYGAIN_ALBUM_PEAK 0.988159
+PERFORMER "Some Artist"
+TITLE "Some Album"
+FILE "Some Artist - Some Album.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "First Track"
+    REM REPLAYGAIN_TRACK_GAIN -6.50 dB
+    REM REPLAYGAIN_TRACK_PEAK 0.912
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Second Track"
+    PERFORMER "Guest Artist"
+    SONGWRITER "Some Composer"
+    INDEX 00 04:10:50
+    INDEX 01 04:12:30
+  TRACK 03 AUDIO
+    TITLE Third
+    INDEX 01 09:00:74
+`))
+	require.NoError(err)
+
+	require.Equal("Some Album", sheet.Title)
+	require.Equal("Some Artist", sheet.Performer)
+	require.Equal("Post Rock", sheet.Genre)
+	require.Equal(1997, sheet.Year)
+	require.Equal(float32(-7.89), sheet.ReplayGainGain)
+	require.Equal(float32(0.988159), sheet.ReplayGainPeak)
+	require.Len(sheet.Files, 1)
+
+	file := sheet.Files[0]
+	require.Equal("Some Artist - Some Album.wav", file.Name)
+	require.Len(file.Tracks, 3)
+
+	require.Equal(1, file.Tracks[0].Number)
+	require.Equal("First Track", file.Tracks[0].Title)
+	require.Equal("", file.Tracks[0].Performer)
+	require.Equal(time.Duration(0), file.Tracks[0].Start)
+	require.Equal(float32(-6.5), file.Tracks[0].ReplayGainGain)
+	require.Equal(float32(0.912), file.Tracks[0].ReplayGainPeak)
+	require.Zero(file.Tracks[1].ReplayGainGain)
+
+	require.Equal(2, file.Tracks[1].Number)
+	require.Equal("Second Track", file.Tracks[1].Title)
+	require.Equal("Guest Artist", file.Tracks[1].Performer)
+	require.Equal("Some Composer", file.Tracks[1].Songwriter)
+	require.Equal(4*time.Minute+12*time.Second+400*time.Millisecond, file.Tracks[1].Start) // 30 of 75 frames
+
+	require.Equal("Third", file.Tracks[2].Title)
+
+	require.Equal(file.Tracks[1].Start, file.End(0))
+	require.Equal(file.Tracks[2].Start, file.End(1))
+	require.Equal(time.Duration(0), file.End(2)) // to the end of the file
+}
+
+func TestParseErrors(t *testing.T) {
+	require := require.New(t)
+
+	_, err := cue.Parse(strings.NewReader(`TITLE "No Files"`))
+	require.ErrorIs(err, cue.ErrNoFiles)
+
+	_, err = cue.Parse(strings.NewReader(`TRACK 01 AUDIO`))
+	require.ErrorIs(err, cue.ErrTrackNoFile)
+
+	_, err = cue.Parse(strings.NewReader("FILE \"a.flac\" WAVE\nTRACK 01 AUDIO\nINDEX 01 00:xx:00"))
+	require.ErrorIs(err, cue.ErrBadIndex)
+}
@@ -0,0 +1,50 @@
+package scanner
+
+import (
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// StartWatchForTest watches the music dirs like ExecuteWatch, but without waiting for events
+func (s *Scanner) StartWatchForTest(t testing.TB) {
+	t.Helper()
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatalf("create watcher: %v", err)
+	}
+	t.Cleanup(func() { watcher.Close() })
+	s.watcher = watcher
+	s.watchMusicDirs()
+}
+
+// WatchScanForTest is what the watcher does after seeing changes to scanned and removals of removed
+func (s *Scanner) WatchScanForTest(scanned, removed []string) {
+	scanList := map[string]struct{}{}
+	for _, absPath := range scanned {
+		scanList[absPath] = struct{}{}
+	}
+	removeList := map[string]struct{}{}
+	for _, absPath := range removed {
+		removeList[absPath] = struct{}{}
+	}
+	s.watchScan(scanList, removeList)
+}
+
+// WatchedForTest is the folders being watched, in order. they're the same in the watcher and watchMap
+func (s *Scanner) WatchedForTest(t testing.TB) []string {
+	t.Helper()
+	var watchMap []string
+	for absPath := range s.watchMap {
+		watchMap = append(watchMap, absPath)
+	}
+	sort.Strings(watchMap)
+	watched := s.watcher.WatchList()
+	sort.Strings(watched)
+	if !slices.Equal(watched, watchMap) {
+		t.Fatalf("watching %v, but the watch map has %v", watched, watchMap)
+	}
+	return watched
+}
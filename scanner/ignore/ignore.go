@@ -0,0 +1,205 @@
+// Package ignore matches paths against .gonicignore files, which use gitignore syntax and apply to
+// the folder they're in and everything under it
+package ignore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Filename is the name of the ignore file to look for in each folder
+const Filename = ".gonicignore"
+
+// Markers are files which exclude the folder they're in, and everything under it
+var Markers = []string{".nomedia"}
+
+type Rule struct {
+	File    string // the ignore file the rule is from
+	Line    int
+	Pattern string
+
+	base    string // the folder of File, which Pattern is relative to
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+func (r *Rule) String() string {
+	return fmt.Sprintf("%s:%d: %s", r.File, r.Line, r.Pattern)
+}
+
+// Parse reads the rules of an ignore file. file is the path of the file the rules are from, and
+// patterns are relative to its folder
+func Parse(r io.Reader, file string) ([]*Rule, error) {
+	var rules []*Rule
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		pattern := strings.TrimRight(sc.Text(), " \t\r")
+		if line == 1 {
+			pattern = strings.TrimPrefix(pattern, "\ufeff")
+		}
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		rule, err := newRule(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, line, err)
+		}
+		rule.File = file
+		rule.Line = line
+		rule.base = filepath.Dir(file)
+		rules = append(rules, rule)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func newRule(pattern string) (*Rule, error) {
+	rule := &Rule{Pattern: pattern}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasPrefix(pattern, `\`) {
+		pattern = pattern[1:] // for a literal leading "!" or "#"
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	// patterns with a slash anywhere but the end are relative to the ignore file, others match at any depth
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return nil, fmt.Errorf("empty pattern %q", rule.Pattern)
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**") && i+2 == len(pattern):
+			expr.WriteString(".*")
+			i++
+		case ch == '*':
+			expr.WriteString("[^/]*")
+		case ch == '?':
+			expr.WriteString("[^/]")
+		case ch == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case ch == '\\' && i+1 < len(pattern):
+			expr.WriteString(regexp.QuoteMeta(pattern[i+1 : i+2]))
+			i++
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	expr.WriteString("$")
+
+	var err error
+	if rule.re, err = regexp.Compile(expr.String()); err != nil {
+		return nil, fmt.Errorf("bad pattern %q: %w", rule.Pattern, err)
+	}
+	return rule, nil
+}
+
+// Matcher is the rules which apply in a folder, from its own ignore file and those of the folders above
+// it. a nil Matcher has no rules
+type Matcher struct {
+	rules []*Rule
+}
+
+// With is a copy of m with rules added. rules added later take precedence
+func (m *Matcher) With(rules ...*Rule) *Matcher {
+	if len(rules) == 0 {
+		return m
+	}
+	var parent []*Rule
+	if m != nil {
+		parent = m.rules
+	}
+	return &Matcher{rules: append(append([]*Rule{}, parent...), rules...)}
+}
+
+// Load is m with the rules of dir's ignore file, if it has one
+func (m *Matcher) Load(dir string) (*Matcher, error) {
+	path := filepath.Join(dir, Filename)
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules, err := Parse(file, path)
+	if err != nil {
+		return nil, err
+	}
+	return m.With(rules...), nil
+}
+
+// Match finds the rule which excludes absPath, or nil if it isn't excluded. like gitignore, the last
+// rule to match wins, so a later "!" rule can include a path again
+func (m *Matcher) Match(absPath string, isDir bool) *Rule {
+	if m == nil {
+		return nil
+	}
+	var match *Rule
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		relPath, err := filepath.Rel(rule.base, absPath)
+		if err != nil {
+			continue
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath == "." || relPath == ".." || strings.HasPrefix(relPath, "../") {
+			continue
+		}
+		if rule.re.MatchString(relPath) {
+			match = rule
+		}
+	}
+	if match == nil || match.negate {
+		return nil
+	}
+	return match
+}
+
+// Marker finds a marker file in dir, if it has one
+func Marker(dir string) (string, bool) {
+	for _, name := range Markers {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return filepath.Join(dir, name), true
+		}
+	}
+	return "", false
+}
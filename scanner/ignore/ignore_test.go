@@ -0,0 +1,91 @@
+package ignore_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.senan.xyz/gonic/scanner/ignore"
+)
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+
+	rules, err := ignore.Parse(strings.NewReader(`
+# comments and blank lines are skipped
+
+*.log
+/scans/
+live/**/bootleg*
+demos/**
+tmp?
+[Bb]onus*
+!bonus-keep*
+\#hash
+`), "/music/.gonicignore")
+	require.NoError(t, err)
+	m := (*ignore.Matcher)(nil).With(rules...)
+
+	tcases := []struct {
+		path     string
+		isDir    bool
+		expected string // the pattern which matches, if any
+	}{
+		{"/music/a/b/rip.log", false, "*.log"},
+		{"/music/rip.log", false, "*.log"},
+		{"/music/scans", true, "/scans/"},
+		{"/music/scans", false, ""},
+		{"/music/a/scans", true, ""},
+		{"/music/live/bootleg-1", true, "live/**/bootleg*"},
+		{"/music/live/1999/bootleg-1", true, "live/**/bootleg*"},
+		{"/music/a/live/bootleg-1", true, ""},
+		{"/music/demos/a/b", true, "demos/**"},
+		{"/music/demos", true, ""},
+		{"/music/tmp1", true, "tmp?"},
+		{"/music/tmp12", true, ""},
+		{"/music/a/Bonus Tracks", true, "[Bb]onus*"},
+		{"/music/a/bonus-keep", true, ""},
+		{"/music/#hash", false, `\#hash`},
+		{"/other/rip.log", false, ""},
+	}
+	for _, tcase := range tcases {
+		rule := m.Match(tcase.path, tcase.isDir)
+		if tcase.expected == "" {
+			require.Nil(t, rule, tcase.path)
+			continue
+		}
+		require.NotNil(t, rule, tcase.path)
+		require.Equal(t, tcase.expected, rule.Pattern, tcase.path)
+	}
+}
+
+func TestLoadScoped(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	dir := t.TempDir()
+	require.NoError(os.MkdirAll(filepath.Join(dir, "a", "b"), os.ModePerm))
+	require.NoError(os.WriteFile(filepath.Join(dir, ".gonicignore"), []byte("*.wav\n"), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(dir, "a", ".gonicignore"), []byte("!keep.wav\nextra\n"), 0o600))
+
+	root, err := (*ignore.Matcher)(nil).Load(dir)
+	require.NoError(err)
+	a, err := root.Load(filepath.Join(dir, "a"))
+	require.NoError(err)
+	b, err := a.Load(filepath.Join(dir, "a", "b"))
+	require.NoError(err)
+
+	require.NotNil(b.Match(filepath.Join(dir, "a", "b", "1.wav"), false))
+	require.Nil(b.Match(filepath.Join(dir, "a", "b", "keep.wav"), false))
+	require.NotNil(root.Match(filepath.Join(dir, "keep.wav"), false))
+
+	// rules of a subfolder don't apply above it
+	require.NotNil(a.Match(filepath.Join(dir, "a", "extra"), true))
+	require.Nil(root.Match(filepath.Join(dir, "extra"), true))
+
+	rule := b.Match(filepath.Join(dir, "a", "b", "extra"), true)
+	require.NotNil(rule)
+	require.Equal(filepath.Join(dir, "a", ".gonicignore")+":2: extra", rule.String())
+}
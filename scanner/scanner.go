@@ -1,16 +1,21 @@
 package scanner
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -21,12 +26,18 @@ import (
 	"go.senan.xyz/gonic/db"
 	"go.senan.xyz/gonic/mime"
 	"go.senan.xyz/gonic/multierr"
+	"go.senan.xyz/gonic/playlist"
+	"go.senan.xyz/gonic/scanner/cue"
+	"go.senan.xyz/gonic/scanner/ignore"
 	"go.senan.xyz/gonic/scanner/tags"
+	"go.senan.xyz/gonic/server/ctrlsubsonic/specid"
 )
 
 var (
 	ErrAlreadyScanning = errors.New("already scanning")
 	ErrReadingTags     = errors.New("could not read tags")
+	ErrNotInMusicDir   = errors.New("path is not in a music dir")
+	ErrNotCleaned      = errors.New("music dir not cleaned")
 )
 
 type Scanner struct {
@@ -34,25 +45,43 @@ type Scanner struct {
 	musicDirs          []string
 	multiValueSettings map[Tag]MultiValueSetting
 	tagger             tags.Reader
+	playlistStore      *playlist.Store // optional, to update the paths of moved tracks
 	excludePattern     *regexp.Regexp
+	multiDiscPattern   *regexp.Regexp
+	albumGrouping      AlbumGrouping
+	workers            int
+	missingGracePeriod time.Duration // to keep tracks and albums which aren't found, in case they come back
 	scanning           *int32
+	current            atomic.Pointer[Context] // the running scan, if any
 	watcher            *fsnotify.Watcher
 	watchMap           map[string]string // maps watched dirs back to root music dir
 	watchDone          chan bool
 }
 
-func New(musicDirs []string, db *db.DB, multiValueSettings map[Tag]MultiValueSetting, tagger tags.Reader, excludePattern string) *Scanner {
+func New(musicDirs []string, db *db.DB, multiValueSettings map[Tag]MultiValueSetting, tagger tags.Reader, playlistStore *playlist.Store, excludePattern string, multiDiscPattern string, albumGrouping AlbumGrouping, workers int, missingGracePeriod time.Duration) *Scanner {
 	var excludePatternRegExp *regexp.Regexp
 	if excludePattern != "" {
 		excludePatternRegExp = regexp.MustCompile(excludePattern)
 	}
+	var multiDiscPatternRegExp *regexp.Regexp
+	if multiDiscPattern != "" {
+		multiDiscPatternRegExp = regexp.MustCompile(multiDiscPattern)
+	}
+	if workers < 1 {
+		workers = 1
+	}
 
 	return &Scanner{
 		db:                 db,
 		musicDirs:          musicDirs,
 		multiValueSettings: multiValueSettings,
 		tagger:             tagger,
+		playlistStore:      playlistStore,
 		excludePattern:     excludePatternRegExp,
+		multiDiscPattern:   multiDiscPatternRegExp,
+		albumGrouping:      albumGrouping,
+		workers:            workers,
+		missingGracePeriod: missingGracePeriod,
 		scanning:           new(int32),
 		watchMap:           make(map[string]string),
 		watchDone:          make(chan bool),
@@ -69,8 +98,18 @@ func (s *Scanner) StopScanning() {
 	defer atomic.StoreInt32(s.scanning, 0)
 }
 
+// Progress returns a snapshot of the running scan. ok is false if there isn't one
+func (s *Scanner) Progress() (progress ScanProgress, ok bool) {
+	c := s.current.Load()
+	if c == nil {
+		return ScanProgress{}, false
+	}
+	return c.Progress(), true
+}
+
 type ScanOptions struct {
 	IsFull bool
+	Paths  []string // files or folders in the music dirs to scan, instead of all of them
 }
 
 func (s *Scanner) ScanAndClean(opts ScanOptions) (*Context, error) {
@@ -79,44 +118,52 @@ func (s *Scanner) ScanAndClean(opts ScanOptions) (*Context, error) {
 	}
 	defer s.StopScanning()
 
-	start := time.Now()
-	c := &Context{
-		errs:       &multierr.Err{},
-		seenTracks: map[int]struct{}{},
-		seenAlbums: map[int]struct{}{},
-		isFull:     opts.IsFull,
-	}
+	c := newContext(opts.IsFull)
+	s.current.Store(c)
+	defer s.current.Store(nil)
 
 	log.Println("starting scan")
 	defer func() {
 		log.Printf("finished scan in %s, +%d/%d tracks (%d err)\n",
-			durSince(start), c.SeenTracksNew(), c.SeenTracks(), c.errs.Len())
+			durSince(c.start), c.SeenTracksNew(), c.SeenTracks(), c.errs.Len())
 	}()
 
+	var roots []scanRoot
 	for _, dir := range s.musicDirs {
-		err := filepath.WalkDir(dir, func(absPath string, d fs.DirEntry, err error) error {
-			return s.scanCallback(c, dir, absPath, d, err)
-		})
-		if err != nil {
-			return nil, fmt.Errorf("walk: %w", err)
+		roots = append(roots, scanRoot{musicDir: dir, absPath: dir})
+	}
+	var cleanRoots []scanRoot // all of them if we're scanning everything
+	if len(opts.Paths) > 0 {
+		var err error
+		if roots, err = s.pathRoots(opts.Paths); err != nil {
+			return nil, err
 		}
+		cleanRoots = roots
+	}
+	if err := s.scan(c, roots...); err != nil {
+		return nil, fmt.Errorf("walk: %w", err)
 	}
 
-	if err := s.cleanTracks(c); err != nil {
-		return nil, fmt.Errorf("clean tracks: %w", err)
+	if err := s.clean(c, cleanRoots...); err != nil {
+		return nil, err
 	}
-	if err := s.cleanAlbums(c); err != nil {
-		return nil, fmt.Errorf("clean albums: %w", err)
+
+	if err := s.mergeAlbums(c); err != nil {
+		return nil, fmt.Errorf("merge albums: %w", err)
 	}
-	if err := s.cleanArtists(c); err != nil {
-		return nil, fmt.Errorf("clean artists: %w", err)
+
+	if err := s.updateSearchIndex(c); err != nil {
+		return nil, fmt.Errorf("update search index: %w", err)
 	}
-	if err := s.cleanGenres(c); err != nil {
-		return nil, fmt.Errorf("clean genres: %w", err)
+
+	if err := s.saveErrors(c, cleanRoots...); err != nil {
+		return nil, fmt.Errorf("save errors: %w", err)
 	}
 
-	if err := s.db.SetSetting("last_scan_time", strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
-		return nil, fmt.Errorf("set scan time: %w", err)
+	if len(opts.Paths) == 0 {
+		if err := s.db.SetSetting("last_scan_time", strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
+			return nil, fmt.Errorf("set scan time: %w", err)
+		}
 	}
 
 	if c.errs.Len() > 0 {
@@ -126,6 +173,46 @@ func (s *Scanner) ScanAndClean(opts ScanOptions) (*Context, error) {
 	return c, nil
 }
 
+// pathRoots finds the music dir of each of paths. a file's folder is scanned, since tracks are
+// scanned a folder at a time. a path which no longer exists is cleaned by scanning the closest folder
+// above it which does
+func (s *Scanner) pathRoots(paths []string) ([]scanRoot, error) {
+	var roots []scanRoot
+	for _, absPath := range paths {
+		absPath = filepath.Clean(absPath)
+		musicDir, err := s.MusicDir(absPath)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			stat, err := os.Stat(absPath)
+			if err == nil && !stat.IsDir() {
+				absPath = filepath.Dir(absPath)
+			}
+			if err == nil || absPath == musicDir {
+				break
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("stat %q: %w", absPath, err)
+			}
+			absPath = filepath.Dir(absPath)
+		}
+		roots = append(roots, scanRoot{musicDir: musicDir, absPath: absPath})
+	}
+	return roots, nil
+}
+
+// MusicDir finds the music dir which absPath is in, or ErrNotInMusicDir
+func (s *Scanner) MusicDir(absPath string) (string, error) {
+	absPath = filepath.Clean(absPath)
+	for _, dir := range s.musicDirs {
+		if absPath == dir || strings.HasPrefix(absPath, dir+string(filepath.Separator)) {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("%q: %w", absPath, ErrNotInMusicDir)
+}
+
 func (s *Scanner) ExecuteWatch() error {
 	var err error
 	s.watcher, err = fsnotify.NewWatcher()
@@ -140,58 +227,35 @@ func (s *Scanner) ExecuteWatch() error {
 		<-t.C
 	}
 
-	for _, dir := range s.musicDirs {
-		err := filepath.WalkDir(dir, func(absPath string, d fs.DirEntry, err error) error {
-			return s.watchCallback(dir, absPath, d, err)
-		})
-		if err != nil {
-			log.Printf("error watching directory tree: %v\n", err)
-		}
-	}
+	s.watchMusicDirs()
 
 	scanList := map[string]struct{}{}
+	removeList := map[string]struct{}{}
 	for {
 		select {
 		case <-t.C:
 			if !s.StartScanning() {
 				scanList = map[string]struct{}{}
+				removeList = map[string]struct{}{}
 				break
 			}
-			for dirName := range scanList {
-				c := &Context{
-					errs:       &multierr.Err{},
-					seenTracks: map[int]struct{}{},
-					seenAlbums: map[int]struct{}{},
-					isFull:     false,
-				}
-				musicDirName := s.watchMap[dirName]
-				if musicDirName == "" {
-					musicDirName = s.watchMap[filepath.Dir(dirName)]
-				}
-				err = filepath.WalkDir(dirName, func(absPath string, d fs.DirEntry, err error) error {
-					return s.watchCallback(musicDirName, absPath, d, err)
-				})
-				if err != nil {
-					log.Printf("error watching directory tree: %v\n", err)
-				}
-				err = filepath.WalkDir(dirName, func(absPath string, d fs.DirEntry, err error) error {
-					return s.scanCallback(c, musicDirName, absPath, d, err)
-				})
-				if err != nil {
-					log.Printf("error walking: %v", err)
-				}
-
-			}
+			s.watchScan(scanList, removeList)
 			scanList = map[string]struct{}{}
+			removeList = map[string]struct{}{}
 			s.StopScanning()
 		case event := <-s.watcher.Events:
 			var dirName string
-			if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) == 0 {
 				break
 			}
-			if len(scanList) == 0 {
+			if len(scanList) == 0 && len(removeList) == 0 {
 				t.Reset(10 * time.Second)
 			}
+			// a rename is seen as a remove here, and a create at the destination if it's also watched
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				removeList[event.Name] = struct{}{}
+				break
+			}
 			fileInfo, err := os.Stat(event.Name)
 			if err != nil {
 				break
@@ -210,6 +274,99 @@ func (s *Scanner) ExecuteWatch() error {
 	}
 }
 
+// watchMusicDirs watches every folder in the music dirs
+func (s *Scanner) watchMusicDirs() {
+	for _, dir := range s.musicDirs {
+		err := filepath.WalkDir(dir, func(absPath string, d fs.DirEntry, err error) error {
+			return s.watchCallback(dir, absPath, d, err)
+		})
+		if err != nil {
+			log.Printf("error watching directory tree: %v\n", err)
+		}
+	}
+}
+
+// watchScan rescans the folders in scanList, then cleans up whatever has gone from them and from
+// the removed paths in removeList. removed folders are no longer watched
+func (s *Scanner) watchScan(scanList, removeList map[string]struct{}) {
+	c := newContext(false)
+	s.current.Store(c)
+	defer s.current.Store(nil)
+
+	musicDirOf := func(absPath string) string {
+		if musicDir := s.watchMap[absPath]; musicDir != "" {
+			return musicDir
+		}
+		return s.watchMap[filepath.Dir(absPath)]
+	}
+
+	var scanRoots, cleanRoots []scanRoot
+	for removed := range removeList {
+		musicDir := musicDirOf(removed)
+		if musicDir == "" {
+			continue
+		}
+		if _, ok := s.watchMap[removed]; ok {
+			// it was a folder, everything under it has gone
+			s.unwatch(removed)
+			cleanRoots = append(cleanRoots, scanRoot{musicDir: musicDir, absPath: removed})
+			continue
+		}
+		scanList[filepath.Dir(removed)] = struct{}{}
+	}
+	for dirName := range scanList {
+		musicDirName := musicDirOf(dirName)
+		if musicDirName == "" {
+			continue
+		}
+		if _, err := os.Stat(dirName); err != nil {
+			continue
+		}
+		err := filepath.WalkDir(dirName, func(absPath string, d fs.DirEntry, err error) error {
+			return s.watchCallback(musicDirName, absPath, d, err)
+		})
+		if err != nil {
+			log.Printf("error watching directory tree: %v\n", err)
+		}
+		scanRoots = append(scanRoots, scanRoot{musicDir: musicDirName, absPath: dirName})
+	}
+	cleanRoots = append(cleanRoots, scanRoots...)
+	if len(cleanRoots) == 0 {
+		return
+	}
+
+	if err := s.scan(c, scanRoots...); err != nil {
+		log.Printf("error walking: %v", err)
+		return
+	}
+	if err := s.clean(c, cleanRoots...); err != nil {
+		log.Printf("error cleaning: %v", err)
+		return
+	}
+	if err := s.mergeAlbums(c); err != nil {
+		log.Printf("error merging albums: %v", err)
+		return
+	}
+	if err := s.updateSearchIndex(c); err != nil {
+		log.Printf("error updating search index: %v", err)
+		return
+	}
+	if err := s.saveErrors(c, cleanRoots...); err != nil {
+		log.Printf("error saving errors: %v", err)
+	}
+}
+
+// unwatch stops watching a folder and every folder under it
+func (s *Scanner) unwatch(absPath string) {
+	for watched := range s.watchMap {
+		if watched != absPath && !strings.HasPrefix(watched, absPath+string(filepath.Separator)) {
+			continue
+		}
+		delete(s.watchMap, watched)
+		_ = s.watcher.Remove(watched) // may have been removed already if the folder was deleted
+	}
+}
+
 func (s *Scanner) CancelWatch() {
 	s.watchDone <- true
 }
@@ -238,10 +395,9 @@ func (s *Scanner) watchCallback(dir string, absPath string, d fs.DirEntry, err e
 	return err
 }
 
-func (s *Scanner) scanCallback(c *Context, dir string, absPath string, d fs.DirEntry, err error) error {
+func (s *Scanner) scanCallback(q *scanQueue, dir string, absPath string, d fs.DirEntry, err error) error {
 	if err != nil {
-		c.errs.Add(err)
-		return nil
+		return q.push(&scanDirJob{err: err})
 	}
 	if dir == absPath {
 		return nil
@@ -253,169 +409,826 @@ func (s *Scanner) scanCallback(c *Context, dir string, absPath string, d fs.DirE
 		eval, _ := filepath.EvalSymlinks(absPath)
 		return filepath.WalkDir(eval, func(subAbs string, d fs.DirEntry, err error) error {
 			subAbs = strings.Replace(subAbs, eval, absPath, 1)
-			return s.scanCallback(c, dir, subAbs, d, err)
+			return s.scanCallback(q, dir, subAbs, d, err)
 		})
 	default:
 		return nil
 	}
 
 	if s.excludePattern != nil && s.excludePattern.MatchString(absPath) {
-		log.Printf("excluding folder `%s`", absPath)
+		q.c.addExcluded(absPath, s.excludeRule())
 		return nil
 	}
 
-	log.Printf("processing folder `%s`", absPath)
+	// a folder skipped by a .gonicignore or marker file is skipped along with everything under it
+	parentRules, err := q.ignoreRules(dir, filepath.Dir(absPath))
+	if err != nil {
+		if err := q.push(&scanDirJob{err: err}); err != nil {
+			return err
+		}
+	}
+	if rule := parentRules.Match(absPath, true); rule != nil {
+		q.c.addExcluded(absPath, rule.String())
+		return filepath.SkipDir
+	}
+	if marker, ok := ignore.Marker(absPath); ok {
+		q.c.addExcluded(absPath, fmt.Sprintf("marker file %s", marker))
+		return filepath.SkipDir
+	}
+	rules, err := q.ignoreRules(dir, absPath)
+	if err != nil {
+		if err := q.push(&scanDirJob{err: err}); err != nil {
+			return err
+		}
+	}
+
+	return q.push(&scanDirJob{musicDir: dir, absPath: absPath, ignore: rules})
+}
 
-	tx := s.db.Begin()
-	if err := s.scanDir(tx, c, dir, absPath); err != nil {
-		c.errs.Add(fmt.Errorf("%q: %w", absPath, err))
-		tx.Rollback()
-		return nil
+func (s *Scanner) excludeRule() string {
+	return fmt.Sprintf("exclude pattern %s", s.excludePattern)
+}
+
+type scanRoot struct {
+	musicDir string
+	absPath  string
+}
+
+// scanDirJob is a single folder to scan. it's walked in order, read by any of the workers,
+// then written to the db by a single writer in the order it was walked
+type scanDirJob struct {
+	musicDir string
+	absPath  string
+	ignore   *ignore.Matcher // the .gonicignore rules for files in the folder
+	cover    string
+	tracks   []*scanTrack
+	excluded []Exclusion
+	err      error
+	done     chan struct{}
+}
+
+type scanTrack struct {
+	basename string
+	modTime  time.Time
+	size     int
+	hash     string
+	trags    tags.Parser // nil if the track hasn't changed since the last scan
+	cue      *scanCue    // set if the file is split into many tracks by a cue sheet
+	picture  bool        // if the file has an embedded picture. only checked for an album's first track
+
+	lyricsFiles []string // sidecar .lrc or .txt files with the same name as the track
+	lyrics      []*db.TrackLyrics
+}
+
+type scanCue struct {
+	sheet *cue.Sheet
+	file  *cue.File
+	index int
+}
+
+func (sc *scanCue) track() *cue.Track { return sc.file.Tracks[sc.index] }
+
+type scanQueue struct {
+	c       *Context
+	jobs    chan *scanDirJob // to the workers
+	ordered chan *scanDirJob // to the writer
+	quit    chan struct{}
+
+	ignores map[string]*ignore.Matcher // by folder, only used by the walker
+}
+
+// ignoreRules finds the .gonicignore rules which apply in dir, from its own file and those of the
+// folders above it up to musicDir. an ignore file which can't be read is reported once, then skipped
+func (q *scanQueue) ignoreRules(musicDir, dir string) (*ignore.Matcher, error) {
+	if rules, ok := q.ignores[dir]; ok {
+		return rules, nil
 	}
-	if err := tx.Commit().Error; err != nil {
-		return fmt.Errorf("commit tx: %w", err)
+	var parent *ignore.Matcher
+	var parentErr error
+	if dir != musicDir && strings.HasPrefix(dir, musicDir) {
+		parent, parentErr = q.ignoreRules(musicDir, filepath.Dir(dir))
+	}
+	rules, err := parent.Load(dir)
+	if err != nil {
+		rules = parent
+		err = newScanError(filepath.Join(dir, ignore.Filename), db.ScanErrorKindFile, err)
+	}
+	q.ignores[dir] = rules
+	if parentErr != nil {
+		return rules, parentErr
 	}
+	return rules, err
+}
 
+func (q *scanQueue) push(job *scanDirJob) error {
+	job.done = make(chan struct{})
+	if job.err != nil {
+		close(job.done)
+	}
+	select {
+	case q.ordered <- job:
+	case <-q.quit:
+		return filepath.SkipAll
+	}
+	if job.err != nil {
+		return nil
+	}
+	q.c.addDirFound()
+	select {
+	case q.jobs <- job:
+	case <-q.quit:
+		return filepath.SkipAll
+	}
 	return nil
 }
 
-func (s *Scanner) scanDir(tx *db.DB, c *Context, musicDir string, absPath string) error {
-	items, err := os.ReadDir(absPath)
+// scan walks the roots and reads tags with s.workers workers. the results are written by a
+// single writer one folder per transaction, in walk order, so the resulting rows and IDs are the
+// same as if the folders were scanned one at a time. all Context bookkeeping happens in the writer
+func (s *Scanner) scan(c *Context, roots ...scanRoot) error {
+	q := &scanQueue{
+		c:       c,
+		jobs:    make(chan *scanDirJob),
+		ordered: make(chan *scanDirJob, s.workers*4),
+		quit:    make(chan struct{}),
+		ignores: map[string]*ignore.Matcher{},
+	}
+
+	go func() {
+		defer close(q.ordered)
+		defer close(q.jobs)
+		for _, root := range roots {
+			err := filepath.WalkDir(root.absPath, func(absPath string, d fs.DirEntry, err error) error {
+				return s.scanCallback(q, root.musicDir, absPath, d, err)
+			})
+			if errors.Is(err, filepath.SkipAll) {
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range q.jobs {
+				if err := s.readDir(job, c.isFull); err != nil {
+					job.err = newScanError(job.absPath, db.ScanErrorKindFolder, err)
+				}
+				close(job.done)
+			}
+		}()
+	}
+
+	var err error
+	for job := range q.ordered {
+		c.setCurrentDir(job.absPath)
+		<-job.done
+		if err = s.writeDir(c, job); err != nil {
+			close(q.quit)
+			break
+		}
+	}
+	for range q.ordered {
+		// drain the walker if we quit early
+	}
+	wg.Wait()
+
+	return err
+}
+
+// readDir finds the cover and tracks in a folder, and reads the tags of tracks which are new or have
+// changed since the last scan. it's called concurrently by the workers, so it only reads from the db
+func (s *Scanner) readDir(job *scanDirJob, isFull bool) error {
+	items, err := os.ReadDir(job.absPath)
 	if err != nil {
 		return err
 	}
 
-	var tracks []string
-	var cover string
+	var basenames, cueBasenames []string
+	lyricsFiles := map[string][]string{}     // sidecar lyrics by the stem of the track they're for
+	lyricsModTimes := map[string]time.Time{} // and when they were last changed
 	for _, item := range items {
-		fullpath := filepath.Join(absPath, item.Name())
+		fullpath := filepath.Join(job.absPath, item.Name())
 		if s.excludePattern != nil && s.excludePattern.MatchString(fullpath) {
-			log.Printf("excluding path `%s`", fullpath)
+			job.excluded = append(job.excluded, Exclusion{fullpath, s.excludeRule()})
+			continue
+		}
+		if rule := job.ignore.Match(fullpath, item.IsDir()); rule != nil && !item.IsDir() {
+			job.excluded = append(job.excluded, Exclusion{fullpath, rule.String()})
 			continue
 		}
 
 		if isCover(item.Name()) {
-			cover = item.Name()
+			job.cover = item.Name()
 			continue
 		}
 		if mime := mime.TypeByAudioExtension(filepath.Ext(item.Name())); mime != "" {
-			tracks = append(tracks, item.Name())
+			basenames = append(basenames, item.Name())
+			continue
+		}
+		if isCueSheet(item.Name()) {
+			cueBasenames = append(cueBasenames, item.Name())
+			continue
+		}
+		if isLyrics(item.Name()) {
+			info, err := item.Info()
+			if err != nil {
+				return fmt.Errorf("stating %q: %w", item.Name(), err)
+			}
+			if info.Size() == 0 {
+				continue
+			}
+			stem := strings.TrimSuffix(item.Name(), filepath.Ext(item.Name()))
+			lyricsFiles[stem] = append(lyricsFiles[stem], item.Name())
+			if info.ModTime().After(lyricsModTimes[stem]) {
+				lyricsModTimes[stem] = info.ModTime()
+			}
 			continue
 		}
 	}
-
-	relPath, _ := filepath.Rel(musicDir, absPath)
-	pdir, pbasename := filepath.Split(filepath.Dir(relPath))
-	var parent db.Album
-	if err := tx.Where("root_dir=? AND left_path=? AND right_path=?", musicDir, pdir, pbasename).Assign(db.Album{RootDir: musicDir, LeftPath: pdir, RightPath: pbasename}).FirstOrCreate(&parent).Error; err != nil {
-		return fmt.Errorf("first or create parent: %w", err)
+	if len(basenames) == 0 {
+		return nil
 	}
 
-	c.seenAlbums[parent.ID] = struct{}{}
+	sort.Strings(basenames)
+	sort.Strings(cueBasenames)
+	cues, cuesModTime := readCueSheets(job.absPath, cueBasenames, basenames)
 
+	relPath, _ := filepath.Rel(job.musicDir, job.absPath)
 	dir, basename := filepath.Split(relPath)
-	var album db.Album
-	if err := populateAlbumBasics(tx, musicDir, &parent, &album, dir, basename, cover); err != nil {
-		return fmt.Errorf("populate album basics: %w", err)
+	var prevTracks []*db.Track
+	err = s.db.
+		Select("tracks.filename, tracks.cue_track, tracks.updated_at").
+		Joins("JOIN albums ON albums.id=tracks.album_id").
+		Where("albums.root_dir=? AND albums.left_path=? AND albums.right_path=?", job.musicDir, dir, basename).
+		Find(&prevTracks).
+		Error
+	if err != nil {
+		return fmt.Errorf("find previous tracks: %w", err)
+	}
+	type trackKey struct {
+		filename string
+		cueTrack int
+	}
+	prevUpdated := make(map[trackKey]time.Time, len(prevTracks))
+	for _, track := range prevTracks {
+		prevUpdated[trackKey{track.Filename, track.CueTrack}] = track.UpdatedAt
+	}
+	prevLyricsFiles, err := s.sidecarLyricsSources(job.musicDir, dir, basename)
+	if err != nil {
+		return fmt.Errorf("find previous lyrics: %w", err)
 	}
 
-	c.seenAlbums[album.ID] = struct{}{}
+	for _, basename := range basenames {
+		absPath := filepath.Join(job.absPath, basename)
+		stat, err := os.Stat(absPath)
+		if err != nil {
+			return fmt.Errorf("stating %q: %w", basename, err)
+		}
+
+		// a file split by a cue sheet becomes one track for each in the sheet, all sharing the file's tags
+		var tracks []*scanTrack
+		modTime := stat.ModTime()
+		if sc, ok := cues[basename]; ok {
+			if cuesModTime.After(modTime) {
+				modTime = cuesModTime
+			}
+			for i := range sc.file.Tracks {
+				tracks = append(tracks, &scanTrack{basename: basename, modTime: modTime, size: int(stat.Size()), cue: &scanCue{sc.sheet, sc.file, i}})
+			}
+		} else {
+			stem := strings.TrimSuffix(basename, filepath.Ext(basename))
+			if lyricsModTimes[stem].After(modTime) {
+				modTime = lyricsModTimes[stem]
+			}
+			tracks = append(tracks, &scanTrack{basename: basename, modTime: modTime, size: int(stat.Size()), lyricsFiles: lyricsFiles[stem]})
+		}
+		job.tracks = append(job.tracks, tracks...)
+
+		var changed bool
+		for _, track := range tracks {
+			var cueTrack int
+			if track.cue != nil {
+				cueTrack = track.cue.track().Number
+			}
+			if updatedAt, ok := prevUpdated[trackKey{basename, cueTrack}]; isFull || !ok || !modTime.Before(updatedAt) {
+				changed = true
+			}
+			// a sidecar which was removed has no mod time to go by, nor one copied in with an old one
+			if track.cue == nil && !slices.Equal(track.lyricsFiles, prevLyricsFiles[basename]) {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
 
-	sort.Strings(tracks)
-	for i, basename := range tracks {
-		absPath := filepath.Join(musicDir, relPath, basename)
-		if err := s.populateTrackAndAlbumArtists(tx, c, i, &album, basename, absPath); err != nil {
-			return fmt.Errorf("populate track %q: %w", basename, err)
+		if err := s.readTrack(tracks[0], absPath); err != nil {
+			return fmt.Errorf("read track %q: %w", basename, err)
+		}
+		for _, track := range tracks[1:] {
+			track.trags = tracks[0].trags
+			track.hash = tracks[0].hash
 		}
 	}
 
+	// the album's embedded cover is checked along with its first track, since that's when the album is updated
+	if first := job.tracks[0]; first.trags != nil {
+		first.picture = first.trags.HasPicture()
+	}
+
 	return nil
 }
 
-func (s *Scanner) populateTrackAndAlbumArtists(tx *db.DB, c *Context, i int, album *db.Album, basename string, absPath string) error {
-	stat, err := os.Stat(absPath)
-	if err != nil {
-		return fmt.Errorf("stating %q: %w", basename, err)
+// readCueSheets finds which audio files in a folder are split by cue sheets. sheets which can't
+// be read are logged and skipped, so that their files are still scanned as single tracks
+func readCueSheets(absPath string, cueBasenames []string, basenames []string) (map[string]*scanCue, time.Time) {
+	cues := map[string]*scanCue{}
+	var modTime time.Time
+	for _, cueBasename := range cueBasenames {
+		sheet, stat, err := readCueSheet(filepath.Join(absPath, cueBasename))
+		if err != nil {
+			log.Printf("error reading cue sheet %q: %v", filepath.Join(absPath, cueBasename), err)
+			continue
+		}
+		if stat.ModTime().After(modTime) {
+			modTime = stat.ModTime()
+		}
+		for _, file := range sheet.Files {
+			basename := cueFileBasename(file.Name, basenames)
+			if basename == "" || !splitsFile(file) {
+				continue
+			}
+			cues[basename] = &scanCue{sheet: sheet, file: file}
+		}
 	}
+	return cues, modTime
+}
 
-	var track db.Track
-	if err := tx.Where("album_id=? AND filename=?", album.ID, filepath.Base(basename)).First(&track).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return fmt.Errorf("query track: %w", err)
+// splitsFile is if a cue sheet's file is really split into tracks. sheets like EAC's "one file per track"
+// ones have a FILE for each track, which are already tracks of their own with their own tags
+func splitsFile(file *cue.File) bool {
+	switch len(file.Tracks) {
+	case 0:
+		return false
+	case 1:
+		return file.Tracks[0].Start > 0
+	default:
+		return true
 	}
+}
 
-	if !c.isFull && track.ID != 0 && stat.ModTime().Before(track.UpdatedAt) {
-		c.seenTracks[track.ID] = struct{}{}
-		return nil
+func readCueSheet(absPath string) (*cue.Sheet, fs.FileInfo, error) {
+	f, err := os.Open(absPath)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	trags, err := s.tagger.Read(absPath)
+	defer f.Close()
+	stat, err := f.Stat()
 	if err != nil {
-		return fmt.Errorf("%v: %w", err, ErrReadingTags)
+		return nil, nil, err
 	}
-
-	genreNames := parseMulti(trags, s.multiValueSettings[Genre], tags.MustGenres, tags.MustGenre)
-	genreIDs, err := populateGenres(tx, genreNames)
+	sheet, err := cue.Parse(f)
 	if err != nil {
-		return fmt.Errorf("populate genres: %w", err)
+		return nil, nil, err
 	}
+	return sheet, stat, nil
+}
 
-	// metadata for the album table comes only from the the first track's tags
-	if i == 0 {
-		albumArtistNames := parseMulti(trags, s.multiValueSettings[AlbumArtist], tags.MustAlbumArtists, tags.MustAlbumArtist)
-		var albumArtistIDs []int
-		for _, albumArtistName := range albumArtistNames {
-			albumArtist, err := populateArtist(tx, albumArtistName)
-			if err != nil {
-				return fmt.Errorf("populate album artist: %w", err)
-			}
-			albumArtistIDs = append(albumArtistIDs, albumArtist.ID)
-		}
-		if err := populateAlbumArtists(tx, album, albumArtistIDs); err != nil {
-			return fmt.Errorf("populate album artists: %w", err)
-		}
-
-		if err := populateAlbum(tx, album, trags, stat.ModTime()); err != nil {
-			return fmt.Errorf("populate album: %w", err)
+// cueFileBasename finds the audio file a cue sheet refers to. sheets often name the file they were ripped
+// to, like "album.wav", even though it was later converted. so without an exact match, try the stem
+func cueFileBasename(name string, basenames []string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/")) // windows paths
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	var match string
+	for _, basename := range basenames {
+		if basename == name {
+			return basename
 		}
-
-		if err := populateAlbumGenres(tx, album, genreIDs); err != nil {
-			return fmt.Errorf("populate album genres: %w", err)
+		if match == "" && strings.TrimSuffix(basename, filepath.Ext(basename)) == stem {
+			match = basename
 		}
 	}
+	return match
+}
 
-	if err := populateTrack(tx, album, &track, trags, basename, int(stat.Size())); err != nil {
-		return fmt.Errorf("process %q: %w", basename, err)
+func (s *Scanner) readTrack(st *scanTrack, absPath string) error {
+	trags, err := s.tagger.Read(absPath)
+	if err != nil {
+		return &scanError{absPath, db.ScanErrorKindTags, fmt.Errorf("%v: %w", err, ErrReadingTags)}
 	}
-	if err := populateTrackGenres(tx, &track, genreIDs); err != nil {
-		return fmt.Errorf("populate track genres: %w", err)
+	hash, err := hashFile(absPath, int64(st.size))
+	if err != nil {
+		return &scanError{absPath, db.ScanErrorKindFile, fmt.Errorf("hash: %w", err)}
 	}
+	st.trags = trags
+	st.hash = hash
 
-	c.seenTracks[track.ID] = struct{}{}
-	c.seenTracksNew++
-
+	// lyrics are for the whole file, so they don't mean much for tracks split from it by a cue sheet
+	if st.cue == nil {
+		st.lyrics, err = readLyrics(trags, filepath.Dir(absPath), st.lyricsFiles)
+		if err != nil {
+			return &scanError{absPath, db.ScanErrorKindFile, fmt.Errorf("lyrics: %w", err)}
+		}
+	}
 	return nil
 }
 
-func populateAlbum(tx *db.DB, album *db.Album, trags tags.Parser, modTime time.Time) error {
-	albumName := tags.MustAlbum(trags)
-	album.TagTitle = albumName
-	album.TagTitleUDec = decoded(albumName)
-	album.TagBrainzID = trags.AlbumBrainzID()
-	album.TagYear = trags.Year()
-
-	album.ModifiedAt = modTime
-	album.CreatedAt = modTime
+// sidecarLyricsSources finds the sidecar lyrics files the tracks of a folder were last read with, by track filename
+func (s *Scanner) sidecarLyricsSources(musicDir, leftPath, rightPath string) (map[string][]string, error) {
+	rows, err := s.db.
+		Model(db.TrackLyrics{}).
+		Select("tracks.filename, track_lyrics.source").
+		Joins("JOIN tracks ON tracks.id=track_lyrics.track_id").
+		Joins("JOIN albums ON albums.id=tracks.album_id").
+		Where("albums.root_dir=? AND albums.left_path=? AND albums.right_path=?", musicDir, leftPath, rightPath).
+		Where("track_lyrics.source IS NOT NULL AND track_lyrics.source != ''").
+		Order("track_lyrics.source").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	if err := tx.Save(&album).Error; err != nil {
-		return fmt.Errorf("saving album: %w", err)
+	sources := map[string][]string{}
+	for rows.Next() {
+		var filename, source string
+		if err := rows.Scan(&filename, &source); err != nil {
+			return nil, err
+		}
+		sources[filename] = append(sources[filename], source)
 	}
+	return sources, rows.Err()
+}
 
-	return nil
+func readLyrics(trags tags.Parser, dir string, lyricsFiles []string) ([]*db.TrackLyrics, error) {
+	var lyrics []*db.TrackLyrics
+	for _, basename := range lyricsFiles {
+		text, err := os.ReadFile(filepath.Join(dir, basename))
+		if err != nil {
+			return nil, fmt.Errorf("read %q: %w", basename, err)
+		}
+		// a blank file is kept too, so the next scan sees it was read. it's skipped when serving lyrics
+		lyrics = append(lyrics, &db.TrackLyrics{Source: basename, Text: string(text)})
+	}
+	for _, text := range trags.Lyrics() {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		lyrics = append(lyrics, &db.TrackLyrics{Text: text})
+	}
+	return lyrics, nil
 }
 
-func populateAlbumBasics(tx *db.DB, musicDir string, parent, album *db.Album, dir, basename string, cover string) error {
-	if err := tx.Where("root_dir=? AND left_path=? AND right_path=?", musicDir, dir, basename).First(album).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return fmt.Errorf("find album: %w", err)
+// hashFile hashes the start and end of a file. along with the size, it's enough to match a moved
+// file to its old self without reading the whole thing
+func hashFile(absPath string, size int64) (string, error) {
+	const chunkSize = 64 * 1024
+	f, err := os.Open(absPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, chunkSize); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if size > 2*chunkSize {
+		if _, err := f.Seek(-chunkSize, io.SeekEnd); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (s *Scanner) writeDir(c *Context, job *scanDirJob) error {
+	defer c.updateProgress(job)
+
+	if job.err != nil {
+		c.errs.Add(job.err)
+		return nil
+	}
+	for _, excl := range job.excluded {
+		c.addExcluded(excl.Path, excl.Rule)
+	}
+
+	log.Printf("processing folder `%s`", job.absPath)
+
+	tx := s.db.Begin()
+	if err := s.scanDir(tx, c, job); err != nil {
+		c.errs.Add(newScanError(job.absPath, db.ScanErrorKindWrite, err))
+		tx.Rollback()
+		return nil
+	}
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+
+	return nil
+}
+
+// scanError is an error scanning a file or folder. they're saved after the scan, so they can be found later
+type scanError struct {
+	absPath string
+	kind    db.ScanErrorKind
+	err     error
+}
+
+func (e *scanError) Error() string { return fmt.Sprintf("%q: %v", e.absPath, e.err) }
+func (e *scanError) Unwrap() error { return e.err }
+
+// newScanError wraps err with the path it happened at, unless it already knows a more specific one
+func newScanError(absPath string, kind db.ScanErrorKind, err error) error {
+	var serr *scanError
+	if errors.As(err, &serr) {
+		return serr
+	}
+	return &scanError{absPath, kind, err}
+}
+
+// saveErrors replaces the errors saved for paths at or under roots, or all of them if no roots are
+// provided, with the ones from this scan
+func (s *Scanner) saveErrors(c *Context, roots ...scanRoot) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if len(roots) == 0 {
+			if err := tx.Delete(db.ScanError{}).Error; err != nil {
+				return fmt.Errorf("delete old: %w", err)
+			}
+		}
+		for _, root := range roots {
+			prefix := root.absPath + string(filepath.Separator)
+			err := tx.
+				Where("path=? OR substr(path, 1, length(?))=?", root.absPath, prefix, prefix).
+				Delete(db.ScanError{}).
+				Error
+			if err != nil {
+				return fmt.Errorf("delete old: %w", err)
+			}
+		}
+		for _, err := range c.errs.Errors() {
+			var serr *scanError
+			if !errors.As(err, &serr) {
+				continue
+			}
+			scanErr := db.ScanError{ScanTime: c.start, Path: serr.absPath, Kind: serr.kind, Message: serr.err.Error()}
+			if err := tx.Create(&scanErr).Error; err != nil {
+				return fmt.Errorf("create: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Scanner) scanDir(tx *db.DB, c *Context, job *scanDirJob) error {
+	musicDir := job.musicDir
+	relPath, _ := filepath.Rel(musicDir, job.absPath)
+	pdir, pbasename := filepath.Split(filepath.Dir(relPath))
+	var parent db.Album
+	if err := tx.Where("root_dir=? AND left_path=? AND right_path=? AND tag_group=''", musicDir, pdir, pbasename).Assign(db.Album{RootDir: musicDir, LeftPath: pdir, RightPath: pbasename}).FirstOrCreate(&parent).Error; err != nil {
+		return fmt.Errorf("first or create parent: %w", err)
+	}
+
+	c.seenAlbums[parent.ID] = struct{}{}
+
+	dir, basename := filepath.Split(relPath)
+	var album db.Album
+	if err := populateAlbumBasics(tx, musicDir, &parent, &album, dir, basename, job.cover); err != nil {
+		return fmt.Errorf("populate album basics: %w", err)
+	}
+
+	c.seenAlbums[album.ID] = struct{}{}
+
+	albums := &folderAlbums{folder: &album, byKey: map[string]*db.Album{}}
+	for i, track := range job.tracks {
+		absPath := filepath.Join(job.absPath, track.basename)
+		if err := s.populateTrackAndAlbumArtists(tx, c, i, albums, track, absPath); err != nil {
+			return fmt.Errorf("populate track %q: %w", track.basename, err)
+		}
+	}
+	if len(job.tracks) > 0 {
+		c.seenMusicDirs[musicDir] = struct{}{}
+	}
+
+	return nil
+}
+
+// folderAlbums are the albums of a folder's tracks when browsing by tags. that's just the folder's own
+// album, unless albums are grouped by tags. then tracks with different album tags to the folder's first
+// track are split into albums of their own, by the key of their tags
+type folderAlbums struct {
+	folder    *db.Album
+	folderKey string
+	byKey     map[string]*db.Album
+}
+
+// find gets the album for the ith track of the folder, which has album tags with key. it's new if the
+// track is the first of the album seen in this scan, and the album should take its tags from the track
+func (a *folderAlbums) find(tx *db.DB, i int, key string) (*db.Album, bool, error) {
+	if i == 0 {
+		a.folderKey = key
+		return a.folder, true, nil
+	}
+	if a.folderKey == "" {
+		// the first track is unchanged, so the folder's key comes from its stored tags
+		var artistNames []string
+		err := tx.
+			Model(&db.Artist{}).
+			Joins("JOIN album_artists ON album_artists.artist_id=artists.id").
+			Where("album_artists.album_id=?", a.folder.ID).
+			Pluck("artists.name", &artistNames).
+			Error
+		if err != nil {
+			return nil, false, fmt.Errorf("find folder album artists: %w", err)
+		}
+		a.folderKey = tagGroupKey(a.folder.TagBrainzID, a.folder.TagTitle, artistNames)
+	}
+	if key == a.folderKey {
+		return a.folder, false, nil
+	}
+	if album, ok := a.byKey[key]; ok {
+		return album, false, nil
+	}
+
+	folder := a.folder
+	album := &db.Album{}
+	err := tx.
+		Where("root_dir=? AND left_path=? AND right_path=? AND tag_group=?", folder.RootDir, folder.LeftPath, folder.RightPath, key).
+		Assign(db.Album{RootDir: folder.RootDir, LeftPath: folder.LeftPath, RightPath: folder.RightPath, RightPathUDec: folder.RightPathUDec, Cover: folder.Cover, TagGroup: key}).
+		FirstOrCreate(album).
+		Error
+	if err != nil {
+		return nil, false, fmt.Errorf("first or create tag group album: %w", err)
+	}
+	a.byKey[key] = album
+	return album, true, nil
+}
+
+// tagGroupKey is what albums are grouped by when grouping by tags. that's the album MBID if there is one,
+// or else the album title and album artists
+func tagGroupKey(brainzID string, title string, artistNames []string) string {
+	if brainzID != "" {
+		return brainzID
+	}
+	artistNames = append([]string{}, artistNames...)
+	sort.Strings(artistNames)
+	return strings.ToLower(strings.Join(artistNames, "; ") + " - " + title)
+}
+
+func (s *Scanner) populateTrackAndAlbumArtists(tx *db.DB, c *Context, i int, albums *folderAlbums, st *scanTrack, absPath string) error {
+	basename := st.basename
+	album := albums.folder
+
+	var track db.Track
+	var cueTrack int
+	if st.cue != nil {
+		cueTrack = st.cue.track().Number
+	}
+	if err := tx.Where("album_id=? AND filename=? AND cue_track=?", album.ID, filepath.Base(basename), cueTrack).First(&track).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("query track: %w", err)
+	}
+
+	if st.trags == nil {
+		if track.ID != 0 {
+			c.seenTracks[track.ID] = struct{}{}
+			return nil
+		}
+		// the track was unchanged when the worker looked, but has since gone from the db
+		if err := s.readTrack(st, absPath); err != nil {
+			return err
+		}
+	}
+	trags := st.trags
+	if st.cue != nil {
+		trags = &cueParser{Parser: trags, scanCue: st.cue}
+	}
+
+	genreNames := parseMulti(trags, s.multiValueSettings[Genre], tags.MustGenres, tags.MustGenre)
+	genreIDs, err := populateGenres(tx, genreNames)
+	if err != nil {
+		return fmt.Errorf("populate genres: %w", err)
+	}
+
+	// metadata for the album table comes only from the the first track's tags. if albums are grouped by
+	// tags, the track may be the first of another album in the folder
+	tagAlbum, isFirst := album, i == 0
+	if isFirst || s.albumGrouping == AlbumGroupingTags {
+		albumArtistNames := parseMulti(trags, s.multiValueSettings[AlbumArtist], tags.MustAlbumArtists, tags.MustAlbumArtist)
+		if s.albumGrouping == AlbumGroupingTags {
+			key := tagGroupKey(trags.AlbumBrainzID(), tags.MustAlbum(trags), albumArtistNames)
+			if tagAlbum, isFirst, err = albums.find(tx, i, key); err != nil {
+				return fmt.Errorf("find tag album: %w", err)
+			}
+		}
+		if isFirst {
+			if err := populateAlbumFromTrack(tx, tagAlbum, trags, st, albumArtistNames, genreIDs); err != nil {
+				return err
+			}
+			c.albumsUpdated = append(c.albumsUpdated, int64(tagAlbum.ID))
+		}
+	}
+	tagAlbumID := tagAlbum.ID
+	track.TagAlbumID = &tagAlbumID
+
+	isNew := track.ID == 0
+	if err := populateTrack(tx, album, &track, trags, st); err != nil {
+		return fmt.Errorf("process %q: %w", basename, err)
+	}
+	if err := populateTrackGenres(tx, &track, genreIDs); err != nil {
+		return fmt.Errorf("populate track genres: %w", err)
+	}
+
+	artistNames := parseMulti(trags, s.multiValueSettings[Artist], tags.MustArtists, tags.MustArtist)
+	artistBrainzIDs := matchByPosition(artistNames, trags.ArtistBrainzIDs())
+	artistSorts := matchByPosition(artistNames, trags.ArtistSorts())
+	var artistIDs []int
+	for i, artistName := range artistNames {
+		artist, err := populateArtist(tx, artistName, artistBrainzIDs[i], artistSorts[i])
+		if err != nil {
+			return fmt.Errorf("populate track artist: %w", err)
+		}
+		artistIDs = append(artistIDs, artist.ID)
+	}
+	if err := populateTrackArtists(tx, &track, artistIDs); err != nil {
+		return fmt.Errorf("populate track artists: %w", err)
+	}
+
+	c.seenTracks[track.ID] = struct{}{}
+	c.seenTracksNew++
+	c.tracksUpdated = append(c.tracksUpdated, int64(track.ID))
+	if isNew {
+		c.tracksCreated = append(c.tracksCreated, int64(track.ID))
+	}
+
+	return nil
+}
+
+func populateAlbumFromTrack(tx *db.DB, album *db.Album, trags tags.Parser, st *scanTrack, albumArtistNames []string, genreIDs []int) error {
+	albumArtistBrainzIDs := matchByPosition(albumArtistNames, trags.AlbumArtistBrainzIDs())
+	albumArtistSorts := matchByPosition(albumArtistNames, trags.AlbumArtistSorts())
+	if trags.AlbumArtist() == "" && len(trags.AlbumArtists()) == 0 {
+		// the album artists fell back to the track artists, so the IDs and sort names should too
+		albumArtistBrainzIDs = matchByPosition(albumArtistNames, trags.ArtistBrainzIDs())
+		albumArtistSorts = matchByPosition(albumArtistNames, trags.ArtistSorts())
+	}
+	var albumArtistIDs []int
+	for i, albumArtistName := range albumArtistNames {
+		albumArtist, err := populateArtist(tx, albumArtistName, albumArtistBrainzIDs[i], albumArtistSorts[i])
+		if err != nil {
+			return fmt.Errorf("populate album artist: %w", err)
+		}
+		albumArtistIDs = append(albumArtistIDs, albumArtist.ID)
+	}
+	if err := populateAlbumArtists(tx, album, albumArtistIDs); err != nil {
+		return fmt.Errorf("populate album artists: %w", err)
+	}
+
+	var embeddedCover string
+	if st.picture {
+		embeddedCover = st.basename
+	}
+	if err := populateAlbum(tx, album, trags, st.modTime, embeddedCover); err != nil {
+		return fmt.Errorf("populate album: %w", err)
+	}
+
+	if err := populateAlbumGenres(tx, album, genreIDs); err != nil {
+		return fmt.Errorf("populate album genres: %w", err)
+	}
+	return nil
+}
+
+func populateAlbum(tx *db.DB, album *db.Album, trags tags.Parser, modTime time.Time, embeddedCover string) error {
+	albumName := tags.MustAlbum(trags)
+	album.TagTitle = albumName
+	album.TagTitleUDec = decoded(albumName)
+	album.TagTitleSort = trags.AlbumSort()
+	album.TagBrainzID = trags.AlbumBrainzID()
+	album.TagYear = trags.Year()
+	album.TagOriginalDate = trags.OriginalDate()
+	album.TagLabel = trags.Label()
+	album.TagCatalogNumber = trags.CatalogNumber()
+	album.TagCompilation = trags.Compilation()
+	album.TagReleaseTypes = strings.Join(trags.ReleaseTypes(), ";")
+	album.EmbeddedCover = embeddedCover
+
+	album.ModifiedAt = modTime
+	album.CreatedAt = modTime
+
+	if err := tx.Save(&album).Error; err != nil {
+		return fmt.Errorf("saving album: %w", err)
+	}
+
+	return nil
+}
+
+func populateAlbumBasics(tx *db.DB, musicDir string, parent, album *db.Album, dir, basename string, cover string) error {
+	if err := tx.Where("root_dir=? AND left_path=? AND right_path=? AND tag_group=''", musicDir, dir, basename).First(album).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("find album: %w", err)
 	}
 
 	// see if we can save ourselves from an extra write if it's found and nothing has changed
@@ -437,41 +1250,239 @@ func populateAlbumBasics(tx *db.DB, musicDir string, parent, album *db.Album, di
 	return nil
 }
 
-func populateTrack(tx *db.DB, album *db.Album, track *db.Track, trags tags.Parser, absPath string, size int) error {
-	basename := filepath.Base(absPath)
+func populateTrack(tx *db.DB, album *db.Album, track *db.Track, trags tags.Parser, st *scanTrack) error {
+	basename := filepath.Base(st.basename)
 	track.Filename = basename
 	track.FilenameUDec = decoded(basename)
-	track.Size = size
+	track.Size = st.size
+	track.Hash = st.hash
 	track.AlbumID = album.ID
 
+	if st.cue != nil {
+		// the hash is of the whole file, so it can't tell the file's tracks apart
+		track.Hash = ""
+		track.CueTrack = st.cue.track().Number
+		track.CueStart = int(st.cue.track().Start.Milliseconds())
+		track.CueEnd = int(st.cue.file.End(st.cue.index).Milliseconds())
+	}
+
 	track.TagTitle = trags.Title()
 	track.TagTitleUDec = decoded(trags.Title())
+	track.TagTitleSort = trags.TitleSort()
 	track.TagTrackArtist = trags.Artist()
 	track.TagTrackNumber = trags.TrackNumber()
 	track.TagDiscNumber = trags.DiscNumber()
 	track.TagBrainzID = trags.BrainzID()
-
-	track.Length = trags.Length()   // these two should be calculated
-	track.Bitrate = trags.Bitrate() // ...from the file instead of tags
+	track.TagComposer = trags.Composer()
+	track.TagConductor = trags.Conductor()
+	track.TagLyricist = trags.Lyricist()
+	track.TagComment = trags.Comment()
+	track.TagBPM = trags.BPM()
+	track.TagDiscSubtitle = trags.DiscSubtitle()
+
+	track.ReplayGainTrackGain = trags.ReplayGainTrackGain()
+	track.ReplayGainTrackPeak = trags.ReplayGainTrackPeak()
+	track.ReplayGainAlbumGain = trags.ReplayGainAlbumGain()
+	track.ReplayGainAlbumPeak = trags.ReplayGainAlbumPeak()
+	track.R128TrackGain = trags.R128TrackGain()
+	track.R128AlbumGain = trags.R128AlbumGain()
+
+	track.Length = trags.Length()
+	track.Bitrate = trags.Bitrate()
+	track.SampleRate = trags.SampleRate()
+	track.BitDepth = trags.BitDepth()
+	track.Channels = trags.Channels()
 
 	if err := tx.Save(&track).Error; err != nil {
 		return fmt.Errorf("saving track: %w", err)
 	}
 
+	if err := populateTrackLyrics(tx, track, st.lyrics); err != nil {
+		return fmt.Errorf("populate lyrics: %w", err)
+	}
+
 	return nil
 }
 
-func populateArtist(tx *db.DB, artistName string) (*db.Artist, error) {
+func populateTrackLyrics(tx *db.DB, track *db.Track, lyrics []*db.TrackLyrics) error {
+	if err := tx.Where("track_id=?", track.ID).Delete(db.TrackLyrics{}).Error; err != nil {
+		return fmt.Errorf("delete old: %w", err)
+	}
+	for _, l := range lyrics {
+		l.ID = 0
+		l.TrackID = track.ID
+		if err := tx.Create(l).Error; err != nil {
+			return fmt.Errorf("create: %w", err)
+		}
+	}
+	return nil
+}
+
+// cueParser overrides a file's tags with the details of one of its tracks from a cue sheet
+type cueParser struct {
+	tags.Parser
+	*scanCue
+}
+
+func (p *cueParser) Title() string    { return p.track().Title }
+func (p *cueParser) BrainzID() string { return "" }
+func (p *cueParser) Artist() string {
+	return firstNonZero(p.track().Performer, p.sheet.Performer, p.Parser.Artist())
+}
+func (p *cueParser) Album() string { return firstNonZero(p.sheet.Title, p.Parser.Album()) }
+func (p *cueParser) AlbumArtist() string {
+	return firstNonZero(p.sheet.Performer, p.Parser.AlbumArtist())
+}
+func (p *cueParser) Composer() string {
+	return firstNonZero(p.track().Songwriter, p.sheet.Songwriter, p.Parser.Composer())
+}
+func (p *cueParser) Genre() string    { return firstNonZero(p.sheet.Genre, p.Parser.Genre()) }
+func (p *cueParser) TrackNumber() int { return p.track().Number }
+
+func (p *cueParser) Artists() []string {
+	if performer := firstNonZero(p.track().Performer, p.sheet.Performer); performer != "" {
+		return []string{performer}
+	}
+	return p.Parser.Artists()
+}
+
+func (p *cueParser) ArtistBrainzIDs() []string {
+	if p.track().Performer != "" || p.sheet.Performer != "" {
+		return nil
+	}
+	return p.Parser.ArtistBrainzIDs()
+}
+
+func (p *cueParser) AlbumArtistBrainzIDs() []string {
+	if p.sheet.Performer != "" {
+		return nil
+	}
+	return p.Parser.AlbumArtistBrainzIDs()
+}
+
+func (p *cueParser) ArtistSorts() []string {
+	if p.track().Performer != "" || p.sheet.Performer != "" {
+		return nil
+	}
+	return p.Parser.ArtistSorts()
+}
+
+func (p *cueParser) AlbumArtistSorts() []string {
+	if p.sheet.Performer != "" {
+		return nil
+	}
+	return p.Parser.AlbumArtistSorts()
+}
+
+func (p *cueParser) TitleSort() string { return "" }
+func (p *cueParser) AlbumSort() string {
+	if p.sheet.Title != "" {
+		return ""
+	}
+	return p.Parser.AlbumSort()
+}
+
+func (p *cueParser) AlbumArtists() []string {
+	if p.sheet.Performer != "" {
+		return []string{p.sheet.Performer}
+	}
+	return p.Parser.AlbumArtists()
+}
+
+func (p *cueParser) Genres() []string {
+	if p.sheet.Genre != "" {
+		return []string{p.sheet.Genre}
+	}
+	return p.Parser.Genres()
+}
+
+func (p *cueParser) Year() int {
+	if p.sheet.Year != 0 {
+		return p.sheet.Year
+	}
+	return p.Parser.Year()
+}
+
+// the file's track gain is for the whole file, so it's only kept as the album gain
+func (p *cueParser) ReplayGainTrackGain() float32 { return p.track().ReplayGainGain }
+func (p *cueParser) ReplayGainTrackPeak() float32 { return p.track().ReplayGainPeak }
+func (p *cueParser) R128TrackGain() int           { return 0 }
+
+func (p *cueParser) ReplayGainAlbumGain() float32 {
+	return firstNonZero(p.sheet.ReplayGainGain, p.Parser.ReplayGainAlbumGain(), p.Parser.ReplayGainTrackGain())
+}
+
+func (p *cueParser) ReplayGainAlbumPeak() float32 {
+	return firstNonZero(p.sheet.ReplayGainPeak, p.Parser.ReplayGainAlbumPeak(), p.Parser.ReplayGainTrackPeak())
+}
+
+func (p *cueParser) R128AlbumGain() int {
+	return firstNonZero(p.Parser.R128AlbumGain(), p.Parser.R128TrackGain())
+}
+
+func (p *cueParser) Length() int {
+	end := p.file.End(p.index)
+	if end == 0 {
+		end = time.Duration(p.Parser.Length()) * time.Second
+	}
+	if length := end - p.track().Start; length > 0 {
+		return int(length.Seconds())
+	}
+	return 0
+}
+
+// populateArtist finds or creates an artist by their musicbrainz ID if we have one, falling back to
+// their name. an artist found by name without an ID takes the ID, so they keep their stars and ratings.
+// an empty ID or sort name keeps the one we have, since not every track of an artist might be tagged
+func populateArtist(tx *db.DB, artistName string, brainzID string, sortName string) (*db.Artist, error) {
 	var update db.Artist
 	update.Name = artistName
 	update.NameUDec = decoded(artistName)
+	update.NameSort = sortName
+	update.BrainzID = brainzID
+
 	var artist db.Artist
-	if err := tx.Where("name=?", artistName).Assign(update).FirstOrCreate(&artist).Error; err != nil {
-		return nil, fmt.Errorf("find or create artist: %w", err)
+	q := tx.Where("name=?", artistName).Order("(brainz_id IS NULL OR brainz_id='') DESC, id")
+	if brainzID != "" {
+		err := tx.Where("brainz_id=?", brainzID).First(&artist).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("find artist by id: %w", err)
+		}
+		q = q.Where("brainz_id IS NULL OR brainz_id=''")
+	}
+	if artist.ID == 0 {
+		err := q.First(&artist).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("find artist by name: %w", err)
+		}
+	}
+	if brainzID == "" {
+		update.BrainzID = artist.BrainzID
+	}
+	if sortName == "" {
+		update.NameSort = artist.NameSort
+	}
+	if artist.ID != 0 && artist.Name == update.Name && artist.NameUDec == update.NameUDec && artist.NameSort == update.NameSort && artist.BrainzID == update.BrainzID {
+		return &artist, nil
+	}
+	artist.Name, artist.NameUDec, artist.NameSort, artist.BrainzID = update.Name, update.NameUDec, update.NameSort, update.BrainzID
+	if err := tx.Save(&artist).Error; err != nil {
+		return nil, fmt.Errorf("save artist: %w", err)
 	}
 	return &artist, nil
 }
 
+// matchByPosition matches values like musicbrainz IDs or sort names to artist names by position. if
+// they don't line up, we can't tell which is which, so none are used
+func matchByPosition(names []string, values []string) []string {
+	out := make([]string, len(names))
+	if len(values) != len(names) {
+		return out
+	}
+	copy(out, values)
+	return out
+}
+
 func populateGenres(tx *db.DB, names []string) ([]int, error) {
 	var filteredNames []string
 	for _, name := range names {
@@ -515,6 +1526,17 @@ func populateAlbumGenres(tx *db.DB, album *db.Album, genreIDs []int) error {
 	return nil
 }
 
+func populateTrackArtists(tx *db.DB, track *db.Track, artistIDs []int) error {
+	if err := tx.Where("track_id=?", track.ID).Delete(db.TrackArtist{}).Error; err != nil {
+		return fmt.Errorf("delete old track artist records: %w", err)
+	}
+
+	if err := tx.InsertBulkLeftMany("track_artists", []string{"track_id", "artist_id"}, track.ID, artistIDs); err != nil {
+		return fmt.Errorf("insert bulk track artists: %w", err)
+	}
+	return nil
+}
+
 func populateAlbumArtists(tx *db.DB, album *db.Album, albumArtistIDs []int) error {
 	if err := tx.Where("album_id=?", album.ID).Delete(db.AlbumArtist{}).Error; err != nil {
 		return fmt.Errorf("delete old album album artists: %w", err)
@@ -526,46 +1548,408 @@ func populateAlbumArtists(tx *db.DB, album *db.Album, albumArtistIDs []int) erro
 	return nil
 }
 
-func (s *Scanner) cleanTracks(c *Context) error {
+// clean removes the tracks and albums at or under roots which weren't seen by the scan, or all of
+// them if no roots are provided. then any artists and genres left orphaned
+func (s *Scanner) clean(c *Context, roots ...scanRoot) error {
+	if err := s.findUnavailableMusicDirs(c, roots...); err != nil {
+		return fmt.Errorf("find unavailable music dirs: %w", err)
+	}
+	if err := s.cleanTracks(c, roots...); err != nil {
+		return fmt.Errorf("clean tracks: %w", err)
+	}
+	if err := s.cleanAlbums(c, roots...); err != nil {
+		return fmt.Errorf("clean albums: %w", err)
+	}
+	if err := s.cleanArtists(c); err != nil {
+		return fmt.Errorf("clean artists: %w", err)
+	}
+	if err := s.cleanGenres(c); err != nil {
+		return fmt.Errorf("clean genres: %w", err)
+	}
+	return nil
+}
+
+// findUnavailableMusicDirs finds the music dirs of roots, or all of them if no roots are provided,
+// which can't be read, or which had tracks but had none when the whole of them was scanned. that's
+// more likely an unmounted drive than a deleted library, so they're left alone by the clean
+func (s *Scanner) findUnavailableMusicDirs(c *Context, roots ...scanRoot) error {
+	scannedWhole := map[string]bool{}
+	for _, root := range roots {
+		scannedWhole[root.musicDir] = scannedWhole[root.musicDir] || root.absPath == root.musicDir
+	}
+	if len(roots) == 0 {
+		for _, dir := range s.musicDirs {
+			scannedWhole[dir] = true
+		}
+	}
+	for _, dir := range s.musicDirs {
+		whole, ok := scannedWhole[dir]
+		if !ok {
+			continue
+		}
+		if _, err := os.Stat(dir); err != nil {
+			c.unavailableMusicDirs = append(c.unavailableMusicDirs, dir)
+			c.errs.Add(newScanError(dir, db.ScanErrorKindFolder, fmt.Errorf("%w: %v", ErrNotCleaned, err)))
+			continue
+		}
+		if _, ok := c.seenMusicDirs[dir]; ok || !whole {
+			continue
+		}
+		var count int
+		err := s.db.
+			Model(&db.Track{}).
+			Joins("JOIN albums ON albums.id=tracks.album_id").
+			Where("albums.root_dir=?", dir).
+			Count(&count).
+			Error
+		if err != nil {
+			return fmt.Errorf("count tracks: %w", err)
+		}
+		if count > 0 {
+			c.unavailableMusicDirs = append(c.unavailableMusicDirs, dir)
+			c.errs.Add(newScanError(dir, db.ScanErrorKindFolder, fmt.Errorf("%w: none of its %d tracks were found", ErrNotCleaned, count)))
+		}
+	}
+	return nil
+}
+
+// whereAlbumsUnder matches albums at or under any of roots, or all albums if no roots are provided,
+// except for those in music dirs which are unavailable
+func whereAlbumsUnder(q *gorm.DB, c *Context, roots []scanRoot) *gorm.DB {
+	if len(c.unavailableMusicDirs) > 0 {
+		q = q.Where("albums.root_dir NOT IN (?)", c.unavailableMusicDirs)
+	}
+	if len(roots) == 0 {
+		return q
+	}
+	var conds []string
+	var args []interface{}
+	for _, root := range roots {
+		relPath, _ := filepath.Rel(root.musicDir, root.absPath)
+		if relPath == "." {
+			conds = append(conds, "(albums.root_dir=?)")
+			args = append(args, root.musicDir)
+			continue
+		}
+		dir, basename := filepath.Split(relPath)
+		prefix := relPath + "/"
+		conds = append(conds, "(albums.root_dir=? AND ((albums.left_path=? AND albums.right_path=?) OR substr(albums.left_path, 1, length(?))=?))")
+		args = append(args, root.musicDir, dir, basename, prefix, prefix)
+	}
+	return q.Where(strings.Join(conds, " OR "), args...)
+}
+
+// missingRow is a track or album, and when it went missing if it already had
+type missingRow struct {
+	ID           int
+	MissingSince *time.Time
+}
+
+func (s *Scanner) cleanTracks(c *Context, roots ...scanRoot) error {
 	start := time.Now()
-	defer func() { log.Printf("finished clean tracks in %s, %d removed", durSince(start), c.TracksMissing()) }()
+	defer func() {
+		log.Printf("finished clean tracks in %s, %d missing, %d removed, %d moved", durSince(start), c.TracksMissing(), c.TracksRemoved(), c.TracksMoved())
+	}()
 
-	var all []int
-	err := s.db.
-		Model(&db.Track{}).
-		Pluck("id", &all).
+	var all []missingRow
+	err := whereAlbumsUnder(s.db.Model(&db.Track{}).Joins("JOIN albums ON albums.id=tracks.album_id"), c, roots).
+		Select("tracks.id, tracks.missing_since").
+		Scan(&all).
 		Error
 	if err != nil {
-		return fmt.Errorf("plucking ids: %w", err)
+		return fmt.Errorf("finding ids: %w", err)
 	}
+	missingSince := map[int64]*time.Time{}
+	var found []int64
 	for _, a := range all {
-		if _, ok := c.seenTracks[a]; !ok {
-			c.tracksMissing = append(c.tracksMissing, int64(a))
+		if _, ok := c.seenTracks[a.ID]; ok {
+			if a.MissingSince != nil {
+				found = append(found, int64(a.ID))
+			}
+			continue
 		}
+		c.tracksMissing = append(c.tracksMissing, int64(a.ID))
+		missingSince[int64(a.ID)] = a.MissingSince
+	}
+	moved, err := s.carryOverMovedTracks(c)
+	if err != nil {
+		return fmt.Errorf("carry over moved tracks: %w", err)
+	}
+
+	var mark []int64
+	c.tracksRemoved, mark = s.sortMissing(c, c.tracksMissing, missingSince, moved)
+	if err := setMissingSince(s.db, &db.Track{}, found, gorm.Expr("NULL")); err != nil {
+		return fmt.Errorf("unmark found: %w", err)
+	}
+	if err := setMissingSince(s.db, &db.Track{}, mark, c.start); err != nil {
+		return fmt.Errorf("mark missing: %w", err)
 	}
-	return s.db.TransactionChunked(c.tracksMissing, func(tx *gorm.DB, chunk []int64) error {
+	return s.db.TransactionChunked(c.tracksRemoved, func(tx *gorm.DB, chunk []int64) error {
 		return tx.Where(chunk).Delete(&db.Track{}).Error
 	})
 }
 
-func (s *Scanner) cleanAlbums(c *Context) error {
+// sortMissing splits the ids of tracks or albums which weren't found into those to remove, since they were
+// moved or have been missing for longer than the grace period, and those which have only just gone missing
+func (s *Scanner) sortMissing(c *Context, ids []int64, missingSince map[int64]*time.Time, moved map[int64]struct{}) (remove, mark []int64) {
+	for _, id := range ids {
+		since := missingSince[id]
+		_, isMoved := moved[id]
+		switch {
+		case isMoved, s.missingGracePeriod <= 0, since != nil && c.start.Sub(*since) >= s.missingGracePeriod:
+			remove = append(remove, id)
+		case since == nil:
+			mark = append(mark, id)
+		}
+	}
+	return remove, mark
+}
+
+func setMissingSince(dbc *db.DB, model interface{}, ids []int64, since interface{}) error {
+	return dbc.TransactionChunked(ids, func(tx *gorm.DB, chunk []int64) error {
+		return tx.Model(model).Where(chunk).UpdateColumn("missing_since", since).Error
+	})
+}
+
+// carryOverMovedTracks matches tracks which weren't found with tracks created in this scan. if a track
+// was moved or renamed, the user's stars, ratings, bookmarks, and listens follow it to its new location,
+// and the ids of the tracks they came from are returned
+func (s *Scanner) carryOverMovedTracks(c *Context) (map[int64]struct{}, error) {
+	if len(c.tracksMissing) == 0 || len(c.tracksCreated) == 0 {
+		return nil, nil
+	}
+
+	missing, err := s.loadTracks(c.tracksMissing)
+	if err != nil {
+		return nil, fmt.Errorf("load missing: %w", err)
+	}
+	created, err := s.loadTracks(c.tracksCreated)
+	if err != nil {
+		return nil, fmt.Errorf("load created: %w", err)
+	}
+
+	type hashKey struct {
+		hash string
+		size int
+	}
+	byBrainzID := map[string]*db.Track{}
+	byHash := map[hashKey]*db.Track{}
+	for _, t := range created {
+		if t.TagBrainzID != "" {
+			byBrainzID[t.TagBrainzID] = t
+		}
+		// all empty files hash the same
+		if t.Hash != "" && t.Size > 0 {
+			byHash[hashKey{t.Hash, t.Size}] = t
+		}
+	}
+
+	claimed := map[int]struct{}{}
+	moved := map[int64]struct{}{}
+	movedAlbums := map[int]int{}
+	movedPaths := map[string]string{}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, from := range missing {
+			to := byBrainzID[from.TagBrainzID]
+			if to == nil && from.Hash != "" {
+				to = byHash[hashKey{from.Hash, from.Size}]
+			}
+			if to == nil {
+				continue
+			}
+			if _, ok := claimed[to.ID]; ok {
+				continue
+			}
+			claimed[to.ID] = struct{}{}
+
+			if err := moveTrackUserData(tx, from, to); err != nil {
+				return fmt.Errorf("track %d to %d: %w", from.ID, to.ID, err)
+			}
+			movedPaths[from.AbsPath()] = to.AbsPath()
+			moved[int64(from.ID)] = struct{}{}
+			c.tracksMoved++
+
+			if _, ok := c.seenAlbums[from.AlbumID]; ok {
+				continue
+			}
+			if _, ok := movedAlbums[from.AlbumID]; ok {
+				continue
+			}
+			movedAlbums[from.AlbumID] = to.AlbumID
+			if err := moveAlbumUserData(tx, from.AlbumID, to.AlbumID); err != nil {
+				return fmt.Errorf("album %d to %d: %w", from.AlbumID, to.AlbumID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.rewritePlaylists(movedPaths); err != nil {
+		return nil, fmt.Errorf("rewrite playlists: %w", err)
+	}
+	return moved, nil
+}
+
+func (s *Scanner) loadTracks(ids []int64) ([]*db.Track, error) {
+	var tracks []*db.Track
+	err := s.db.TransactionChunked(ids, func(tx *gorm.DB, chunk []int64) error {
+		var page []*db.Track
+		if err := tx.Preload("Album").Where(chunk).Find(&page).Error; err != nil {
+			return err
+		}
+		tracks = append(tracks, page...)
+		return nil
+	})
+	return tracks, err
+}
+
+func moveTrackUserData(tx *gorm.DB, from, to *db.Track) error {
+	if err := tx.Exec("UPDATE track_stars SET track_id=? WHERE track_id=?", to.ID, from.ID).Error; err != nil {
+		return fmt.Errorf("stars: %w", err)
+	}
+	if err := tx.Exec("UPDATE track_ratings SET track_id=? WHERE track_id=?", to.ID, from.ID).Error; err != nil {
+		return fmt.Errorf("ratings: %w", err)
+	}
+	if err := tx.Exec("UPDATE track_plays SET track_id=? WHERE track_id=?", to.ID, from.ID).Error; err != nil {
+		return fmt.Errorf("plays: %w", err)
+	}
+	if err := tx.Exec("UPDATE listens SET track_id=? WHERE track_id=?", to.ID, from.ID).Error; err != nil {
+		return fmt.Errorf("listens: %w", err)
+	}
+	if err := tx.Model(&db.Track{}).Where("id=?", to.ID).Update("average_rating", from.AverageRating).Error; err != nil {
+		return fmt.Errorf("average rating: %w", err)
+	}
+	if err := tx.Exec("UPDATE bookmarks SET entry_id=? WHERE entry_id_type=? AND entry_id=?", to.ID, string(specid.Track), from.ID).Error; err != nil {
+		return fmt.Errorf("bookmarks: %w", err)
+	}
+	return nil
+}
+
+// moveAlbumUserData moves an album's listens, and its stars and ratings, but only for users who
+// don't already have them on the new album
+func moveAlbumUserData(tx *gorm.DB, fromID, toID int) error {
+	for _, table := range []string{"album_stars", "album_ratings"} {
+		q := fmt.Sprintf("UPDATE %[1]s SET album_id=? WHERE album_id=? AND user_id NOT IN (SELECT user_id FROM %[1]s WHERE album_id=?)", table)
+		if err := tx.Exec(q, toID, fromID, toID).Error; err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	if err := tx.Exec("UPDATE listens SET album_id=? WHERE album_id=?", toID, fromID).Error; err != nil {
+		return fmt.Errorf("listens: %w", err)
+	}
+	var from db.Album
+	if err := tx.Select("average_rating").Where("id=?", fromID).Find(&from).Error; err != nil {
+		return fmt.Errorf("find album: %w", err)
+	}
+	if err := tx.Model(&db.Album{}).Where("id=?", toID).Update("average_rating", from.AverageRating).Error; err != nil {
+		return fmt.Errorf("average rating: %w", err)
+	}
+	return nil
+}
+
+// rewritePlaylists points playlist items at moved tracks' new paths
+func (s *Scanner) rewritePlaylists(movedPaths map[string]string) error {
+	if s.playlistStore == nil || len(movedPaths) == 0 {
+		return nil
+	}
+	relPaths, err := s.playlistStore.List()
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+	for _, relPath := range relPaths {
+		pl, err := s.playlistStore.Read(relPath)
+		if err != nil {
+			return fmt.Errorf("read %q: %w", relPath, err)
+		}
+		var changed bool
+		for i, item := range pl.Items {
+			if to, ok := movedPaths[item]; ok {
+				pl.Items[i] = to
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if err := s.playlistStore.Write(relPath, pl); err != nil {
+			return fmt.Errorf("write %q: %w", relPath, err)
+		}
+	}
+	return nil
+}
+
+func (s *Scanner) cleanAlbums(c *Context, roots ...scanRoot) error {
 	start := time.Now()
-	defer func() { log.Printf("finished clean albums in %s, %d removed", durSince(start), c.AlbumsMissing()) }()
+	defer func() {
+		log.Printf("finished clean albums in %s, %d missing, %d removed", durSince(start), c.AlbumsMissing(), c.AlbumsRemoved())
+	}()
 
-	var all []int
-	err := s.db.
-		Model(&db.Album{}).
-		Pluck("id", &all).
+	var all []missingRow
+	err := whereAlbumsUnder(s.db.Model(&db.Album{}), c, roots).
+		Where("albums.tag_group=''").
+		Select("albums.id, albums.missing_since").
+		Scan(&all).
 		Error
 	if err != nil {
-		return fmt.Errorf("plucking ids: %w", err)
+		return fmt.Errorf("finding ids: %w", err)
 	}
+	missingSince := map[int64]*time.Time{}
+	var found []int64
 	for _, a := range all {
-		if _, ok := c.seenAlbums[a]; !ok {
-			c.albumsMissing = append(c.albumsMissing, int64(a))
+		if _, ok := c.seenAlbums[a.ID]; ok {
+			if a.MissingSince != nil {
+				found = append(found, int64(a.ID))
+			}
+			continue
 		}
+		c.albumsMissing = append(c.albumsMissing, int64(a.ID))
+		missingSince[int64(a.ID)] = a.MissingSince
+	}
+
+	var mark []int64
+	c.albumsRemoved, mark = s.sortMissing(c, c.albumsMissing, missingSince, nil)
+	if err := setMissingSince(s.db, &db.Album{}, found, gorm.Expr("NULL")); err != nil {
+		return fmt.Errorf("unmark found: %w", err)
 	}
-	return s.db.TransactionChunked(c.albumsMissing, func(tx *gorm.DB, chunk []int64) error {
+	if err := setMissingSince(s.db, &db.Album{}, mark, c.start); err != nil {
+		return fmt.Errorf("mark missing: %w", err)
+	}
+
+	// albums grouped by tags aren't folders to be seen, so they're missing while all of their tracks are,
+	// and go once they've no tracks left
+	err = s.db.
+		Model(&db.Album{}).
+		Where("albums.tag_group<>'' AND albums.missing_since IS NULL").
+		Where("NOT EXISTS (SELECT 1 FROM tracks WHERE tracks.tag_album_id=albums.id AND tracks.missing_since IS NULL)").
+		UpdateColumn("missing_since", c.start).
+		Error
+	if err != nil {
+		return fmt.Errorf("mark missing tag groups: %w", err)
+	}
+	err = s.db.
+		Model(&db.Album{}).
+		Where("albums.tag_group<>'' AND albums.missing_since IS NOT NULL").
+		Where("EXISTS (SELECT 1 FROM tracks WHERE tracks.tag_album_id=albums.id AND tracks.missing_since IS NULL)").
+		UpdateColumn("missing_since", gorm.Expr("NULL")).
+		Error
+	if err != nil {
+		return fmt.Errorf("unmark found tag groups: %w", err)
+	}
+	var unused []int64
+	err = s.db.
+		Model(&db.Album{}).
+		Where("albums.tag_group<>''").
+		Where("NOT EXISTS (SELECT 1 FROM tracks WHERE tracks.tag_album_id=albums.id)").
+		Pluck("albums.id", &unused).
+		Error
+	if err != nil {
+		return fmt.Errorf("plucking unused tag group ids: %w", err)
+	}
+	c.albumsRemoved = append(c.albumsRemoved, unused...)
+
+	return s.db.TransactionChunked(c.albumsRemoved, func(tx *gorm.DB, chunk []int64) error {
 		return tx.Where(chunk).Delete(&db.Album{}).Error
 	})
 }
@@ -578,7 +1962,8 @@ func (s *Scanner) cleanArtists(c *Context) error {
 		Select("artists.id").
 		Model(&db.Artist{}).
 		Joins("LEFT JOIN album_artists ON album_artists.artist_id=artists.id").
-		Where("album_artists.artist_id IS NULL").
+		Joins("LEFT JOIN track_artists ON track_artists.artist_id=artists.id").
+		Where("album_artists.artist_id IS NULL AND track_artists.artist_id IS NULL").
 		SubQuery()
 	q := s.db.
 		Where("artists.id IN ?", sub).
@@ -613,6 +1998,235 @@ func (s *Scanner) cleanGenres(c *Context) error {
 	return nil
 }
 
+// updateSearchIndex indexes what changed in the scan, and removes what was cleaned
+func (s *Scanner) updateSearchIndex(c *Context) error {
+	start := time.Now()
+	defer func() { log.Printf("finished update search index in %s", durSince(start)) }()
+
+	return s.db.UpdateSearchIndex(c.tracksUpdated, c.albumsUpdated)
+}
+
+// DefaultMultiDiscPattern matches disc folder names like "CD1", "Disc 2", or "disc-03 - Live". the first
+// group is the disc number, and the second is the disc's subtitle
+const DefaultMultiDiscPattern = `(?i)^(?:cd|dis[ck])[ _.-]*(\d+)(?:[ _.-]+(.+))?$`
+
+// AlbumGrouping is how tracks are grouped into albums when browsing by tags
+type AlbumGrouping string
+
+const (
+	// AlbumGroupingFolder makes an album of each folder, with the discs of multi-disc albums merged
+	AlbumGroupingFolder AlbumGrouping = "folder"
+	// AlbumGroupingTags groups tracks by their album MBID, or album title and album artists, wherever
+	// they are on disk
+	AlbumGroupingTags AlbumGrouping = "tags"
+)
+
+type disc struct {
+	album    *db.Album
+	number   int
+	subtitle string
+}
+
+// mergeAlbums finds folders which are the discs of one album, like "Album/CD1" and "Album/CD2", and
+// merges the later discs into the first when browsing by tags. sibling folders are discs of one album
+// if they have disc folder names and the same album artists, or they share an album MBID, or they
+// share a title, year, and album artists. if albums are grouped by tags, any albums with the same album
+// MBID, or album title and album artists, are merged too. the folders themselves are untouched, so
+// browsing by folder still shows the layout on disk
+func (s *Scanner) mergeAlbums(c *Context) error {
+	start := time.Now()
+	var merged int
+	defer func() { log.Printf("finished merge albums in %s, %d merged", durSince(start), merged) }()
+
+	if s.albumGrouping != AlbumGroupingTags {
+		// unchanged tracks may still be in the albums they were grouped into by tags before
+		err := s.db.
+			Model(&db.Track{}).
+			Where("tag_album_id IS NULL OR tag_album_id<>album_id").
+			UpdateColumn("tag_album_id", gorm.Expr("album_id")).
+			Error
+		if err != nil {
+			return fmt.Errorf("reset tag albums: %w", err)
+		}
+	}
+
+	var albums []*db.Album
+	err := s.db.
+		Where("EXISTS (SELECT 1 FROM tracks WHERE tracks.tag_album_id=albums.id)").
+		Preload("Artists").
+		Order("albums.root_dir, albums.left_path, albums.right_path, albums.tag_group").
+		Find(&albums).
+		Error
+	if err != nil {
+		return fmt.Errorf("find albums: %w", err)
+	}
+
+	var groups [][]*disc
+	siblings := map[int][]*db.Album{}
+	var parentIDs []int
+	for _, album := range albums {
+		if album.ParentID == 0 {
+			// a music dir, or an album grouped by tags, which has no siblings
+			groups = append(groups, []*disc{{album: album, number: 1}})
+			continue
+		}
+		if _, ok := siblings[album.ParentID]; !ok {
+			parentIDs = append(parentIDs, album.ParentID)
+		}
+		siblings[album.ParentID] = append(siblings[album.ParentID], album)
+	}
+	for _, parentID := range parentIDs {
+		groups = append(groups, s.discGroups(siblings[parentID])...)
+	}
+	if s.albumGrouping == AlbumGroupingTags {
+		groups = groupByTags(groups)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, discs := range groups {
+			if len(discs) > 1 {
+				merged += len(discs) - 1
+			}
+			if err := mergeDiscGroup(tx, c, discs); err != nil {
+				return fmt.Errorf("merge discs of %q: %w", discs[0].album.AbsPath(), err)
+			}
+		}
+		return nil
+	})
+}
+
+// groupByTags joins groups of discs whose first albums have the same album MBID, or album title and
+// album artists. the group of the first folder on disk comes first, before any albums grouped by tags
+func groupByTags(groups [][]*disc) [][]*disc {
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i][0].album, groups[j][0].album
+		if a.IsFolder() != b.IsFolder() {
+			return a.IsFolder()
+		}
+		if a.AbsPath() != b.AbsPath() {
+			return a.AbsPath() < b.AbsPath()
+		}
+		return a.TagGroup < b.TagGroup
+	})
+
+	var joined [][]*disc
+	joinedByKey := map[string]int{}
+	for _, discs := range groups {
+		album := discs[0].album
+		var artistNames []string
+		for _, artist := range album.Artists {
+			artistNames = append(artistNames, artist.Name)
+		}
+		key := tagGroupKey(album.TagBrainzID, album.TagTitle, artistNames)
+		if i, ok := joinedByKey[key]; ok {
+			joined[i] = append(joined[i], discs...)
+			continue
+		}
+		joinedByKey[key] = len(joined)
+		joined = append(joined, discs)
+	}
+	return joined
+}
+
+func (s *Scanner) discGroups(siblings []*db.Album) [][]*disc {
+	var groups [][]*disc
+	groupsByKey := map[string]int{}
+	for _, album := range siblings {
+		d := &disc{album: album}
+		var isDiscName bool
+		if s.multiDiscPattern != nil {
+			if match := s.multiDiscPattern.FindStringSubmatch(album.RightPath); match != nil {
+				isDiscName = true
+				if len(match) > 1 {
+					d.number, _ = strconv.Atoi(match[1])
+				}
+				if len(match) > 2 {
+					d.subtitle = strings.TrimSpace(match[2])
+				}
+			}
+		}
+
+		var artistIDs []string
+		for _, artist := range album.Artists {
+			artistIDs = append(artistIDs, strconv.Itoa(artist.ID))
+		}
+		sort.Strings(artistIDs)
+		artists := strings.Join(artistIDs, ",")
+
+		var key string
+		switch {
+		case album.TagBrainzID != "":
+			key = "mbid\x00" + album.TagBrainzID
+		case isDiscName:
+			key = "disc\x00" + artists
+		case album.TagTitle != "" && len(album.Artists) > 0:
+			key = fmt.Sprintf("title\x00%s\x00%d\x00%s", strings.ToLower(album.TagTitle), album.TagYear, artists)
+		}
+		if i, ok := groupsByKey[key]; ok && key != "" {
+			groups[i] = append(groups[i], d)
+			continue
+		}
+		groupsByKey[key] = len(groups)
+		groups = append(groups, []*disc{d})
+	}
+
+	for _, discs := range groups {
+		for i, d := range discs {
+			if d.number == 0 {
+				d.number = i + 1
+			}
+		}
+		sort.SliceStable(discs, func(i, j int) bool { return discs[i].number < discs[j].number })
+	}
+	return groups
+}
+
+// mergeDiscGroup points the later discs of an album at the first, and numbers their tracks by disc if
+// they aren't already. groups which haven't changed since the last scan are skipped
+func mergeDiscGroup(tx *gorm.DB, c *Context, discs []*disc) error {
+	var changed bool
+	for i, d := range discs {
+		var mergedInto *int
+		if i > 0 {
+			mergedInto = &discs[0].album.ID
+		}
+		if _, ok := c.seenAlbums[d.album.ID]; ok {
+			changed = true
+		}
+		if (d.album.MergedIntoID == nil) == (mergedInto == nil) && (mergedInto == nil || *d.album.MergedIntoID == *mergedInto) {
+			continue
+		}
+		changed = true
+		if err := tx.Model(&db.Album{}).Where("id=?", d.album.ID).Update("merged_into_id", mergedInto).Error; err != nil {
+			return fmt.Errorf("update merged into: %w", err)
+		}
+	}
+	if len(discs) < 2 || !changed {
+		return nil
+	}
+
+	for _, d := range discs {
+		err := tx.Model(&db.Track{}).
+			Where("tag_album_id=? AND COALESCE(tag_disc_number, 0)<=1", d.album.ID).
+			Update("tag_disc_number", d.number).
+			Error
+		if err != nil {
+			return fmt.Errorf("update disc numbers: %w", err)
+		}
+		if d.subtitle == "" {
+			continue
+		}
+		err = tx.Model(&db.Track{}).
+			Where("tag_album_id=? AND COALESCE(tag_disc_subtitle, '')=''", d.album.ID).
+			Update("tag_disc_subtitle", d.subtitle).
+			Error
+		if err != nil {
+			return fmt.Errorf("update disc subtitles: %w", err)
+		}
+	}
+	return nil
+}
+
 //nolint:gochecknoglobals
 var coverNames = map[string]struct{}{}
 
@@ -628,6 +2242,18 @@ func init() {
 	}
 }
 
+func isLyrics(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".lrc", ".txt":
+		return true
+	}
+	return false
+}
+
+func isCueSheet(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".cue")
+}
+
 func isCover(name string) bool {
 	_, ok := coverNames[strings.ToLower(name)]
 	return ok
@@ -643,6 +2269,16 @@ func decoded(in string) string {
 	return ""
 }
 
+func firstNonZero[T comparable](vs ...T) T {
+	var z T
+	for _, v := range vs {
+		if v != z {
+			return v
+		}
+	}
+	return z
+}
+
 func durSince(t time.Time) time.Duration {
 	return time.Since(t).Truncate(10 * time.Microsecond)
 }
@@ -650,26 +2286,123 @@ func durSince(t time.Time) time.Duration {
 type Context struct {
 	errs   *multierr.Err
 	isFull bool
+	start  time.Time
+
+	// progress is a copy of the bookkeeping below, so that it can be read while the scan is running
+	progress   ScanProgress
+	progressMu sync.Mutex
 
 	seenTracks    map[int]struct{}
 	seenAlbums    map[int]struct{}
+	seenMusicDirs map[string]struct{} // with tracks
 	seenTracksNew int
+	tracksCreated []int64
+	tracksUpdated []int64 // and created, for the search index
+	albumsUpdated []int64 // with new tags
+
+	tracksMoved int
+
+	unavailableMusicDirs []string // not cleaned
 
-	tracksMissing  []int64
+	tracksMissing  []int64 // not found, and either marked missing or removed
+	tracksRemoved  []int64
 	albumsMissing  []int64
+	albumsRemoved  []int64
 	artistsMissing int
 	genresMissing  int
+
+	excluded   []Exclusion
+	excludedMu sync.Mutex
+}
+
+func newContext(isFull bool) *Context {
+	return &Context{
+		errs:          &multierr.Err{},
+		isFull:        isFull,
+		start:         time.Now(),
+		seenTracks:    map[int]struct{}{},
+		seenAlbums:    map[int]struct{}{},
+		seenMusicDirs: map[string]struct{}{},
+	}
+}
+
+// ScanProgress is a snapshot of a running scan
+type ScanProgress struct {
+	CurrentDir string
+	DirsFound  int // found so far by the walk, so this grows as the scan runs
+	DirsDone   int
+	TracksSeen int
+	TracksNew  int
+	Errors     int
+	Elapsed    time.Duration
+}
+
+// Progress returns a snapshot of the scan. it's safe to call while the scan is running
+func (c *Context) Progress() ScanProgress {
+	c.progressMu.Lock()
+	defer c.progressMu.Unlock()
+	progress := c.progress
+	progress.Elapsed = durSince(c.start)
+	return progress
+}
+
+func (c *Context) addDirFound() {
+	c.progressMu.Lock()
+	defer c.progressMu.Unlock()
+	c.progress.DirsFound++
+}
+
+func (c *Context) setCurrentDir(absPath string) {
+	if absPath == "" {
+		return
+	}
+	c.progressMu.Lock()
+	defer c.progressMu.Unlock()
+	c.progress.CurrentDir = absPath
+}
+
+func (c *Context) updateProgress(job *scanDirJob) {
+	c.progressMu.Lock()
+	defer c.progressMu.Unlock()
+	if job.absPath != "" {
+		c.progress.DirsDone++
+	}
+	c.progress.TracksSeen = len(c.seenTracks)
+	c.progress.TracksNew = c.seenTracksNew
+	c.progress.Errors = c.errs.Len()
 }
 
 func (c *Context) SeenTracks() int    { return len(c.seenTracks) }
 func (c *Context) SeenAlbums() int    { return len(c.seenAlbums) }
 func (c *Context) SeenTracksNew() int { return c.seenTracksNew }
 
+func (c *Context) TracksMoved() int    { return c.tracksMoved }
 func (c *Context) TracksMissing() int  { return len(c.tracksMissing) }
+func (c *Context) TracksRemoved() int  { return len(c.tracksRemoved) }
 func (c *Context) AlbumsMissing() int  { return len(c.albumsMissing) }
+func (c *Context) AlbumsRemoved() int  { return len(c.albumsRemoved) }
 func (c *Context) ArtistsMissing() int { return c.artistsMissing }
 func (c *Context) GenresMissing() int  { return c.genresMissing }
 
+// Exclusion is a path the scan skipped, and the rule which skipped it
+type Exclusion struct {
+	Path string
+	Rule string
+}
+
+func (c *Context) addExcluded(absPath string, rule string) {
+	log.Printf("excluding `%s` by %s", absPath, rule)
+	c.excludedMu.Lock()
+	defer c.excludedMu.Unlock()
+	c.excluded = append(c.excluded, Exclusion{absPath, rule})
+}
+
+func (c *Context) Excluded() []Exclusion {
+	c.excludedMu.Lock()
+	defer c.excludedMu.Unlock()
+	return c.excluded
+}
+
 type MultiValueMode uint8
 
 const (
@@ -683,6 +2416,7 @@ type Tag uint8
 const (
 	Genre Tag = iota
 	AlbumArtist
+	Artist
 )
 
 type MultiValueSetting struct {
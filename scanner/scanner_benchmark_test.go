@@ -3,6 +3,7 @@ package scanner_test
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"go.senan.xyz/gonic/mockfs"
 )
@@ -31,3 +32,21 @@ func BenchmarkScanFull(b *testing.B) {
 		b.StopTimer()
 	}
 }
+
+// BenchmarkScanFullSlowReads simulates tag reads on slow disks, where more workers should help
+func BenchmarkScanFullSlowReads(b *testing.B) {
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				m := mockfs.NewWithWorkers(b, workers)
+				m.SetReadDelay(500 * time.Microsecond)
+				for i := 0; i < 5; i++ {
+					m.AddItemsPrefix(fmt.Sprintf("t-%d", i))
+				}
+				b.StartTimer()
+				m.ScanAndClean()
+			}
+		})
+	}
+}
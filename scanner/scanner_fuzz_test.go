@@ -57,6 +57,9 @@ func fuzzStruct(taken int, data []byte, seed int64, dest interface{}) {
 		}
 
 		take := int(r.Float64() * 12)
+		if take == 0 {
+			continue
+		}
 		b := make([]byte, take)
 		for i := range b {
 			b[i] = data[(i+taken)%len(data)]
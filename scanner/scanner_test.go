@@ -8,8 +8,10 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -17,6 +19,7 @@ import (
 	"go.senan.xyz/gonic/db"
 	"go.senan.xyz/gonic/mockfs"
 	"go.senan.xyz/gonic/multierr"
+	"go.senan.xyz/gonic/playlist"
 	"go.senan.xyz/gonic/scanner"
 )
 
@@ -67,6 +70,53 @@ func TestWithExcludePattern(t *testing.T) {
 	assert.Equal(artists, 2)                                         // not all artists
 }
 
+func TestGonicIgnore(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.WriteFile(".gonicignore", "track-0.flac\n")
+	m.WriteFile("artist-0/.gonicignore", "/album-1/\n!track-0.flac\n")
+	m.WriteFile("artist-2/album-2/.nomedia", "")
+
+	ctx := m.ScanAndClean()
+
+	trackCount := func(artist string) int {
+		var count int
+		require.NoError(m.DB().
+			Model(&db.Track{}).
+			Joins("JOIN albums ON albums.id=tracks.album_id").
+			Where("albums.left_path=?", artist+"/").
+			Count(&count).
+			Error)
+		return count
+	}
+	require.Equal(6, trackCount("artist-0")) // album-1 excluded, track-0 back in for the rest of artist-0
+	require.Equal(6, trackCount("artist-1")) // track-0 excluded everywhere else
+	require.Equal(4, trackCount("artist-2")) // and album-2 skipped by its marker
+
+	rules := map[string]string{}
+	for _, excl := range ctx.Excluded() {
+		rules[excl.Path] = excl.Rule
+	}
+	require.Equal(filepath.Join(m.TmpDir(), "artist-0", ".gonicignore")+":1: /album-1/", rules[filepath.Join(m.TmpDir(), "artist-0", "album-1")])
+	require.Equal(filepath.Join(m.TmpDir(), ".gonicignore")+":1: track-0.flac", rules[filepath.Join(m.TmpDir(), "artist-1", "album-0", "track-0.flac")])
+	require.Contains(rules[filepath.Join(m.TmpDir(), "artist-2", "album-2")], ".nomedia")
+
+	// rules still apply when only part of the tree is scanned
+	_, err := m.Scanner().ScanAndClean(scanner.ScanOptions{Paths: []string{filepath.Join(m.TmpDir(), "artist-1")}})
+	require.NoError(err)
+	require.Equal(6, trackCount("artist-1"))
+
+	// and removing them brings the paths back
+	m.WriteFile(".gonicignore", "")
+	m.RemoveAll("artist-2/album-2/.nomedia")
+	m.ScanAndClean()
+	require.Equal(9, trackCount("artist-1"))
+	require.Equal(9, trackCount("artist-2"))
+}
+
 func TestParentID(t *testing.T) {
 	t.Parallel()
 	require := require.New(t)
@@ -105,6 +155,115 @@ func TestUpdatedCover(t *testing.T) {
 	assert.Equal(album.Cover, "cover.jpg")                                                                  // album has cover
 }
 
+func TestEmbeddedCover(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.SetTags("artist-0/album-0/track-0.flac", func(tags *mockfs.Tags) error {
+		tags.RawPicture = []byte("picture")
+		return nil
+	})
+	m.ScanAndClean()
+
+	var album db.Album
+	require.NoError(m.DB().Where("left_path=? AND right_path=?", "artist-0/", "album-0").Find(&album).Error)
+	require.Equal("", album.Cover)
+	require.Equal("track-0.flac", album.EmbeddedCover)
+	require.True(album.HasCover())
+
+	var other db.Album
+	require.NoError(m.DB().Where("left_path=? AND right_path=?", "artist-0/", "album-1").Find(&other).Error)
+	require.Equal("", other.EmbeddedCover)
+	require.False(other.HasCover())
+
+	m.SetTags("artist-0/album-0/track-0.flac", func(tags *mockfs.Tags) error {
+		tags.RawPicture = nil
+		return nil
+	})
+	m.ScanAndClean()
+
+	require.NoError(m.DB().Where("id=?", album.ID).Find(&album).Error)
+	require.Equal("", album.EmbeddedCover)
+}
+
+func TestLyrics(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.SetTags("artist-0/album-0/track-0.flac", func(tags *mockfs.Tags) error {
+		tags.RawLyrics = []string{"embedded lyrics"}
+		return nil
+	})
+	lrcPath := filepath.Join(m.TmpDir(), "artist-0/album-0/track-1.lrc")
+	require.NoError(os.WriteFile(lrcPath, []byte("[00:01.00]sidecar lyrics\n"), 0o600))
+	m.ScanAndClean()
+
+	lyricsFor := func(filename string) []*db.TrackLyrics {
+		var lyrics []*db.TrackLyrics
+		require.NoError(m.DB().
+			Joins("JOIN tracks ON tracks.id=track_lyrics.track_id").
+			Joins("JOIN albums ON albums.id=tracks.album_id").
+			Where("albums.left_path=? AND albums.right_path=? AND tracks.filename=?", "artist-0/", "album-0", filename).
+			Find(&lyrics).
+			Error)
+		return lyrics
+	}
+
+	lyrics := lyricsFor("track-0.flac")
+	require.Len(lyrics, 1)
+	require.Equal("", lyrics[0].Source)
+	require.Equal("embedded lyrics", lyrics[0].Text)
+
+	lyrics = lyricsFor("track-1.flac")
+	require.Len(lyrics, 1)
+	require.Equal("track-1.lrc", lyrics[0].Source)
+	require.Equal("[00:01.00]sidecar lyrics\n", lyrics[0].Text)
+
+	require.Empty(lyricsFor("track-2.flac"))
+
+	// a changed sidecar is picked up even though the track itself didn't change
+	require.NoError(os.WriteFile(lrcPath, []byte("[00:01.00]new lyrics\n"), 0o600))
+	later := time.Now().Add(time.Hour)
+	require.NoError(os.Chtimes(lrcPath, later, later))
+	m.ScanAndClean()
+
+	lyrics = lyricsFor("track-1.flac")
+	require.Len(lyrics, 1)
+	require.Equal("[00:01.00]new lyrics\n", lyrics[0].Text)
+
+	// and a removed one is forgotten
+	require.NoError(os.Remove(lrcPath))
+	m.ScanAndClean()
+	require.Empty(lyricsFor("track-1.flac"))
+
+	// as is one copied in with an old mod time
+	txtPath := filepath.Join(m.TmpDir(), "artist-0/album-0/track-2.txt")
+	require.NoError(os.WriteFile(txtPath, []byte("copied lyrics\n"), 0o600))
+	earlier := time.Now().Add(-24 * time.Hour)
+	require.NoError(os.Chtimes(txtPath, earlier, earlier))
+	m.ScanAndClean()
+
+	lyrics = lyricsFor("track-2.flac")
+	require.Len(lyrics, 1)
+	require.Equal("track-2.txt", lyrics[0].Source)
+
+	// a blank one is remembered, so its track isn't read again on every scan
+	require.NoError(os.WriteFile(filepath.Join(m.TmpDir(), "artist-0/album-0/track-0.lrc"), []byte(" \n\n"), 0o600))
+	m.ScanAndClean()
+
+	var track db.Track
+	require.NoError(m.DB().Where("filename=?", "track-0.flac").Joins("JOIN albums ON albums.id=tracks.album_id").Where("albums.left_path=? AND albums.right_path=?", "artist-0/", "album-0").Find(&track).Error)
+	m.ScanAndClean()
+
+	var rescanned db.Track
+	require.NoError(m.DB().Where("id=?", track.ID).Find(&rescanned).Error)
+	require.Equal(track.UpdatedAt, rescanned.UpdatedAt)
+}
+
 func TestCoverBeforeTracks(t *testing.T) {
 	t.Parallel()
 	require := require.New(t)
@@ -537,6 +696,241 @@ func TestTagErrors(t *testing.T) {
 	require.Equal(0, ctx.SeenTracksNew())                // we have no new tracks
 }
 
+func TestScanErrorsSaved(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItemsWithCovers()
+	m.SetTags("artist-1/album-0/track-0.flac", func(tags *mockfs.Tags) error {
+		return scanner.ErrReadingTags
+	})
+	m.SetTags("artist-1/album-1/track-0.flac", func(tags *mockfs.Tags) error {
+		return scanner.ErrReadingTags
+	})
+	_, err := m.ScanAndCleanErr()
+	require.Error(err)
+
+	var scanErrs []*db.ScanError
+	require.NoError(m.DB().Order("path").Find(&scanErrs).Error)
+	require.Len(scanErrs, 2)
+	require.Equal(filepath.Join(m.TmpDir(), "artist-1/album-0/track-0.flac"), scanErrs[0].Path)
+	require.Equal(db.ScanErrorKindTags, scanErrs[0].Kind)
+	require.Contains(scanErrs[0].Message, scanner.ErrReadingTags.Error())
+	require.False(scanErrs[0].ScanTime.IsZero())
+
+	// fixed files are cleared by the next scan
+	m.SetTags("artist-1/album-0/track-0.flac", func(tags *mockfs.Tags) error { return nil })
+	_, err = m.ScanAndCleanErr()
+	require.Error(err)
+	require.NoError(m.DB().Find(&scanErrs).Error)
+	require.Len(scanErrs, 1)
+	require.Equal(filepath.Join(m.TmpDir(), "artist-1/album-1/track-0.flac"), scanErrs[0].Path)
+
+	// including a scan of just their path
+	m.SetTags("artist-1/album-1/track-0.flac", func(tags *mockfs.Tags) error { return nil })
+	_, err = m.Scanner().ScanAndClean(scanner.ScanOptions{Paths: []string{scanErrs[0].Path}})
+	require.NoError(err)
+	require.NoError(m.DB().Find(&scanErrs).Error)
+	require.Len(scanErrs, 0)
+
+	_, err = m.Scanner().ScanAndClean(scanner.ScanOptions{Paths: []string{t.TempDir()}})
+	require.ErrorIs(err, scanner.ErrNotInMusicDir)
+}
+
+func TestCleanUnavailableMusicDir(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.NewWithDirs(t, []string{"m-0", "m-1"})
+
+	m.AddItemsPrefix("m-0")
+	m.AddItemsPrefix("m-1")
+	m.ScanAndClean()
+
+	trackCount := func() int {
+		var count int
+		require.NoError(m.DB().Model(&db.Track{}).Count(&count).Error)
+		return count
+	}
+	notCleaned := func() []string {
+		var paths []string
+		require.NoError(m.DB().Model(&db.ScanError{}).Where("message LIKE ?", scanner.ErrNotCleaned.Error()+"%").Pluck("path", &paths).Error)
+		return paths
+	}
+	require.Equal(54, trackCount())
+
+	// an unmounted drive, while the other music dir is still cleaned
+	m.RemoveAll("m-1")
+	m.RemoveAll("m-0/artist-0/album-0/track-0.flac")
+	_, err := m.ScanAndCleanErr()
+	require.Error(err)
+	require.Equal(53, trackCount())
+	require.Equal([]string{filepath.Join(m.TmpDir(), "m-1")}, notCleaned())
+
+	// or its empty mount point
+	require.NoError(os.Mkdir(filepath.Join(m.TmpDir(), "m-1"), os.ModePerm))
+	_, err = m.ScanAndCleanErr()
+	require.Error(err)
+	require.Equal(53, trackCount())
+	require.Equal([]string{filepath.Join(m.TmpDir(), "m-1")}, notCleaned())
+
+	// and back again
+	m.AddItemsPrefix("m-1")
+	m.ScanAndClean()
+	require.Equal(53, trackCount())
+	require.Empty(notCleaned())
+
+	// a music dir with only some of its tracks left is cleaned as usual
+	m.RemoveAll("m-1/artist-0")
+	m.RemoveAll("m-1/artist-1")
+	m.ScanAndClean()
+	require.Equal(35, trackCount())
+}
+
+func TestScanPaths(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.ScanAndClean()
+
+	titleOf := func(path string) string {
+		var track db.Track
+		require.NoError(m.DB().
+			Joins("JOIN albums ON albums.id=tracks.album_id").
+			Where("albums.left_path || albums.right_path || '/' || tracks.filename=?", path).
+			Find(&track).
+			Error)
+		return track.TagTitle
+	}
+	trackCount := func() int {
+		var count int
+		require.NoError(m.DB().Model(&db.Track{}).Count(&count).Error)
+		return count
+	}
+	retag := func(path string) {
+		m.SetTags(path, func(tags *mockfs.Tags) error {
+			tags.RawArtist = "artist-0"
+			tags.RawAlbumArtist = "artist-0"
+			tags.RawAlbum = "album-0"
+			tags.RawTitle = "retagged"
+			return nil
+		})
+	}
+
+	// only the folder of the path is scanned, whether it's a folder or a track
+	retag("artist-0/album-0/track-0.flac")
+	retag("artist-1/album-0/track-0.flac")
+	_, err := m.Scanner().ScanAndClean(scanner.ScanOptions{Paths: []string{filepath.Join(m.TmpDir(), "artist-0/album-0")}})
+	require.NoError(err)
+	require.Equal("retagged", titleOf("artist-0/album-0/track-0.flac"))
+	require.Equal("title-0", titleOf("artist-1/album-0/track-0.flac"))
+
+	_, err = m.Scanner().ScanAndClean(scanner.ScanOptions{Paths: []string{filepath.Join(m.TmpDir(), "artist-1/album-0/track-1.flac")}})
+	require.NoError(err)
+	require.Equal("retagged", titleOf("artist-1/album-0/track-0.flac"))
+
+	// removals are only cleaned under the path, and a path which is gone cleans up after itself
+	m.RemoveAll("artist-0/album-1")
+	m.RemoveAll("artist-2/album-2/track-2.flac")
+	_, err = m.Scanner().ScanAndClean(scanner.ScanOptions{Paths: []string{filepath.Join(m.TmpDir(), "artist-2/album-2/track-2.flac")}})
+	require.NoError(err)
+	require.Equal(26, trackCount())
+
+	_, err = m.Scanner().ScanAndClean(scanner.ScanOptions{Paths: []string{filepath.Join(m.TmpDir(), "artist-0/album-1")}})
+	require.NoError(err)
+	require.Equal(23, trackCount())
+
+	var album db.Album
+	require.True(m.DB().Where("left_path=? AND right_path=?", "artist-0/", "album-1").Find(&album).RecordNotFound())
+}
+
+func TestWatchRemoveAndRename(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.ScanAndClean()
+	m.Scanner().StartWatchForTest(t)
+
+	abs := func(path string) string { return filepath.Join(m.TmpDir(), path) }
+	hasAlbum := func(leftPath, rightPath string) bool {
+		return !m.DB().Where("left_path=? AND right_path=?", leftPath, rightPath).Find(&db.Album{}).RecordNotFound()
+	}
+	trackCount := func() int {
+		var count int
+		require.NoError(m.DB().Model(&db.Track{}).Count(&count).Error)
+		return count
+	}
+	require.Contains(m.Scanner().WatchedForTest(t), abs("artist-0/album-0"))
+
+	// a removed folder is cleaned, but nothing else is, even what's gone without the watcher seeing
+	m.RemoveAll("artist-0/album-0")
+	m.RemoveAll("artist-2/album-2")
+	m.Scanner().WatchScanForTest(nil, []string{abs("artist-0/album-0")})
+	require.False(hasAlbum("artist-0/", "album-0"))
+	require.True(hasAlbum("artist-0/", "album-1"))
+	require.True(hasAlbum("artist-2/", "album-2"))
+	require.Equal(24, trackCount())
+	require.NotContains(m.Scanner().WatchedForTest(t), abs("artist-0/album-0"))
+	require.Contains(m.Scanner().WatchedForTest(t), abs("artist-0/album-1"))
+
+	// a rename is a remove of the old folder and its subfolders, and a create of the new
+	m.Rename("artist-1", "artist-renamed")
+	m.Scanner().WatchScanForTest([]string{abs("artist-renamed")}, []string{abs("artist-1")})
+	for _, album := range []string{"album-0", "album-1", "album-2"} {
+		require.False(hasAlbum("artist-1/", album))
+		require.True(hasAlbum("artist-renamed/", album))
+	}
+	require.True(hasAlbum("artist-2/", "album-2"))
+	require.Equal(24, trackCount())
+
+	watched := m.Scanner().WatchedForTest(t)
+	for _, path := range []string{"artist-1", "artist-1/album-0", "artist-1/album-2"} {
+		require.NotContains(watched, abs(path))
+	}
+	for _, path := range []string{"artist-renamed", "artist-renamed/album-0", "artist-renamed/album-2"} {
+		require.Contains(watched, abs(path))
+	}
+}
+
+func TestWatchUpdatesSearchIndex(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItemsGlob("artist-0/album-0/track-*")
+	m.ScanAndClean()
+	if !m.DB().HasSearchIndex() {
+		t.Skip("the search index needs the sqlite_fts5 build tag")
+	}
+	m.Scanner().StartWatchForTest(t)
+
+	search := func(query string) []int {
+		fts := db.SearchTable("tracks")
+		var ids []int
+		require.NoError(m.DB().Table(fts).Where(fts+" MATCH ?", db.SearchMatch(query)).Pluck("rowid", &ids).Error)
+		return ids
+	}
+
+	m.AddTrack("artist-0/album-0/track-new.flac")
+	m.SetTags("artist-0/album-0/track-new.flac", func(tags *mockfs.Tags) error {
+		tags.RawTitle = "Hyperballad"
+		return nil
+	})
+	m.Scanner().WatchScanForTest([]string{filepath.Join(m.TmpDir(), "artist-0/album-0")}, nil)
+
+	var track db.Track
+	require.NoError(m.DB().Where("filename=?", "track-new.flac").Find(&track).Error)
+	require.Equal([]int{track.ID}, search("hyperballad"))
+
+	m.RemoveAll("artist-0/album-0/track-new.flac")
+	m.Scanner().WatchScanForTest(nil, []string{filepath.Join(m.TmpDir(), "artist-0/album-0/track-new.flac")})
+	require.Empty(search("hyperballad"))
+}
+
 // https://github.com/sentriz/gonic/issues/185#issuecomment-1050092128
 func TestCompilationAlbumWithoutAlbumArtist(t *testing.T) {
 	t.Parallel()
@@ -567,7 +961,7 @@ func TestCompilationAlbumWithoutAlbumArtist(t *testing.T) {
 	require.Equal(5, trackCount)
 
 	var artists []*db.Artist
-	require.NoError(m.DB().Find(&artists).Error)
+	require.NoError(m.DB().Where("id IN (SELECT artist_id FROM album_artists)").Find(&artists).Error)
 	require.Equal(1, len(artists))             // we only have one album artist
 	require.Equal("artist 0", artists[0].Name) // it came from the first track's fallback to artist tag
 
@@ -576,6 +970,10 @@ func TestCompilationAlbumWithoutAlbumArtist(t *testing.T) {
 	require.Equal(1, len(artistAlbums)) // the artist has one album
 	require.Equal(pathAlbum, artistAlbums[0].RightPath)
 	require.Equal(pathArtist+"/", artistAlbums[0].LeftPath)
+
+	var trackArtistCount int
+	require.NoError(m.DB().Model(&db.TrackArtist{}).Count(&trackArtistCount).Error)
+	require.Equal(5, trackArtistCount) // but each track keeps its own artist
 }
 
 func TestIncrementalScanNoChangeNoUpdatedAt(t *testing.T) {
@@ -633,13 +1031,13 @@ func TestNoOrphanedGenres(t *testing.T) {
 	m.SetTags("artist-1/album-2/track-1.flac", func(tags *mockfs.Tags) error { tags.RawGenre = "genre-g;genre-h"; return nil })
 	m.ScanAndClean()
 
+	// artist-2 is left, so that the music dir doesn't look unavailable
 	m.RemoveAll("artist-0")
 	m.RemoveAll("artist-1")
-	m.RemoveAll("artist-2")
 	m.ScanAndClean()
 
 	var genreCount int
-	require.NoError(m.DB().Model(&db.Genre{}).Count(&genreCount).Error)
+	require.NoError(m.DB().Model(&db.Genre{}).Where("name LIKE 'genre-%'").Count(&genreCount).Error)
 	require.Equal(0, genreCount)
 }
 
@@ -668,7 +1066,7 @@ func TestMultiArtistSupport(t *testing.T) {
 	m.ScanAndClean()
 
 	var artists []*db.Artist
-	require.NoError(m.DB().Find(&artists).Error)
+	require.NoError(m.DB().Where("id IN (SELECT artist_id FROM album_artists)").Find(&artists).Error)
 	require.Len(artists, 3) // alan, liz, mercury
 
 	var albumArtists []*db.AlbumArtist
@@ -708,7 +1106,7 @@ func TestMultiArtistSupport(t *testing.T) {
 
 	m.ScanAndClean()
 
-	require.NoError(m.DB().Find(&artists).Error)
+	require.NoError(m.DB().Where("id IN (SELECT artist_id FROM album_artists)").Find(&artists).Error)
 	require.Len(artists, 2) // alan, liz
 
 	require.NoError(m.DB().Find(&albumArtists).Error)
@@ -764,7 +1162,7 @@ func TestMultiArtistPreload(t *testing.T) {
 	}
 
 	var artists []*db.Artist
-	require.NoError(m.DB().Preload("Albums").Find(&artists).Error)
+	require.NoError(m.DB().Where("id IN (SELECT artist_id FROM album_artists)").Preload("Albums").Find(&artists).Error)
 	require.Equal(3, len(artists))
 
 	for _, artist := range artists {
@@ -778,3 +1176,741 @@ func TestMultiArtistPreload(t *testing.T) {
 		}
 	}
 }
+
+func TestScanWorkersSameResult(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	type row struct {
+		ID                      int
+		LeftPath, RightPath     string
+		Filename, AlbumTagTitle string
+	}
+	state := func(workers int) ([]row, *scanner.Context, int) {
+		m := mockfs.NewWithWorkers(t, workers)
+		m.AddItemsWithCovers()
+		m.SetTags("artist-1/album-1/track-0.flac", func(tags *mockfs.Tags) error {
+			return scanner.ErrReadingTags
+		})
+		ctx, err := m.ScanAndCleanErr()
+		var errs *multierr.Err
+		require.ErrorAs(err, &errs)
+
+		var table []row
+		require.NoError(m.DB().
+			Select("tracks.id, albums.left_path, albums.right_path, tracks.filename, albums.tag_title album_tag_title").
+			Model(db.Track{}).
+			Joins("JOIN albums ON albums.id=tracks.album_id").
+			Order("tracks.id").
+			Scan(&table).
+			Error)
+		return table, ctx, errs.Len()
+	}
+
+	// reading tags concurrently mustn't change what's written, or the order ids are given out in, or
+	// what the scan counted and failed on
+	seqState, seqCtx, seqErrs := state(1)
+	parState, parCtx, parErrs := state(8)
+	require.Equal(seqState, parState)
+	require.Equal(seqCtx.SeenTracks(), parCtx.SeenTracks())
+	require.Equal(seqCtx.SeenTracksNew(), parCtx.SeenTracksNew())
+	require.Equal(seqCtx.SeenAlbums(), parCtx.SeenAlbums())
+	require.Equal(seqErrs, parErrs)
+}
+
+func TestScanProgress(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.SetReadDelay(time.Millisecond)
+
+	_, ok := m.Scanner().Progress()
+	require.False(ok) // not scanning yet
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if progress, ok := m.Scanner().Progress(); ok {
+				assert.LessOrEqual(t, progress.DirsDone, progress.DirsFound)
+				assert.LessOrEqual(t, progress.TracksNew, progress.TracksSeen)
+			}
+		}
+	}()
+
+	ctx := m.ScanAndClean()
+	done <- struct{}{}
+	<-done
+
+	_, ok = m.Scanner().Progress()
+	require.False(ok) // finished scanning
+
+	progress := ctx.Progress()
+	require.Equal(12, progress.DirsFound) // all folders bar the root
+	require.Equal(12, progress.DirsDone)
+	require.Equal(m.NumTracks(), progress.TracksSeen)
+	require.Equal(m.NumTracks(), progress.TracksNew)
+	require.Equal(0, progress.Errors)
+	require.NotZero(progress.CurrentDir)
+	require.NotZero(progress.Elapsed)
+}
+
+func TestMovedTrackKeepsUserData(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.SetTags("artist-0/album-0/track-0.flac", func(tags *mockfs.Tags) error {
+		tags.RawBrainzID = "mbid-track-0"
+		return nil
+	})
+	m.ScanAndClean()
+
+	user := db.User{Name: "user", Password: "password"}
+	require.NoError(m.DB().Save(&user).Error)
+
+	var track db.Track
+	require.NoError(m.DB().Where("tag_brainz_id=?", "mbid-track-0").Find(&track).Error)
+	require.NoError(m.DB().Save(&db.TrackStar{UserID: user.ID, TrackID: track.ID, StarDate: time.Now()}).Error)
+	require.NoError(m.DB().Save(&db.TrackRating{UserID: user.ID, TrackID: track.ID, Rating: 4}).Error)
+	require.NoError(m.DB().Save(&db.Bookmark{UserID: user.ID, EntryIDType: "tr", EntryID: track.ID, Position: 10}).Error)
+	require.NoError(m.DB().Save(&db.AlbumStar{UserID: user.ID, AlbumID: track.AlbumID, StarDate: time.Now()}).Error)
+	require.NoError(m.DB().Save(&db.Listen{UserID: user.ID, TrackID: track.ID, AlbumID: track.AlbumID, Time: time.Now()}).Error)
+	require.NoError(m.DB().Save(&db.TrackPlay{UserID: user.ID, TrackID: track.ID, Count: 3}).Error)
+
+	m.Rename("artist-0/album-0", "artist-0/album-0-renamed")
+	ctx := m.ScanAndClean()
+	require.Equal(3, ctx.TracksMissing())
+	require.Equal(1, ctx.TracksMoved()) // only one track had something to match on
+
+	var moved db.Track
+	require.NoError(m.DB().Where("tag_brainz_id=?", "mbid-track-0").Find(&moved).Error)
+	require.NotEqual(track.ID, moved.ID)
+
+	var star db.TrackStar
+	require.NoError(m.DB().Where("user_id=? AND track_id=?", user.ID, moved.ID).Find(&star).Error)
+	var rating db.TrackRating
+	require.NoError(m.DB().Where("user_id=? AND track_id=?", user.ID, moved.ID).Find(&rating).Error)
+	require.Equal(4, rating.Rating)
+	var bookmark db.Bookmark
+	require.NoError(m.DB().Where("user_id=? AND entry_id=?", user.ID, moved.ID).Find(&bookmark).Error)
+	require.Equal(10, bookmark.Position)
+	var albumStar db.AlbumStar
+	require.NoError(m.DB().Where("user_id=? AND album_id=?", user.ID, moved.AlbumID).Find(&albumStar).Error)
+	var listen db.Listen
+	require.NoError(m.DB().Where("user_id=? AND album_id=?", user.ID, moved.AlbumID).Find(&listen).Error)
+	require.Equal(moved.ID, listen.TrackID)
+	var play db.TrackPlay
+	require.NoError(m.DB().Where("user_id=? AND track_id=?", user.ID, moved.ID).Find(&play).Error)
+	require.Equal(3, play.Count)
+}
+
+func TestMovedTrackMatchedByHash(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItems()
+	require.NoError(os.WriteFile(filepath.Join(m.TmpDir(), "artist-0/album-0/track-0.flac"), []byte("some audio"), 0o600))
+	m.ScanAndClean()
+
+	user := db.User{Name: "user", Password: "password"}
+	require.NoError(m.DB().Save(&user).Error)
+
+	var track db.Track
+	require.NoError(m.DB().Preload("Album").Where("filename=?", "track-0.flac").Where("size>0").Find(&track).Error)
+	require.NoError(m.DB().Save(&db.TrackStar{UserID: user.ID, TrackID: track.ID, StarDate: time.Now()}).Error)
+
+	plPath := playlist.NewPath(user.ID, "pl")
+	require.NoError(m.PlaylistStore().Write(plPath, &playlist.Playlist{UserID: user.ID, Name: "pl", Items: []string{track.AbsPath()}}))
+
+	m.Rename("artist-0/album-0/track-0.flac", "artist-1/album-0/track-renamed.flac")
+	ctx := m.ScanAndClean()
+	require.Equal(1, ctx.TracksMissing())
+	require.Equal(1, ctx.TracksMoved())
+
+	var moved db.Track
+	require.NoError(m.DB().Preload("Album").Where("filename=?", "track-renamed.flac").Find(&moved).Error)
+
+	var star db.TrackStar
+	require.NoError(m.DB().Where("user_id=? AND track_id=?", user.ID, moved.ID).Find(&star).Error)
+
+	pl, err := m.PlaylistStore().Read(plPath)
+	require.NoError(err)
+	require.Equal([]string{moved.AbsPath()}, pl.Items)
+}
+
+func TestMissingKeptForGracePeriod(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.NewWithMissingGracePeriod(t, time.Hour)
+
+	m.AddItems()
+	m.SetTags("artist-1/album-0/track-0.flac", func(tags *mockfs.Tags) error {
+		tags.RawBrainzID = "mbid-track-0"
+		return nil
+	})
+	m.ScanAndClean()
+
+	user := db.User{Name: "user", Password: "password"}
+	require.NoError(m.DB().Save(&user).Error)
+
+	var track db.Track
+	require.NoError(m.DB().Joins("JOIN albums ON albums.id=tracks.album_id").Where("albums.left_path=? AND albums.right_path=? AND tracks.filename=?", "artist-0/", "album-0", "track-0.flac").Find(&track).Error)
+	require.NoError(m.DB().Save(&db.TrackStar{UserID: user.ID, TrackID: track.ID, StarDate: time.Now()}).Error)
+
+	count := func(model interface{}, where string) int {
+		var count int
+		require.NoError(m.DB().Model(model).Where(where).Count(&count).Error)
+		return count
+	}
+	missingSince := func() *time.Time {
+		var missing db.Track
+		require.NoError(m.DB().Where("id=?", track.ID).Find(&missing).Error)
+		return missing.MissingSince
+	}
+
+	// a folder goes missing, and is kept
+	m.RemoveAll("artist-0/album-0")
+	ctx := m.ScanAndClean()
+	require.Equal(3, ctx.TracksMissing())
+	require.Equal(0, ctx.TracksRemoved())
+	require.Equal(1, ctx.AlbumsMissing())
+	require.Equal(0, ctx.AlbumsRemoved())
+	require.Equal(27, count(&db.Track{}, ""))
+	require.Equal(3, count(&db.Track{}, "missing_since IS NOT NULL"))
+	require.Equal(1, count(&db.Album{}, "missing_since IS NOT NULL"))
+	require.Equal(1, count(&db.TrackStar{}, ""))
+
+	// without it being missing for any less long after the next scan
+	since := missingSince()
+	require.NotNil(since)
+	m.ScanAndClean()
+	require.True(since.Equal(*missingSince()))
+
+	// and comes back as it was
+	m.AddItemsGlob("artist-0/album-0/*")
+	m.ScanAndClean()
+	require.Nil(missingSince())
+	require.Equal(0, count(&db.Track{}, "missing_since IS NOT NULL"))
+	require.Equal(0, count(&db.Album{}, "missing_since IS NOT NULL"))
+	require.Equal(1, count(&db.TrackStar{}, ""))
+
+	// a moved track isn't kept, since it was found elsewhere
+	m.Rename("artist-1/album-0/track-0.flac", "artist-1/album-1/track-moved.flac")
+	ctx = m.ScanAndClean()
+	require.Equal(1, ctx.TracksMoved())
+	require.Equal(1, ctx.TracksRemoved())
+	require.Equal(27, count(&db.Track{}, ""))
+	require.Equal(0, count(&db.Track{}, "missing_since IS NOT NULL"))
+
+	// the folder goes again, and is removed once it's been missing for longer than the grace period
+	m.RemoveAll("artist-0/album-0")
+	m.ScanAndClean()
+	for _, model := range []interface{}{&db.Track{}, &db.Album{}} {
+		require.NoError(m.DB().Model(model).Where("missing_since IS NOT NULL").UpdateColumn("missing_since", time.Now().Add(-2*time.Hour)).Error)
+	}
+	ctx = m.ScanAndClean()
+	require.Equal(3, ctx.TracksRemoved())
+	require.Equal(1, ctx.AlbumsRemoved())
+	require.Equal(24, count(&db.Track{}, ""))
+	require.Equal(0, count(&db.Track{}, "missing_since IS NOT NULL"))
+	require.Equal(0, count(&db.Album{}, "missing_since IS NOT NULL"))
+	require.Equal(0, count(&db.TrackStar{}, ""))
+}
+
+func TestReplayGain(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.SetTags("artist-0/album-0/track-0.flac", func(tags *mockfs.Tags) error {
+		tags.RawReplayGainTrackGain = -6.5
+		tags.RawReplayGainTrackPeak = 0.9
+		tags.RawReplayGainAlbumGain = -7.25
+		tags.RawReplayGainAlbumPeak = 0.95
+		return nil
+	})
+	m.SetTags("artist-0/album-0/track-1.flac", func(tags *mockfs.Tags) error {
+		tags.RawR128TrackGain = -512
+		tags.RawR128AlbumGain = 256
+		return nil
+	})
+	m.ScanAndClean()
+
+	trackFor := func(filename string) *db.Track {
+		var track db.Track
+		require.NoError(m.DB().
+			Joins("JOIN albums ON albums.id=tracks.album_id").
+			Where("albums.left_path=? AND albums.right_path=? AND tracks.filename=?", "artist-0/", "album-0", filename).
+			Find(&track).
+			Error)
+		return &track
+	}
+
+	track := trackFor("track-0.flac")
+	require.Equal(float32(-6.5), track.ReplayGainTrackGain)
+	require.Equal(float32(0.9), track.ReplayGainTrackPeak)
+	require.Equal(float32(-7.25), track.ReplayGainAlbumGain)
+	require.Equal(float32(0.95), track.ReplayGainAlbumPeak)
+	require.Zero(track.R128TrackGain)
+
+	track = trackFor("track-1.flac")
+	require.Zero(track.ReplayGainTrackGain)
+	require.Equal(-512, track.R128TrackGain)
+	require.Equal(256, track.R128AlbumGain)
+}
+
+func TestExtendedTags(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.SetTags("artist-0/album-0/track-0.flac", func(tags *mockfs.Tags) error {
+		tags.RawComposer = "composer"
+		tags.RawConductor = "conductor"
+		tags.RawLyricist = "lyricist"
+		tags.RawComment = "comment"
+		tags.RawBPM = 128
+		tags.RawDiscSubtitle = "disc subtitle"
+		tags.RawLabel = "label"
+		tags.RawCatalogNumber = "CAT-001"
+		tags.RawCompilation = true
+		tags.RawReleaseTypes = []string{"album", "live"}
+		tags.RawOriginalDate = "1997-05-21"
+		return nil
+	})
+	m.ScanAndClean()
+
+	var album db.Album
+	require.NoError(m.DB().
+		Where("left_path=? AND right_path=?", "artist-0/", "album-0").
+		Preload("Tracks", "filename=?", "track-0.flac").
+		Find(&album).
+		Error)
+	require.Equal("label", album.TagLabel)
+	require.Equal("CAT-001", album.TagCatalogNumber)
+	require.True(album.TagCompilation)
+	require.Equal([]string{"album", "live"}, album.ReleaseTypes())
+	require.Equal("1997-05-21", album.TagOriginalDate)
+
+	require.Len(album.Tracks, 1)
+	track := album.Tracks[0]
+	require.Equal("composer", track.TagComposer)
+	require.Equal("conductor", track.TagConductor)
+	require.Equal("lyricist", track.TagLyricist)
+	require.Equal("comment", track.TagComment)
+	require.Equal(128, track.TagBPM)
+	require.Equal("disc subtitle", track.TagDiscSubtitle)
+
+	var other db.Album
+	require.NoError(m.DB().Where("left_path=? AND right_path=?", "artist-0/", "album-1").Find(&other).Error)
+	require.False(other.TagCompilation)
+	require.Empty(other.ReleaseTypes())
+}
+
+func TestArtistBrainzID(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	const (
+		idGrunge  = "5b11f4ce-a62d-471e-81fc-a69a8278c7da"
+		idSixties = "9282c8b4-ca0b-4c6b-b7e3-4f7762dfc4d6"
+	)
+	setArtist := func(path string, name string, brainzIDs ...string) {
+		m.AddTrack(path)
+		m.SetTags(path, func(tags *mockfs.Tags) error {
+			tags.RawArtist = name
+			tags.RawAlbumArtist = name
+			tags.RawAlbumArtistBrainzIDs = brainzIDs
+			tags.RawAlbum = filepath.Base(filepath.Dir(path))
+			tags.RawTitle = filepath.Base(path)
+			return nil
+		})
+	}
+
+	// a name only artist takes the first id it sees, so they keep their user data
+	setArtist("a/untagged/track.flac", "Nirvana")
+	m.ScanAndClean()
+	var untagged db.Artist
+	require.NoError(m.DB().Where("name=?", "Nirvana").Find(&untagged).Error)
+	require.Equal("", untagged.BrainzID)
+
+	setArtist("a/bleach/track.flac", "Nirvana", idGrunge)
+	setArtist("a/local anaesthetic/track.flac", "Nirvana", idSixties)
+	m.ScanAndClean()
+
+	var artists []*db.Artist
+	require.NoError(m.DB().Where("name=?", "Nirvana").Order("id").Find(&artists).Error)
+	require.Len(artists, 2)
+	require.Equal(untagged.ID, artists[0].ID)
+	require.ElementsMatch([]string{idGrunge, idSixties}, []string{artists[0].BrainzID, artists[1].BrainzID})
+
+	// untagged albums fall back to one of the artists with the name
+	var albums []*db.Album
+	require.NoError(m.DB().Preload("Artists").Order("right_path").Find(&albums, "right_path IN (?)", []string{"bleach", "local anaesthetic", "untagged"}).Error)
+	require.Len(albums, 3)
+	require.NotEqual(albums[0].Artists[0].ID, albums[1].Artists[0].ID)
+	require.Equal(untagged.ID, albums[2].Artists[0].ID)
+
+	// the id is kept through a rename
+	setArtist("a/bleach/track.flac", "Nirvana (US)", idGrunge)
+	m.ScanAndClean()
+	var renamed db.Artist
+	require.NoError(m.DB().Where("brainz_id=?", idGrunge).Find(&renamed).Error)
+	require.Equal("Nirvana (US)", renamed.Name)
+}
+
+func TestTrackArtists(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItemsGlob("artist-0/album-0/track-*")
+	m.SetTags("artist-0/album-0/track-1.flac", func(tags *mockfs.Tags) error {
+		tags.RawArtists = []string{"artist-0", "guest"}
+		return nil
+	})
+	m.ScanAndClean()
+
+	var guest db.Artist
+	require.NoError(m.DB().Where("name=?", "guest").Find(&guest).Error)
+
+	var tracks []*db.Track
+	require.NoError(m.DB().Preload("Artists").Order("filename").Find(&tracks).Error)
+	require.Len(tracks, 3)
+	require.Len(tracks[0].Artists, 1)
+	require.Len(tracks[1].Artists, 2)
+	require.Equal("guest", tracks[1].Artists[1].Name)
+
+	var albumArtists int
+	require.NoError(m.DB().Model(&db.AlbumArtist{}).Where("artist_id=?", guest.ID).Count(&albumArtists).Error)
+	require.Zero(albumArtists) // the guest only appears on the album
+
+	// and is cleaned up once they no longer appear
+	m.SetTags("artist-0/album-0/track-1.flac", func(tags *mockfs.Tags) error {
+		tags.RawArtists = nil
+		return nil
+	})
+	m.ScanAndClean()
+	require.ErrorIs(m.DB().Where("name=?", "guest").Find(&db.Artist{}).Error, gorm.ErrRecordNotFound)
+}
+
+func TestCueSheet(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddTrack("artist-a/album-a/album.flac")
+	m.SetTags("artist-a/album-a/album.flac", func(tags *mockfs.Tags) error {
+		tags.RawArtist = "artist-a"
+		tags.RawAlbumArtist = "artist-a"
+		tags.RawAlbum = "album-a"
+		tags.RawTitle = "album-a"
+		tags.RawLength = 600
+		return nil
+	})
+	cuePath := filepath.Join(m.TmpDir(), "artist-a/album-a/album.cue")
+	require.NoError(os.WriteFile(cuePath, []byte(`PERFORMER "artist-a"
+TITLE "album-a"
+FILE "album.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "title-1"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "title-2"
+    PERFORMER "artist-b"
+    INDEX 01 03:00:00
+  TRACK 03 AUDIO
+    TITLE "title-3"
+    INDEX 01 07:30:00
+`), 0o600))
+
+	ctx := m.ScanAndClean()
+	require.Equal(3, ctx.SeenTracksNew())
+
+	var tracks []*db.Track
+	require.NoError(m.DB().Order("cue_track").Find(&tracks).Error)
+	require.Len(tracks, 3)
+	for i, track := range tracks {
+		require.Equal("album.flac", track.Filename)
+		require.Equal(i+1, track.CueTrack)
+		require.Equal(i+1, track.TagTrackNumber)
+		require.Equal(fmt.Sprintf("title-%d", i+1), track.TagTitle)
+	}
+	require.Equal("artist-a", tracks[0].TagTrackArtist)
+	require.Equal("artist-b", tracks[1].TagTrackArtist)
+	require.Equal([]int{180, 270, 150}, []int{tracks[0].Length, tracks[1].Length, tracks[2].Length})
+
+	start, duration := tracks[1].CueRange()
+	require.Equal(3*time.Minute, start)
+	require.Equal(4*time.Minute+30*time.Second, duration)
+	start, duration = tracks[2].CueRange()
+	require.Equal(7*time.Minute+30*time.Second, start)
+	require.Zero(duration) // to the end of the file
+
+	ctx = m.ScanAndClean()
+	require.Equal(3, ctx.SeenTracks())
+	require.Equal(0, ctx.SeenTracksNew())
+
+	// without the sheet, it's just one long track again
+	require.NoError(os.Remove(cuePath))
+	m.SetTags("artist-a/album-a/album.flac", func(*mockfs.Tags) error { return nil })
+	ctx = m.ScanAndClean()
+	require.Equal(1, ctx.SeenTracksNew())
+	require.Equal(3, ctx.TracksMissing())
+}
+
+func TestCueSheetFilePerTrack(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItemsGlob("artist-0/album-0/*")
+	cuePath := filepath.Join(m.TmpDir(), "artist-0/album-0/album.cue")
+	require.NoError(os.WriteFile(cuePath, []byte(`TITLE "album-0"
+FILE "track-0.flac" WAVE
+  TRACK 01 AUDIO
+    TITLE "cue-title-0"
+    INDEX 01 00:00:00
+FILE "track-1.flac" WAVE
+  TRACK 02 AUDIO
+    TITLE "cue-title-1"
+    INDEX 00 00:00:00
+    INDEX 01 00:02:00
+`), 0o600))
+
+	m.ScanAndClean()
+
+	// a file with one track from the start is just a track, with its own tags
+	var track db.Track
+	require.NoError(m.DB().Where("filename=?", "track-0.flac").Find(&track).Error)
+	require.Zero(track.CueTrack)
+	require.Equal("title-0", track.TagTitle)
+
+	// but one which starts later is still split
+	var later db.Track
+	require.NoError(m.DB().Where("filename=?", "track-1.flac").Find(&later).Error)
+	require.Equal(2, later.CueTrack)
+	require.Equal("cue-title-1", later.TagTitle)
+}
+
+func TestSortTags(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddTrack("the beatles/abbey road/track.flac")
+	m.SetTags("the beatles/abbey road/track.flac", func(tags *mockfs.Tags) error {
+		tags.RawArtist = "The Beatles"
+		tags.RawAlbumArtist = "The Beatles"
+		tags.RawAlbumArtistSorts = []string{"Beatles, The"}
+		tags.RawAlbum = "Abbey Road"
+		tags.RawAlbumSort = "Abbey Road (1969)"
+		tags.RawTitle = "The End"
+		tags.RawTitleSort = "End, The"
+		return nil
+	})
+	m.ScanAndClean()
+
+	var artist db.Artist
+	require.NoError(m.DB().Where("name=?", "The Beatles").Find(&artist).Error)
+	require.Equal("Beatles, The", artist.NameSort)
+
+	var track db.Track
+	require.NoError(m.DB().Preload("Album").Where("tag_title=?", "The End").Find(&track).Error)
+	require.Equal("End, The", track.TagTitleSort)
+	require.Equal("Abbey Road (1969)", track.Album.TagTitleSort)
+
+	// an untagged track doesn't lose the artist's sort name
+	m.AddTrack("the beatles/let it be/track.flac")
+	m.SetTags("the beatles/let it be/track.flac", func(tags *mockfs.Tags) error {
+		tags.RawArtist = "The Beatles"
+		tags.RawAlbumArtist = "The Beatles"
+		tags.RawAlbum = "Let It Be"
+		tags.RawTitle = "Get Back"
+		return nil
+	})
+	m.ScanAndClean()
+
+	var artistAfter db.Artist
+	require.NoError(m.DB().Where("name=?", "The Beatles").Find(&artistAfter).Error)
+	require.Equal(artist.ID, artistAfter.ID)
+	require.Equal("Beatles, The", artistAfter.NameSort)
+}
+
+func TestMultiDiscMerge(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	for _, path := range []string{"album/CD1/track.flac", "album/CD2 - Bonus/track.flac", "album/extras/track.flac"} {
+		m.AddTrack(path)
+		m.SetTags(path, func(tags *mockfs.Tags) error {
+			tags.RawArtist = "artist"
+			tags.RawAlbumArtist = "artist"
+			tags.RawAlbum = "album"
+			tags.RawTitle = path
+			return nil
+		})
+	}
+	m.ScanAndClean()
+
+	album := func(rightPath string) *db.Album {
+		var album db.Album
+		require.NoError(m.DB().Where("right_path=?", rightPath).Find(&album).Error)
+		return &album
+	}
+	track := func(path string) *db.Track {
+		var track db.Track
+		require.NoError(m.DB().Where("tag_title=?", path).Find(&track).Error)
+		return &track
+	}
+
+	cd1, cd2, extras := album("CD1"), album("CD2 - Bonus"), album("extras")
+	require.Nil(cd1.MergedIntoID)
+	require.NotNil(cd2.MergedIntoID)
+	require.Equal(cd1.ID, *cd2.MergedIntoID)
+	require.Equal(cd1.ID, cd2.TagAlbumID())
+
+	// folders not named like discs are left alone
+	require.Nil(extras.MergedIntoID)
+
+	require.Equal(1, track("album/CD1/track.flac").TagDiscNumber)
+	require.Equal(2, track("album/CD2 - Bonus/track.flac").TagDiscNumber)
+	require.Equal("Bonus", track("album/CD2 - Bonus/track.flac").TagDiscSubtitle)
+
+	// a disc by another artist is split out again
+	m.SetTags("album/CD2 - Bonus/track.flac", func(tags *mockfs.Tags) error {
+		tags.RawAlbumArtist = "other artist"
+		return nil
+	})
+	m.ScanAndClean()
+	require.Nil(album("CD2 - Bonus").MergedIntoID)
+}
+
+func TestAlbumGroupingTags(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.NewWithAlbumGrouping(t, scanner.AlbumGroupingTags)
+
+	setAlbum := func(path, albumArtist, album string) {
+		m.SetTags(path, func(tags *mockfs.Tags) error {
+			tags.RawArtist = albumArtist
+			tags.RawAlbumArtist = albumArtist
+			tags.RawAlbum = album
+			tags.RawTitle = path
+			return nil
+		})
+	}
+	for _, path := range []string{"singles/a.flac", "singles/b.flac", "singles/c.flac", "y/b/1.flac"} {
+		m.AddTrack(path)
+	}
+	setAlbum("singles/a.flac", "x", "a")
+	setAlbum("singles/b.flac", "y", "b")
+	setAlbum("singles/c.flac", "y", "b")
+	setAlbum("y/b/1.flac", "y", "b")
+	m.ScanAndClean()
+
+	track := func(path string) *db.Track {
+		var track db.Track
+		require.NoError(m.DB().Preload("Album").Preload("TagAlbum").Where("tag_title=?", path).Find(&track).Error)
+		return &track
+	}
+
+	// the folder's album is its first track's
+	a := track("singles/a.flac")
+	require.Equal("a", a.Album.TagTitle)
+	require.Equal(a.AlbumID, *a.TagAlbumID)
+
+	// the other singles are grouped into an album of their own, in the same folder
+	b, c := track("singles/b.flac"), track("singles/c.flac")
+	require.Equal(a.AlbumID, b.AlbumID)
+	require.NotEqual(b.AlbumID, *b.TagAlbumID)
+	require.Equal(*b.TagAlbumID, *c.TagAlbumID)
+	require.False(b.TagAlbum.IsFolder())
+	require.Equal("b", b.TagAlbum.TagTitle)
+	require.Equal(a.Album.AbsPath(), b.TagAlbum.AbsPath())
+
+	// which is merged into the folder with the rest of the album
+	y := track("y/b/1.flac")
+	require.NotNil(b.TagAlbum.MergedIntoID)
+	require.Equal(y.AlbumID, *b.TagAlbum.MergedIntoID)
+	require.Nil(y.Album.MergedIntoID)
+
+	// a track moving to another album gets a new group, and unused groups go
+	setAlbum("singles/b.flac", "x", "a")
+	setAlbum("singles/c.flac", "y", "c")
+	m.ScanAndClean()
+
+	require.Equal(a.AlbumID, *track("singles/b.flac").TagAlbumID)
+	require.NotEqual(*c.TagAlbumID, *track("singles/c.flac").TagAlbumID)
+	require.Nil(track("singles/c.flac").TagAlbum.MergedIntoID)
+
+	var count int
+	require.NoError(m.DB().Model(&db.Album{}).Where("id=?", *c.TagAlbumID).Count(&count).Error)
+	require.Zero(count)
+}
+
+func TestSearchIndex(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	m := mockfs.New(t)
+
+	m.AddItemsGlob("artist-0/album-0/track-*")
+	m.SetTags("artist-0/album-0/track-0.flac", func(tags *mockfs.Tags) error {
+		tags.RawTitle = "Jóga"
+		tags.RawArtist = "Björk"
+		return nil
+	})
+	m.SetTags("artist-0/album-0/track-2.flac", func(tags *mockfs.Tags) error {
+		tags.RawTitle = "Bjork Remix"
+		return nil
+	})
+	m.ScanAndClean()
+	if !m.DB().HasSearchIndex() {
+		t.Skip("the search index needs the sqlite_fts5 build tag")
+	}
+
+	search := func(table, query string) []int {
+		fts := db.SearchTable(table)
+		var ids []int
+		require.NoError(m.DB().Table(fts).Where(fts+" MATCH ?", db.SearchMatch(query)).Order("rank").Pluck("rowid", &ids).Error)
+		return ids
+	}
+	var tracks []*db.Track
+	require.NoError(m.DB().Order("filename").Find(&tracks).Error)
+	require.Len(tracks, 3)
+
+	// by the start of words, without diacritics
+	require.Equal([]int{tracks[0].ID}, search("tracks", "jog"))
+	require.Len(search("artists", "bjork"), 1)
+	// across fields, with a match in the title ranked first
+	require.Equal([]int{tracks[0].ID}, search("tracks", "bjo joga"))
+	require.Equal([]int{tracks[2].ID, tracks[0].ID}, search("tracks", "bjork"))
+
+	// the album's tags come from its first track, but all of its tracks are found by its new title
+	m.SetTags("artist-0/album-0/track-0.flac", func(tags *mockfs.Tags) error {
+		tags.RawAlbum = "Homogenic"
+		return nil
+	})
+	m.ScanAndClean()
+	require.Len(search("albums", "homogenic"), 1)
+	require.Len(search("tracks", "homogenic"), 3)
+
+	m.RemoveAll("artist-0/album-0/track-0.flac")
+	m.ScanAndClean()
+	require.Empty(search("tracks", "jog"))
+	require.Equal([]int{tracks[2].ID}, search("tracks", "bjork"))
+}
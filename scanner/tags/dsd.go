@@ -0,0 +1,277 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DSDReader reads DSF and DSDIFF files, which taglib only supports from 2.0. both keep their tags in
+// an ID3v2 tag, at the end of the file for DSF and in an "ID3 " chunk for DSDIFF
+type DSDReader struct{}
+
+func (*DSDReader) Read(abspath string) (Parser, error) {
+	f, err := os.Open(abspath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := readDSD(f)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string][]string{}
+	if info.id3Offset > 0 {
+		if _, err := f.Seek(info.id3Offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("seek to id3: %w", err)
+		}
+		_, frames, err := readID3Frames(bufio.NewReader(f), func(string) bool { return true })
+		if err != nil {
+			return nil, fmt.Errorf("read id3: %w", err)
+		}
+		raw = parseID3Tags(frames)
+	}
+	return &Tagger{raw, info.properties, abspath}, nil
+}
+
+type dsdInfo struct {
+	properties
+	id3Offset int64 // zero if there's no tag
+}
+
+func isDSD(magic []byte) bool {
+	return bytes.HasPrefix(magic, []byte("DSD ")) || bytes.HasPrefix(magic, []byte("FRM8"))
+}
+
+// seekDSDID3 moves r to the start of the ID3v2 tag of a DSD file, or returns ErrNoPicture if it has none
+func seekDSDID3(r io.ReadSeeker) error {
+	info, err := readDSD(r)
+	if err != nil {
+		return err
+	}
+	if info.id3Offset == 0 {
+		return ErrNoPicture
+	}
+	_, err = r.Seek(info.id3Offset, io.SeekStart)
+	return err
+}
+
+func readDSD(r io.ReadSeeker) (dsdInfo, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return dsdInfo{}, err
+	}
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return dsdInfo{}, fmt.Errorf("read magic: %w", ErrUnknownFormat)
+	}
+	switch string(magic[:]) {
+	case "DSD ":
+		return readDSF(r)
+	case "FRM8":
+		return readDFF(r)
+	}
+	return dsdInfo{}, ErrUnknownFormat
+}
+
+// readDSF reads the "DSD " and "fmt " chunks at the start of a DSF file, which are little endian
+// https://dsd-guide.com/sites/default/files/white-papers/DSFFileFormatSpec_E.pdf
+func readDSF(r io.Reader) (dsdInfo, error) {
+	var header [24 + 52]byte // the rest of the "DSD " chunk, then the "fmt " chunk
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return dsdInfo{}, fmt.Errorf("read header: %w", ErrInvalidMetadata)
+	}
+	metadataOffset := binary.LittleEndian.Uint64(header[16:24])
+	fmtChunk := header[24:]
+	if string(fmtChunk[:4]) != "fmt " {
+		return dsdInfo{}, fmt.Errorf("missing fmt chunk: %w", ErrInvalidMetadata)
+	}
+	var info dsdInfo
+	info.channels = int(binary.LittleEndian.Uint32(fmtChunk[24:28]))
+	info.sampleRate = int(binary.LittleEndian.Uint32(fmtChunk[28:32]))
+	info.bitDepth = int(binary.LittleEndian.Uint32(fmtChunk[32:36]))
+	sampleCount := binary.LittleEndian.Uint64(fmtChunk[36:44])
+	if info.sampleRate > 0 {
+		info.length = int(sampleCount / uint64(info.sampleRate))
+	}
+	info.bitrate = info.sampleRate * info.channels * info.bitDepth / 1000
+	info.id3Offset = int64(metadataOffset)
+	return info, nil
+}
+
+// readDFF walks the chunks of a DSDIFF file, which are big endian and padded to an even size
+// https://dsd-guide.com/sites/default/files/white-papers/DSDIFF_1.5_Spec.pdf
+func readDFF(r io.ReadSeeker) (dsdInfo, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || string(header[8:12]) != "DSD " {
+		return dsdInfo{}, fmt.Errorf("read header: %w", ErrInvalidMetadata)
+	}
+	var info dsdInfo
+	var dataSize uint64
+	var dstFrames, dstFrameRate int
+	offset := int64(16)
+	for {
+		id, size, err := readDFFChunk(r)
+		if err != nil {
+			break
+		}
+		offset += 12
+		switch id {
+		case "PROP":
+			prop := make([]byte, min(size, maxMetadataSize))
+			if _, err := io.ReadFull(r, prop); err != nil {
+				return dsdInfo{}, fmt.Errorf("read prop: %w", ErrInvalidMetadata)
+			}
+			info.sampleRate, info.channels = parseDFFProp(prop)
+		case "DSD ":
+			dataSize = size
+		case "DST ":
+			// compressed, so the length comes from the frame count instead
+			var frte [16]byte
+			if _, err := io.ReadFull(r, frte[:]); err == nil && string(frte[:4]) == "FRTE" {
+				dstFrames = int(binary.BigEndian.Uint32(frte[12:16]))
+				var rate [2]byte
+				if _, err := io.ReadFull(r, rate[:]); err == nil {
+					dstFrameRate = int(binary.BigEndian.Uint16(rate[:]))
+				}
+			}
+		case "ID3 ":
+			info.id3Offset = offset
+		}
+		offset += int64(size + size%2)
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			break
+		}
+	}
+	if info.sampleRate == 0 || info.channels == 0 {
+		return dsdInfo{}, fmt.Errorf("missing sound properties: %w", ErrInvalidMetadata)
+	}
+	switch {
+	case dataSize > 0:
+		info.length = int(dataSize * 8 / uint64(info.channels) / uint64(info.sampleRate))
+	case dstFrameRate > 0:
+		info.length = dstFrames / dstFrameRate
+	}
+	info.bitDepth = 1
+	info.bitrate = info.sampleRate * info.channels / 1000
+	return info, nil
+}
+
+func readDFFChunk(r io.Reader) (id string, size uint64, err error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", 0, err
+	}
+	return string(header[:4]), binary.BigEndian.Uint64(header[4:12]), nil
+}
+
+// parseDFFProp finds the sample rate and channel count in the local chunks of a "SND " property chunk
+func parseDFFProp(prop []byte) (sampleRate, channels int) {
+	if len(prop) < 4 || string(prop[:4]) != "SND " {
+		return 0, 0
+	}
+	prop = prop[4:]
+	for len(prop) >= 12 {
+		id, size := string(prop[:4]), binary.BigEndian.Uint64(prop[4:12])
+		prop = prop[12:]
+		if size > uint64(len(prop)) {
+			break
+		}
+		data := prop[:size]
+		switch {
+		case id == "FS  " && len(data) >= 4:
+			sampleRate = int(binary.BigEndian.Uint32(data))
+		case id == "CHNL" && len(data) >= 2:
+			channels = int(binary.BigEndian.Uint16(data))
+		}
+		prop = prop[min(size+size%2, uint64(len(prop))):]
+	}
+	return sampleRate, channels
+}
+
+// id3TextFrames are the keys taglib uses for ID3v2 text frames, so tags read here look the same
+// as the ones audiotags reads
+var id3TextFrames = map[string]string{
+	"TIT2": "title", "TT2": "title",
+	"TPE1": "artist", "TP1": "artist",
+	"TALB": "album", "TAL": "album",
+	"TPE2": "albumartist", "TP2": "albumartist",
+	"TRCK": "tracknumber", "TRK": "tracknumber",
+	"TPOS": "discnumber", "TPA": "discnumber",
+	"TDRC": "date", "TYER": "date", "TYE": "date",
+	"TDOR": "originaldate", "TORY": "originaldate",
+	"TCON": "genre", "TCO": "genre",
+	"TCOM": "composer", "TCM": "composer",
+	"TPE3": "conductor", "TP3": "conductor",
+	"TEXT": "lyricist", "TXT": "lyricist",
+	"TPUB": "label", "TPB": "label",
+	"TSOT": "titlesort",
+	"TSOA": "albumsort",
+	"TSOP": "artistsort",
+	"TSO2": "albumartistsort",
+	"TBPM": "bpm", "TBP": "bpm",
+	"TCMP": "compilation",
+	"TSST": "discsubtitle",
+}
+
+func parseID3Tags(frames []id3Frame) map[string][]string {
+	raw := map[string][]string{}
+	for _, frame := range frames {
+		if len(frame.data) < 1 {
+			continue
+		}
+		encoding, data := frame.data[0], frame.data[1:]
+		switch id := frame.id; {
+		case id3TextFrames[id] != "":
+			key := id3TextFrames[id]
+			raw[key] = append(raw[key], splitID3Text(encoding, data)...)
+		case id == "TXXX" || id == "TXX":
+			desc, rest, ok := cutID3Text(encoding, data)
+			if !ok {
+				continue
+			}
+			key := normaliseKey(desc)
+			raw[key] = append(raw[key], splitID3Text(encoding, rest)...)
+		case id == "COMM" || id == "COM" || id == "USLT" || id == "ULT":
+			if len(data) < 3 {
+				continue
+			}
+			_, text, ok := cutID3Text(encoding, data[3:]) // skip the language and description
+			if !ok {
+				continue
+			}
+			key := "comment"
+			if id == "USLT" || id == "ULT" {
+				key = "lyrics"
+			}
+			raw[key] = append(raw[key], decodeID3Text(encoding, text))
+		case id == "UFID" || id == "UFI":
+			// the whole frame is the owner then the identifier, without an encoding
+			owner, ident, ok := cutID3Text(0, frame.data)
+			if ok && owner == "http://musicbrainz.org" {
+				raw["musicbrainz_trackid"] = append(raw["musicbrainz_trackid"], string(ident))
+			}
+		}
+	}
+	return raw
+}
+
+// splitID3Text splits the values of a text frame, which ID3v2.4 separates with nulls
+func splitID3Text(encoding byte, b []byte) []string {
+	var values []string
+	for {
+		value, rest, ok := cutID3Text(encoding, b)
+		if !ok {
+			break
+		}
+		values = append(values, value)
+		b = rest
+	}
+	if len(b) > 0 {
+		values = append(values, decodeID3Text(encoding, b))
+	}
+	return values
+}
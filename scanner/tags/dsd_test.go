@@ -0,0 +1,127 @@
+package tags_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.senan.xyz/gonic/scanner/tags"
+)
+
+func TestDSDReader(t *testing.T) {
+	t.Parallel()
+
+	tag := id3(4,
+		frame("TIT2", []byte("\x03title")),
+		frame("TPE1", []byte("\x03artist one\x00artist two")),
+		frame("TRCK", []byte("\x033/10")),
+		frame("TXXX", []byte("\x03MusicBrainz Album Id\x00mbid")),
+		frame("TXXX", []byte("\x03REPLAYGAIN_TRACK_GAIN\x00-6.5 dB")),
+		frame("USLT", []byte("\x03eng\x00lyrics")),
+	)
+	tcases := []struct {
+		name    string
+		data    []byte
+		bitrate int
+	}{
+		{"dsf.dsf", dsf(tag), 2822400 * 2 / 1000},
+		{"dff.dff", dff(tag), 2822400 * 2 / 1000},
+	}
+	for _, tcase := range tcases {
+		tcase := tcase
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), tcase.name)
+			require.NoError(t, os.WriteFile(path, tcase.data, 0o600))
+
+			trags, err := (&tags.DSDReader{}).Read(path)
+			require.NoError(t, err)
+			require.Equal(t, "title", trags.Title())
+			require.Equal(t, "artist one", trags.Artist())
+			require.Equal(t, 3, trags.TrackNumber())
+			require.Equal(t, "mbid", trags.AlbumBrainzID())
+			require.Equal(t, float32(-6.5), trags.ReplayGainTrackGain())
+			require.Equal(t, []string{"lyrics"}, trags.Lyrics())
+			require.Equal(t, 2, trags.Length())
+			require.Equal(t, tcase.bitrate, trags.Bitrate())
+			require.Equal(t, 2822400, trags.SampleRate())
+			require.Equal(t, 1, trags.BitDepth())
+			require.Equal(t, 2, trags.Channels())
+
+			picture, err := trags.Picture()
+			require.ErrorIs(t, err, tags.ErrNoPicture)
+			require.Nil(t, picture)
+		})
+	}
+}
+
+func TestDSDReaderUnknown(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "flac.flac")
+	require.NoError(t, os.WriteFile(path, flac(), 0o600))
+
+	_, err := (&tags.DSDReader{}).Read(path)
+	require.ErrorIs(t, err, tags.ErrUnknownFormat)
+}
+
+// dsf is two seconds of 1 bit stereo at 2.8MHz, with the tag at the end
+func dsf(tag []byte) []byte {
+	const sampleRate, channels = 2822400, 2
+	audio := make([]byte, 16)
+
+	var b bytes.Buffer
+	u32 := func(v uint32) { _ = binary.Write(&b, binary.LittleEndian, v) }
+	u64 := func(v uint64) { _ = binary.Write(&b, binary.LittleEndian, v) }
+	b.WriteString("DSD ")
+	u64(28)
+	u64(uint64(28 + 52 + 12 + len(audio) + len(tag)))
+	u64(uint64(28 + 52 + 12 + len(audio)))
+	b.WriteString("fmt ")
+	u64(52)
+	u32(1) // version
+	u32(0) // raw dsd
+	u32(2) // stereo
+	u32(channels)
+	u32(sampleRate)
+	u32(1) // bits per sample
+	u64(sampleRate * 2)
+	u32(4096) // block size
+	u32(0)
+	b.WriteString("data")
+	u64(uint64(12 + len(audio)))
+	b.Write(audio)
+	b.Write(tag)
+	return b.Bytes()
+}
+
+// dff is two seconds of 1 bit stereo at 2.8MHz, with an odd sized tag chunk. the sound data is left
+// out, and its chunk is last so only its size is needed
+func dff(tag []byte) []byte {
+	const sampleRate, channels = 2822400, 2
+	chunk := func(id string, data ...[]byte) []byte {
+		body := bytes.Join(data, nil)
+		header := make([]byte, 12)
+		copy(header, id)
+		binary.BigEndian.PutUint64(header[4:], uint64(len(body)))
+		if len(body)%2 != 0 {
+			body = append(body, 0)
+		}
+		return append(header, body...)
+	}
+	audio := chunk("DSD ")
+	binary.BigEndian.PutUint64(audio[4:], sampleRate*channels*2/8)
+	return chunk("FRM8",
+		[]byte("DSD "),
+		chunk("FVER", []byte{1, 5, 0, 0}),
+		chunk("PROP", []byte("SND "),
+			chunk("FS  ", binary.BigEndian.AppendUint32(nil, sampleRate)),
+			chunk("CHNL", binary.BigEndian.AppendUint16(nil, channels), []byte("SLFTSRGT")),
+		),
+		chunk("ID3 ", tag, []byte{0}),
+		audio,
+	)
+}
@@ -0,0 +1,8 @@
+package tags
+
+import "time"
+
+// SetTimeoutForTest sets how long the reader waits for ffprobe, rather than the default
+func (r *FFProbeReader) SetTimeoutForTest(d time.Duration) {
+	r.timeout = d
+}
@@ -0,0 +1,138 @@
+package tags
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ffprobeTimeout is how long ffprobe can take to read one file. it's usually well under a second, but a
+// corrupt file can make it hang, which would block a scan worker for good
+const ffprobeTimeout = 30 * time.Second
+
+// FFProbeReader reads tags with ffprobe, which supports formats taglib doesn't, and measures the
+// length and audio properties from the stream itself
+type FFProbeReader struct {
+	path    string
+	timeout time.Duration
+}
+
+func NewFFProbeReader() (*FFProbeReader, error) {
+	path, err := exec.LookPath("ffprobe")
+	if err != nil {
+		return nil, fmt.Errorf("find ffprobe: %w", err)
+	}
+	return &FFProbeReader{path: path, timeout: ffprobeTimeout}, nil
+}
+
+func (r *FFProbeReader) Read(abspath string) (Parser, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, r.path, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", "-select_streams", "a:0", abspath)
+	cmd.WaitDelay = time.Second // don't wait on the output of anything ffprobe started once it's killed
+
+	var exitErr *exec.ExitError
+
+	switch out, err := cmd.Output(); {
+	case ctx.Err() != nil:
+		return nil, fmt.Errorf("run ffprobe: timed out after %s: %w", r.timeout, ctx.Err())
+	case errors.As(err, &exitErr):
+		return nil, fmt.Errorf("run ffprobe: %v: %s", err, bytes.TrimSpace(exitErr.Stderr))
+	case err != nil:
+		return nil, fmt.Errorf("run ffprobe: %w", err)
+	default:
+		return parseFFProbe(out, abspath)
+	}
+}
+
+type ffprobeOutput struct {
+	Streams []struct {
+		SampleRate       string            `json:"sample_rate"`
+		Channels         int               `json:"channels"`
+		BitsPerSample    int               `json:"bits_per_sample"`
+		BitsPerRawSample string            `json:"bits_per_raw_sample"`
+		BitRate          string            `json:"bit_rate"`
+		Duration         string            `json:"duration"`
+		Tags             map[string]string `json:"tags"`
+	} `json:"streams"`
+	Format struct {
+		Duration string            `json:"duration"`
+		BitRate  string            `json:"bit_rate"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+// ffprobeKeys are ffmpeg's names for tags, after lower casing, which are different to taglib's
+var ffprobeKeys = map[string]string{
+	"album_artist":      "albumartist",
+	"track":             "tracknumber",
+	"disc":              "discnumber",
+	"title-sort":        "titlesort",
+	"album-sort":        "albumsort",
+	"artist-sort":       "artistsort",
+	"album_artist-sort": "albumartistsort",
+	"sort_name":         "titlesort",
+	"sort_album":        "albumsort",
+	"sort_artist":       "artistsort",
+	"sort_album_artist": "albumartistsort",
+	"tbpm":              "bpm",
+	"tdor":              "originaldate",
+	"tsst":              "discsubtitle",
+}
+
+func parseFFProbe(out []byte, abspath string) (Parser, error) {
+	var probe ffprobeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, fmt.Errorf("parse ffprobe output: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return nil, fmt.Errorf("no audio stream: %w", ErrUnknownFormat)
+	}
+	stream := probe.Streams[0]
+
+	// ogg files have their tags on the stream rather than the container
+	raw := map[string][]string{}
+	for _, tags := range []map[string]string{probe.Format.Tags, stream.Tags} {
+		for k, v := range tags {
+			k = normaliseKey(k)
+			if name, ok := ffprobeKeys[k]; ok {
+				k = name
+			}
+			if strings.HasPrefix(k, "lyrics-") {
+				k = "lyrics" // with the language, from ID3v2 USLT frames
+			}
+			raw[k] = append(raw[k], v)
+		}
+	}
+
+	var props properties
+	props.length = int(math.Round(parseFloat(probe.Format.Duration, stream.Duration)))
+	// the stream's bitrate, if it's known, doesn't include things like embedded pictures
+	props.bitrate = int(parseFloat(stream.BitRate, probe.Format.BitRate) / 1000)
+	props.sampleRate, _ = strconv.Atoi(stream.SampleRate)
+	props.channels = stream.Channels
+	props.bitDepth, _ = strconv.Atoi(stream.BitsPerRawSample)
+	if props.bitDepth == 0 {
+		props.bitDepth = stream.BitsPerSample
+	}
+	return &Tagger{raw, props, abspath}, nil
+}
+
+// parseFloat parses the first of values which is a number, since ffprobe leaves out or writes "N/A"
+// for values it doesn't know
+func parseFloat(values ...string) float64 {
+	for _, v := range values {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 {
+			return f
+		}
+	}
+	return 0
+}
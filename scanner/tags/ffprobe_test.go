@@ -0,0 +1,88 @@
+package tags_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.senan.xyz/gonic/scanner/tags"
+)
+
+// ffprobeOutput is trimmed from the output of a flac file with vorbis comments
+const ffprobeOutput = `{
+  "streams": [
+    {
+      "codec_name": "flac",
+      "codec_type": "audio",
+      "sample_rate": "96000",
+      "channels": 2,
+      "bits_per_sample": 0,
+      "bits_per_raw_sample": "24",
+      "duration": "245.333333"
+    }
+  ],
+  "format": {
+    "format_name": "flac",
+    "duration": "245.666667",
+    "bit_rate": "3612000",
+    "tags": {
+      "TITLE": "title",
+      "ARTIST": "artist",
+      "album_artist": "album artist",
+      "track": "3/10",
+      "MusicBrainz Album Id": "mbid",
+      "lyrics-eng": "lyrics"
+    }
+  }
+}`
+
+func TestFFProbeReader(t *testing.T) {
+	// a fake ffprobe on the PATH, so the test doesn't need ffmpeg installed
+	bin := t.TempDir()
+	script := "#!/bin/sh\nprintf '%s' '" + ffprobeOutput + "'\n"
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "ffprobe"), []byte(script), 0o700)) //nolint:gosec
+	t.Setenv("PATH", bin)
+
+	reader, err := tags.NewFFProbeReader()
+	require.NoError(t, err)
+
+	trags, err := reader.Read(filepath.Join(t.TempDir(), "track.flac"))
+	require.NoError(t, err)
+	require.Equal(t, "title", trags.Title())
+	require.Equal(t, "artist", trags.Artist())
+	require.Equal(t, "album artist", trags.AlbumArtist())
+	require.Equal(t, 3, trags.TrackNumber())
+	require.Equal(t, "mbid", trags.AlbumBrainzID())
+	require.Equal(t, []string{"lyrics"}, trags.Lyrics())
+	require.Equal(t, 246, trags.Length())
+	require.Equal(t, 3612, trags.Bitrate())
+	require.Equal(t, 96000, trags.SampleRate())
+	require.Equal(t, 24, trags.BitDepth())
+	require.Equal(t, 2, trags.Channels())
+}
+
+func TestFFProbeReaderMissing(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	_, err := tags.NewFFProbeReader()
+	require.Error(t, err)
+}
+
+func TestFFProbeReaderTimeout(t *testing.T) {
+	// an ffprobe which hangs, like it can on a corrupt file
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "ffprobe"), []byte("#!/bin/sh\nsleep 10\n"), 0o700)) //nolint:gosec
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	reader, err := tags.NewFFProbeReader()
+	require.NoError(t, err)
+	reader.SetTimeoutForTest(100 * time.Millisecond)
+
+	start := time.Now()
+	_, err = reader.Read(filepath.Join(t.TempDir(), "track.flac"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,208 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+type id3Frame struct {
+	id   string
+	data []byte
+}
+
+type id3FrameHeader struct {
+	version byte
+	id      string
+	size    int
+	flags   byte
+}
+
+// compressed is if the frame is compressed or encrypted, which we can't read
+func (h id3FrameHeader) compressed() bool {
+	switch h.version {
+	case 3:
+		return h.flags&0xc0 != 0
+	case 4:
+		return h.flags&0x0c != 0
+	}
+	return false
+}
+
+// walkID3Frames calls fn with each frame of an ID3v2 tag and a reader for its body, leaving r at the end of the
+// tag. fn only needs to read as much of the body as it wants. if it returns false, the walk stops there, and
+// r isn't moved to the end
+func walkID3Frames(r io.Reader, fn func(header id3FrameHeader, body io.Reader) bool) error {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	version, flags := header[3], header[5]
+	tagR := &io.LimitedReader{R: r, N: int64(syncsafe(header[6:10]))}
+
+	var tag io.Reader = tagR
+	if version < 4 && flags&0x80 != 0 {
+		tag = &unsyncReader{r: bufio.NewReader(tagR)}
+	}
+	if flags&0x40 != 0 {
+		// skip the extended header
+		var sizeBytes [4]byte
+		if _, err := io.ReadFull(tag, sizeBytes[:]); err != nil {
+			return ErrInvalidMetadata
+		}
+		size := int64(binary.BigEndian.Uint32(sizeBytes[:]))
+		if version >= 4 {
+			size = int64(syncsafe(sizeBytes[:])) - 4
+		}
+		if size < 0 {
+			return ErrInvalidMetadata
+		}
+		if _, err := io.CopyN(io.Discard, tag, size); err != nil {
+			return ErrInvalidMetadata
+		}
+	}
+
+	headerSize, idSize := 10, 4
+	if version == 2 {
+		headerSize, idSize = 6, 3
+	}
+
+	frameHeader := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(tag, frameHeader); err != nil || frameHeader[0] == 0 {
+			break // the end of the tag, or padding
+		}
+		h := id3FrameHeader{version: version, id: string(frameHeader[:idSize])}
+		switch version {
+		case 2:
+			h.size = int(frameHeader[3])<<16 | int(frameHeader[4])<<8 | int(frameHeader[5])
+		case 3:
+			h.size = int(binary.BigEndian.Uint32(frameHeader[4:8]))
+			h.flags = frameHeader[9]
+		default:
+			h.size = syncsafe(frameHeader[4:8])
+			h.flags = frameHeader[9]
+		}
+		body := &io.LimitedReader{R: tag, N: int64(h.size)}
+		if !fn(h, body) {
+			return nil
+		}
+		if _, err := io.Copy(io.Discard, body); err != nil || body.N > 0 {
+			break
+		}
+	}
+
+	// skip whatever's left, like padding
+	if _, err := io.Copy(io.Discard, tagR); err != nil {
+		return fmt.Errorf("skip tag: %w", err)
+	}
+	return nil
+}
+
+// readID3Frames reads the frames of an ID3v2 tag that want returns true for, leaving r at the end of the tag.
+// the bodies of other frames are skipped without being read into memory, as are those which are compressed
+// or encrypted
+func readID3Frames(r io.Reader, want func(id string) bool) (version byte, frames []id3Frame, err error) {
+	err = walkID3Frames(r, func(h id3FrameHeader, body io.Reader) bool {
+		version = h.version
+		if !want(h.id) || h.compressed() || h.size > maxMetadataSize {
+			return true
+		}
+		data := make([]byte, h.size)
+		if _, err := io.ReadFull(body, data); err != nil {
+			return true
+		}
+		if h.version >= 4 {
+			if h.flags&0x01 != 0 && len(data) >= 4 {
+				data = data[4:] // data length indicator
+			}
+			if h.flags&0x02 != 0 {
+				data = unsynchronise(data)
+			}
+		}
+		frames = append(frames, id3Frame{id: h.id, data: data})
+		return true
+	})
+	return version, frames, err
+}
+
+// cutID3Text cuts a null terminated string from the start of b. the null is as wide as the encoding
+func cutID3Text(encoding byte, b []byte) (text string, rest []byte, ok bool) {
+	switch encoding {
+	case 1, 2:
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return decodeID3Text(encoding, b[:i]), b[i+2:], true
+			}
+		}
+	default:
+		if end := bytes.IndexByte(b, 0); end >= 0 {
+			return decodeID3Text(encoding, b[:end]), b[end+1:], true
+		}
+	}
+	return "", nil, false
+}
+
+func decodeID3Text(encoding byte, b []byte) string {
+	switch encoding {
+	case 0: // latin1
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	case 1, 2: // utf16 with a bom, or big endian without one
+		var order binary.ByteOrder = binary.BigEndian
+		if len(b) >= 2 && b[0] == 0xff && b[1] == 0xfe {
+			order, b = binary.LittleEndian, b[2:]
+		} else if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+			b = b[2:]
+		}
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = order.Uint16(b[i*2:])
+		}
+		return string(utf16.Decode(units))
+	default:
+		return string(b)
+	}
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// unsynchronise removes the zero bytes ID3v2 inserts after 0xff so frames don't look like mpeg sync
+func unsynchronise(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xff, 0x00}, []byte{0xff})
+}
+
+// unsyncReader is unsynchronise for a whole tag, as it's read
+type unsyncReader struct {
+	r      *bufio.Reader
+	prevFF bool
+}
+
+func (u *unsyncReader) Read(p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		b, err := u.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if u.prevFF && b == 0x00 {
+			u.prevFF = false
+			continue
+		}
+		u.prevFF = b == 0xff
+		p[n] = b
+		n++
+	}
+	return n, nil
+}
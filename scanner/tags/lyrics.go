@@ -0,0 +1,87 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ReadSyncedLyrics reads ID3v2 SYLT frames as lrc formatted text, since taglib doesn't expose them.
+// files without an ID3v2 tag have no lyrics. DSF and DSDIFF files keep theirs after the audio
+func ReadSyncedLyrics(abspath string) ([]string, error) {
+	f, err := os.Open(abspath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(4)
+	switch {
+	case err != nil:
+		return nil, nil
+	case isDSD(magic):
+		if err := seekDSDID3(f); err != nil {
+			return nil, nil
+		}
+		r = bufio.NewReader(f)
+	case !bytes.HasPrefix(magic, []byte("ID3")):
+		return nil, nil
+	}
+	_, frames, err := readID3Frames(r, func(id string) bool {
+		return id == "SYLT" || id == "SLT" // SLT for v2.2
+	})
+	if err != nil {
+		return nil, err
+	}
+	var lyrics []string
+	for _, frame := range frames {
+		if lrc, ok := parseSYLT(frame.data); ok {
+			lyrics = append(lyrics, lrc)
+		}
+	}
+	return lyrics, nil
+}
+
+func parseSYLT(frame []byte) (string, bool) {
+	if len(frame) < 6 {
+		return "", false
+	}
+	encoding, lang, timestampFormat := frame[0], string(frame[1:4]), frame[4]
+	const timestampFormatMillis = 2
+	if timestampFormat != timestampFormatMillis {
+		return "", false // mpeg frames, which we can't convert without decoding
+	}
+	_, rest, ok := cutID3Text(encoding, frame[6:]) // content descriptor
+	if !ok {
+		return "", false
+	}
+
+	var sb strings.Builder
+	if lang != "" && lang != "XXX" && lang != "xxx" {
+		fmt.Fprintf(&sb, "[la:%s]\n", lang)
+	}
+	var lines int
+	for len(rest) > 0 {
+		var text string
+		text, rest, ok = cutID3Text(encoding, rest)
+		if !ok || len(rest) < 4 {
+			break
+		}
+		start := time.Duration(binary.BigEndian.Uint32(rest)) * time.Millisecond
+		rest = rest[4:]
+		fmt.Fprintf(&sb, "[%s]%s\n", formatLRCTimestamp(start), strings.Trim(text, "\r\n"))
+		lines++
+	}
+	return sb.String(), lines > 0
+}
+
+// formatLRCTimestamp formats a time like mm:ss.xx, for lrc lyrics
+func formatLRCTimestamp(d time.Duration) string {
+	centis := d.Milliseconds() / 10
+	return fmt.Sprintf("%02d:%02d.%02d", centis/6000, centis/100%60, centis%100)
+}
@@ -0,0 +1,77 @@
+package tags_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.senan.xyz/gonic/scanner/tags"
+)
+
+func TestReadSyncedLyrics(t *testing.T) {
+	t.Parallel()
+
+	// after a picture, which is skipped over
+	lyrics := sylt("one", 1000, "two", 62500)
+	picture := bytes.Repeat([]byte{0xff, 0x00}, 1<<16)
+
+	tcases := []struct {
+		name string
+		data []byte
+	}{
+		{"id3v23.mp3", id3(3, apic(3, picture), lyrics)},
+		{"id3v24.mp3", id3(4, frame("TIT2", []byte("\x00title")), lyrics)},
+		{"unsynchronised.mp3", unsynchronisedID3(apic(3, picture), lyrics)},
+	}
+	for _, tcase := range tcases {
+		tcase := tcase
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), tcase.name)
+			require.NoError(t, os.WriteFile(path, tcase.data, 0o600))
+
+			lyrics, err := tags.ReadSyncedLyrics(path)
+			require.NoError(t, err)
+			require.Equal(t, []string{"[la:eng]\n[00:01.00]one\n[01:02.50]two\n"}, lyrics)
+		})
+	}
+}
+
+func TestReadSyncedLyricsMissing(t *testing.T) {
+	t.Parallel()
+
+	for name, data := range map[string][]byte{
+		"id3.mp3":   id3(3, apic(3, frontCover)),
+		"flac.flac": flac(flacPicture(3, frontCover)),
+	} {
+		path := filepath.Join(t.TempDir(), name)
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+
+		lyrics, err := tags.ReadSyncedLyrics(path)
+		require.NoError(t, err)
+		require.Empty(t, lyrics)
+	}
+}
+
+func sylt(text1 string, start1 uint32, text2 string, start2 uint32) []byte {
+	var body []byte
+	body = append(body, 0)        // latin1
+	body = append(body, "eng"...) // language
+	body = append(body, 2, 1, 0)  // millisecond timestamps, lyrics, empty description
+	body = append(body, text1+"\x00"...)
+	body = binary.BigEndian.AppendUint32(body, start1)
+	body = append(body, text2+"\x00"...)
+	body = binary.BigEndian.AppendUint32(body, start2)
+	return frame("SYLT", body)
+}
+
+// unsynchronisedID3 is a v2.3 tag with the unsynchronisation flag, with a zero after each 0xff
+func unsynchronisedID3(frames ...[]byte) []byte {
+	body := bytes.ReplaceAll(bytes.Join(frames, nil), []byte{0xff}, []byte{0xff, 0x00})
+	tag := id3(3, body)
+	tag[5] |= 0x80
+	return tag
+}
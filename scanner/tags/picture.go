@@ -0,0 +1,478 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	ErrNoPicture       = errors.New("no embedded picture")
+	ErrUnknownFormat   = errors.New("unknown format")
+	ErrInvalidMetadata = errors.New("invalid metadata")
+)
+
+// pictureTypeFrontCover is from the ID3v2 APIC picture types, which FLAC and Vorbis comments also use
+const pictureTypeFrontCover = 3
+
+const flacBlockTypePicture = 6
+
+// maxMetadataSize limits how much we're willing to read for a single tag frame, block, or atom
+const maxMetadataSize = 64 << 20
+
+// ReadPicture finds the picture embedded in an audio file, preferring the front cover if there's more
+// than one. it supports ID3v2 APIC frames, including those in DSF and DSDIFF files, FLAC and Vorbis comment
+// METADATA_BLOCK_PICTUREs, and MP4 covr atoms
+func ReadPicture(abspath string) ([]byte, error) {
+	f, err := os.Open(abspath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(8)
+	if err != nil {
+		return nil, fmt.Errorf("read magic: %w", ErrUnknownFormat)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("ID3")):
+		picture, err := readID3Picture(r)
+		if err == nil || !errors.Is(err, ErrNoPicture) {
+			return picture, err
+		}
+		// some flac files have an id3 tag before the stream
+		if magic, err := r.Peek(4); err == nil && bytes.Equal(magic, []byte("fLaC")) {
+			return readFLACPicture(r)
+		}
+		return nil, ErrNoPicture
+	case bytes.HasPrefix(magic, []byte("fLaC")):
+		return readFLACPicture(r)
+	case bytes.HasPrefix(magic, []byte("OggS")):
+		return readOggPicture(r)
+	case bytes.Equal(magic[4:8], []byte("ftyp")):
+		return readMP4Picture(f)
+	case isDSD(magic):
+		if err := seekDSDID3(f); err != nil {
+			return nil, err
+		}
+		return readID3Picture(bufio.NewReader(f))
+	}
+	return nil, ErrUnknownFormat
+}
+
+// HasPicture is if an audio file has an embedded picture, like ReadPicture finds. it stops at the picture's
+// frame, block, or atom, without reading the picture itself
+func HasPicture(abspath string) (bool, error) {
+	f, err := os.Open(abspath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(8)
+	if err != nil {
+		return false, fmt.Errorf("read magic: %w", ErrUnknownFormat)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("ID3")):
+		if ok, err := hasID3Picture(r); ok || err != nil {
+			return ok, err
+		}
+		if magic, err := r.Peek(4); err == nil && bytes.Equal(magic, []byte("fLaC")) {
+			return hasFLACPicture(r)
+		}
+		return false, nil
+	case bytes.HasPrefix(magic, []byte("fLaC")):
+		return hasFLACPicture(r)
+	case bytes.HasPrefix(magic, []byte("OggS")):
+		comments, err := readOggComments(r)
+		if err != nil {
+			return false, noPictureIsFalse(err)
+		}
+		for _, comment := range comments {
+			key, _, _ := strings.Cut(comment, "=")
+			if key = strings.ToUpper(key); key == "METADATA_BLOCK_PICTURE" || key == "COVERART" {
+				return true, nil
+			}
+		}
+		return false, nil
+	case bytes.Equal(magic[4:8], []byte("ftyp")):
+		if _, err := seekMP4Picture(f); err != nil {
+			return false, noPictureIsFalse(err)
+		}
+		return true, nil
+	case isDSD(magic):
+		if err := seekDSDID3(f); err != nil {
+			return false, noPictureIsFalse(err)
+		}
+		return hasID3Picture(bufio.NewReader(f))
+	}
+	return false, ErrUnknownFormat
+}
+
+func noPictureIsFalse(err error) error {
+	if errors.Is(err, ErrNoPicture) {
+		return nil
+	}
+	return err
+}
+
+// readID3Picture reads an ID3v2 tag, leaving r at the end of it
+func readID3Picture(r io.Reader) ([]byte, error) {
+	version, frames, err := readID3Frames(r, func(id string) bool {
+		return id == "APIC" || id == "PIC"
+	})
+	if err != nil {
+		return nil, err
+	}
+	var pictures []picture
+	for _, frame := range frames {
+		if p, ok := parseAPIC(frame.data, version == 2); ok {
+			pictures = append(pictures, p)
+		}
+	}
+	return pickPicture(pictures)
+}
+
+// hasID3Picture leaves r at the end of the tag if there's no picture in it
+func hasID3Picture(r io.Reader) (bool, error) {
+	var found bool
+	err := walkID3Frames(r, func(h id3FrameHeader, _ io.Reader) bool {
+		found = h.id == "APIC" || h.id == "PIC"
+		return !found
+	})
+	return found, err
+}
+
+func parseAPIC(frame []byte, isV22 bool) (picture, bool) {
+	if len(frame) < 2 {
+		return picture{}, false
+	}
+	encoding, rest := frame[0], frame[1:]
+	if isV22 {
+		if len(rest) < 3 {
+			return picture{}, false
+		}
+		rest = rest[3:] // image format, like "JPG"
+	} else {
+		end := bytes.IndexByte(rest, 0)
+		if end < 0 {
+			return picture{}, false
+		}
+		rest = rest[end+1:] // mime type
+	}
+	if len(rest) < 1 {
+		return picture{}, false
+	}
+	typ, rest := rest[0], rest[1:]
+
+	_, rest, ok := cutID3Text(encoding, rest) // description
+	if !ok {
+		return picture{}, false
+	}
+	return picture{typ: uint32(typ), data: rest}, len(rest) > 0
+}
+
+// readFLACPicture reads FLAC metadata blocks until it finds the pictures
+func readFLACPicture(r io.Reader) ([]byte, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, fmt.Errorf("read magic: %w", err)
+	}
+
+	var pictures []picture
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, fmt.Errorf("read block header: %w", err)
+		}
+		isLast, typ := header[0]&0x80 != 0, header[0]&0x7f
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		if typ == flacBlockTypePicture {
+			block := make([]byte, size)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return nil, fmt.Errorf("read picture block: %w", err)
+			}
+			if p, ok := parseFLACPicture(block); ok {
+				pictures = append(pictures, p)
+			}
+		} else if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+			return nil, fmt.Errorf("skip block: %w", err)
+		}
+		if isLast {
+			break
+		}
+	}
+	return pickPicture(pictures)
+}
+
+// hasFLACPicture reads FLAC metadata block headers until it finds a picture
+func hasFLACPicture(r io.Reader) (bool, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return false, fmt.Errorf("read magic: %w", err)
+	}
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return false, fmt.Errorf("read block header: %w", err)
+		}
+		isLast, typ := header[0]&0x80 != 0, header[0]&0x7f
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		if typ == flacBlockTypePicture {
+			return true, nil
+		}
+		if isLast {
+			return false, nil
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+			return false, fmt.Errorf("skip block: %w", err)
+		}
+	}
+}
+
+// parseFLACPicture parses a METADATA_BLOCK_PICTURE, which is also used base64 encoded in Vorbis comments
+func parseFLACPicture(block []byte) (picture, bool) {
+	var p picture
+	b := block
+	next := func(n int) []byte {
+		if n < 0 || n > len(b) {
+			b = nil
+			return nil
+		}
+		r := b[:n]
+		b = b[n:]
+		return r
+	}
+	u32 := func() int {
+		v := next(4)
+		if v == nil {
+			return -1
+		}
+		return int(binary.BigEndian.Uint32(v))
+	}
+
+	typ := u32()
+	next(u32()) // mime type
+	next(u32()) // description
+	next(16)    // width, height, colour depth, indexed colours
+	data := next(u32())
+	if typ < 0 || len(data) == 0 {
+		return p, false
+	}
+	p.typ, p.data = uint32(typ), data
+	return p, true
+}
+
+// readOggPicture reads the pictures from the Vorbis comments
+func readOggPicture(r io.Reader) ([]byte, error) {
+	comments, err := readOggComments(r)
+	if err != nil {
+		return nil, err
+	}
+	var pictures []picture
+	for _, comment := range comments {
+		key, value, _ := strings.Cut(comment, "=")
+		switch strings.ToUpper(key) {
+		case "METADATA_BLOCK_PICTURE":
+			block, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				continue
+			}
+			if p, ok := parseFLACPicture(block); ok {
+				pictures = append(pictures, p)
+			}
+		case "COVERART":
+			// deprecated, but still written by some taggers
+			data, err := base64.StdEncoding.DecodeString(value)
+			if err != nil || len(data) == 0 {
+				continue
+			}
+			pictures = append(pictures, picture{typ: pictureTypeFrontCover, data: data})
+		}
+	}
+	return pickPicture(pictures)
+}
+
+// readOggComments reads the comment header, the second packet of the first logical stream
+func readOggComments(r io.Reader) ([]string, error) {
+	var packet []byte
+	var packets int
+	for packets < 2 {
+		var header [27]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, fmt.Errorf("read page header: %w", err)
+		}
+		if !bytes.Equal(header[:4], []byte("OggS")) {
+			return nil, ErrInvalidMetadata
+		}
+		lacing := make([]byte, header[26])
+		if _, err := io.ReadFull(r, lacing); err != nil {
+			return nil, fmt.Errorf("read lacing: %w", err)
+		}
+		for _, size := range lacing {
+			segment := make([]byte, size)
+			if _, err := io.ReadFull(r, segment); err != nil {
+				return nil, fmt.Errorf("read segment: %w", err)
+			}
+			if packets == 1 {
+				packet = append(packet, segment...)
+				if len(packet) > maxMetadataSize {
+					return nil, ErrInvalidMetadata
+				}
+			}
+			if size < 255 {
+				packets++
+				if packets == 2 {
+					break
+				}
+			}
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+		packet = packet[7:]
+	case bytes.HasPrefix(packet, []byte("OpusTags")):
+		packet = packet[8:]
+	default:
+		return nil, ErrNoPicture // not vorbis or opus
+	}
+
+	var comments []string
+	b := packet
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		size := int(binary.LittleEndian.Uint32(b))
+		if size > len(b)-4 {
+			return nil, false
+		}
+		r := b[4 : 4+size]
+		b = b[4+size:]
+		return r, true
+	}
+	if _, ok := next(); !ok { // vendor
+		return nil, ErrInvalidMetadata
+	}
+	if len(b) < 4 {
+		return nil, ErrInvalidMetadata
+	}
+	count := int(binary.LittleEndian.Uint32(b))
+	b = b[4:]
+	for i := 0; i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			break
+		}
+		comments = append(comments, string(comment))
+	}
+	return comments, nil
+}
+
+func readMP4Picture(r io.ReadSeeker) ([]byte, error) {
+	size, err := seekMP4Picture(r)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("read data: %w", err)
+	}
+	return data, nil
+}
+
+// seekMP4Picture follows the moov.udta.meta.ilst.covr atoms to the first image, leaving r at its start
+func seekMP4Picture(r io.ReadSeeker) (int64, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	path := []string{"moov", "udta", "meta", "ilst", "covr", "data"}
+	var end int64 = -1
+	for depth := 0; depth < len(path); {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return 0, ErrNoPicture
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			return 0, ErrNoPicture // atom extends to the end of the file
+		case 1:
+			var large [8]byte
+			if _, err := io.ReadFull(r, large[:]); err != nil {
+				return 0, ErrNoPicture
+			}
+			size = int64(binary.BigEndian.Uint64(large[:]))
+			headerSize += 8
+		}
+		if size < headerSize {
+			return 0, ErrInvalidMetadata
+		}
+		pos, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		if end >= 0 && pos-headerSize >= end {
+			return 0, ErrNoPicture // left the parent atom without finding the child
+		}
+
+		if string(header[4:8]) != path[depth] {
+			if _, err := r.Seek(size-headerSize, io.SeekCurrent); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		end = pos - headerSize + size
+		depth++
+
+		switch path[depth-1] {
+		case "meta":
+			// a full atom, with version and flags before its children
+			if _, err := r.Seek(4, io.SeekCurrent); err != nil {
+				return 0, err
+			}
+		case "data":
+			bodySize := size - headerSize - 8 // after type and locale
+			if bodySize <= 0 || bodySize > maxMetadataSize {
+				return 0, ErrInvalidMetadata
+			}
+			if _, err := r.Seek(8, io.SeekCurrent); err != nil {
+				return 0, err
+			}
+			return bodySize, nil
+		}
+	}
+	return 0, ErrNoPicture
+}
+
+type picture struct {
+	typ  uint32
+	data []byte
+}
+
+func pickPicture(pictures []picture) ([]byte, error) {
+	if len(pictures) == 0 {
+		return nil, ErrNoPicture
+	}
+	for _, p := range pictures {
+		if p.typ == pictureTypeFrontCover {
+			return p.data, nil
+		}
+	}
+	return pictures[0].data, nil
+}
@@ -0,0 +1,216 @@
+package tags_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.senan.xyz/gonic/scanner/tags"
+)
+
+var (
+	frontCover = []byte("\x89PNG front cover")
+	backCover  = []byte("\xff\xd8 back cover")
+)
+
+func TestReadPicture(t *testing.T) {
+	t.Parallel()
+
+	tcases := []struct {
+		name string
+		data []byte
+	}{
+		{"id3v23.mp3", id3(3, apic(4, backCover), apic(3, frontCover))},
+		{"id3v24.mp3", id3(4, apic(3, frontCover))},
+		{"id3v22.mp3", id3(2, pic(frontCover))},
+		{"id3-then-flac.flac", append(id3(3), flac(flacPicture(3, frontCover))...)},
+		{"flac.flac", flac(flacPicture(4, backCover), flacPicture(3, frontCover))},
+		{"vorbis.ogg", ogg("\x03vorbis", "TITLE=a", "METADATA_BLOCK_PICTURE="+base64.StdEncoding.EncodeToString(flacPicture(3, frontCover)))},
+		{"opus.opus", ogg("OpusTags", "metadata_block_picture="+base64.StdEncoding.EncodeToString(flacPicture(3, frontCover)))},
+		{"mp4.m4a", mp4(frontCover)},
+		{"dsf.dsf", dsf(id3(3, apic(3, frontCover)))},
+		{"dff.dff", dff(id3(3, apic(3, frontCover)))},
+	}
+	for _, tcase := range tcases {
+		tcase := tcase
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), tcase.name)
+			require.NoError(t, os.WriteFile(path, tcase.data, 0o600))
+
+			picture, err := tags.ReadPicture(path)
+			require.NoError(t, err)
+			require.Equal(t, frontCover, picture)
+
+			hasPicture, err := tags.HasPicture(path)
+			require.NoError(t, err)
+			require.True(t, hasPicture)
+		})
+	}
+}
+
+func TestReadPictureMissing(t *testing.T) {
+	t.Parallel()
+
+	tcases := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"id3.mp3", id3(3, frame("TIT2", []byte("\x00title"))), tags.ErrNoPicture},
+		{"flac.flac", flac(), tags.ErrNoPicture},
+		{"ogg.ogg", ogg("OpusTags", "TITLE=a"), tags.ErrNoPicture},
+		{"mp4.m4a", mp4(nil), tags.ErrNoPicture},
+		{"unknown.wav", []byte("RIFF....WAVE"), tags.ErrUnknownFormat},
+	}
+	for _, tcase := range tcases {
+		tcase := tcase
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), tcase.name)
+			require.NoError(t, os.WriteFile(path, tcase.data, 0o600))
+
+			_, err := tags.ReadPicture(path)
+			require.ErrorIs(t, err, tcase.err)
+
+			hasPicture, err := tags.HasPicture(path)
+			if errors.Is(tcase.err, tags.ErrNoPicture) {
+				require.NoError(t, err) // just false
+			} else {
+				require.ErrorIs(t, err, tcase.err)
+			}
+			require.False(t, hasPicture)
+		})
+	}
+}
+
+func id3(version byte, frames ...[]byte) []byte {
+	// v2.4 frame sizes are syncsafe, which is the same as plain for frames this small
+	body := bytes.Join(frames, nil)
+	size := len(body)
+	header := []byte{'I', 'D', '3', version, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(header, body...)
+}
+
+func frame(id string, data []byte) []byte {
+	header := make([]byte, 10)
+	copy(header, id)
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	return append(header, data...)
+}
+
+func apic(typ byte, data []byte) []byte {
+	var body []byte
+	body = append(body, 0)                  // latin1
+	body = append(body, "image/png\x00"...) // mime
+	body = append(body, typ)
+	body = append(body, "description\x00"...)
+	return frame("APIC", append(body, data...))
+}
+
+func pic(data []byte) []byte {
+	var body []byte
+	body = append(body, 1) // utf16
+	body = append(body, "PNG"...)
+	body = append(body, 3)
+	body = append(body, 'd', 0, 0, 0)
+	body = append(body, data...)
+	header := []byte{'P', 'I', 'C', byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	return append(header, body...)
+}
+
+func flacPicture(typ uint32, data []byte) []byte {
+	var b bytes.Buffer
+	u32 := func(v uint32) { _ = binary.Write(&b, binary.BigEndian, v) }
+	u32(typ)
+	u32(uint32(len("image/png")))
+	b.WriteString("image/png")
+	u32(0) // description
+	u32(1) // width
+	u32(1) // height
+	u32(24)
+	u32(0)
+	u32(uint32(len(data)))
+	b.Write(data)
+	return b.Bytes()
+}
+
+func flac(pictures ...[]byte) []byte {
+	out := []byte("fLaC")
+	blocks := append([][]byte{make([]byte, 34)}, pictures...) // streaminfo first
+	for i, block := range blocks {
+		typ := byte(6)
+		if i == 0 {
+			typ = 0
+		}
+		if i == len(blocks)-1 {
+			typ |= 0x80
+		}
+		out = append(out, typ, byte(len(block)>>16), byte(len(block)>>8), byte(len(block)))
+		out = append(out, block...)
+	}
+	return out
+}
+
+func ogg(magic string, comments ...string) []byte {
+	var packet bytes.Buffer
+	u32 := func(v uint32) { _ = binary.Write(&packet, binary.LittleEndian, v) }
+	packet.WriteString(magic)
+	u32(uint32(len("vendor")))
+	packet.WriteString("vendor")
+	u32(uint32(len(comments)))
+	for _, c := range comments {
+		u32(uint32(len(c)))
+		packet.WriteString(c)
+	}
+	return append(oggPage([]byte("OpusHead")), oggPage(packet.Bytes())...)
+}
+
+func oggPage(packet []byte) []byte {
+	var lacing []byte
+	for n := len(packet); ; n -= 255 {
+		if n < 255 {
+			lacing = append(lacing, byte(n))
+			break
+		}
+		lacing = append(lacing, 255)
+	}
+	header := make([]byte, 27)
+	copy(header, "OggS")
+	header[26] = byte(len(lacing))
+	out := append(header, lacing...)
+	return append(out, packet...)
+}
+
+func atom(typ string, children ...[]byte) []byte {
+	body := bytes.Join(children, nil)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(8+len(body)))
+	copy(header[4:], typ)
+	return append(header, body...)
+}
+
+func mp4(cover []byte) []byte {
+	var ilst []byte
+	if cover != nil {
+		ilst = atom("covr", atom("data", []byte{0, 0, 0, 14, 0, 0, 0, 0}, cover))
+	}
+	return bytes.Join([][]byte{
+		atom("ftyp", []byte("M4A \x00\x00\x00\x00")),
+		atom("mdat", make([]byte, 100)),
+		atom("moov",
+			atom("mvhd", make([]byte, 20)),
+			atom("udta",
+				atom("meta", make([]byte, 4),
+					atom("hdlr", make([]byte, 20)),
+					atom("ilst", atom("\xa9nam", atom("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte("title"))), ilst),
+				),
+			),
+		),
+	}, nil)
+}
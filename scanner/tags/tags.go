@@ -1,6 +1,8 @@
 package tags
 
 import (
+	"errors"
+	"math"
 	"strconv"
 	"strings"
 
@@ -11,12 +13,44 @@ type TagReader struct{}
 
 func (*TagReader) Read(abspath string) (Parser, error) {
 	raw, props, err := audiotags.Read(abspath)
-	return &Tagger{raw, props}, err
+	if err != nil {
+		return nil, err
+	}
+	return &Tagger{raw, properties{
+		length:     props.Length,
+		bitrate:    props.Bitrate,
+		sampleRate: props.Samplerate,
+		channels:   props.Channels,
+	}, abspath}, nil
+}
+
+// ChainReader tries each of its readers in turn, for formats which the first can't read
+type ChainReader []Reader
+
+func (c ChainReader) Read(abspath string) (Parser, error) {
+	var errs []error
+	for _, r := range c {
+		parser, err := r.Read(abspath)
+		if err == nil {
+			return parser, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
 }
 
 type Tagger struct {
-	raw   map[string][]string
-	props *audiotags.AudioProperties
+	raw     map[string][]string
+	props   properties
+	abspath string
+}
+
+type properties struct {
+	length     int // in seconds
+	bitrate    int // in kbps
+	sampleRate int // in Hz
+	bitDepth   int // zero for lossy formats, or if the reader doesn't know it
+	channels   int
 }
 
 // https://picard-docs.musicbrainz.org/downloads/MusicBrainz_Picard_Tag_Map.html
@@ -24,12 +58,45 @@ type Tagger struct {
 func (t *Tagger) Title() string          { return first(find(t.raw, "title")) }
 func (t *Tagger) BrainzID() string       { return first(find(t.raw, "musicbrainz_trackid")) } // musicbrainz recording ID
 func (t *Tagger) Artist() string         { return first(find(t.raw, "artist")) }
+func (t *Tagger) Artists() []string      { return find(t.raw, "artists") }
 func (t *Tagger) Album() string          { return first(find(t.raw, "album")) }
 func (t *Tagger) AlbumArtist() string    { return first(find(t.raw, "albumartist", "album artist")) }
 func (t *Tagger) AlbumArtists() []string { return find(t.raw, "albumartists", "album_artists") }
 func (t *Tagger) AlbumBrainzID() string  { return first(find(t.raw, "musicbrainz_albumid")) } // musicbrainz release ID
-func (t *Tagger) Genre() string          { return first(find(t.raw, "genre")) }
-func (t *Tagger) Genres() []string       { return find(t.raw, "genres") }
+func (t *Tagger) ArtistBrainzIDs() []string {
+	return splitValues(find(t.raw, "musicbrainz_artistid"), ";", "/")
+}
+func (t *Tagger) AlbumArtistBrainzIDs() []string {
+	return splitValues(find(t.raw, "musicbrainz_albumartistid"), ";", "/")
+}
+
+func (t *Tagger) TitleSort() string          { return first(find(t.raw, "titlesort")) }
+func (t *Tagger) AlbumSort() string          { return first(find(t.raw, "albumsort")) }
+func (t *Tagger) ArtistSorts() []string      { return find(t.raw, "artistsort") }
+func (t *Tagger) AlbumArtistSorts() []string { return find(t.raw, "albumartistsort") }
+
+func (t *Tagger) Genre() string    { return first(find(t.raw, "genre")) }
+func (t *Tagger) Genres() []string { return find(t.raw, "genres") }
+
+func (t *Tagger) Composer() string      { return first(find(t.raw, "composer")) }
+func (t *Tagger) Conductor() string     { return first(find(t.raw, "conductor")) }
+func (t *Tagger) Lyricist() string      { return first(find(t.raw, "lyricist")) }
+func (t *Tagger) Label() string         { return first(find(t.raw, "label", "publisher", "organization")) }
+func (t *Tagger) CatalogNumber() string { return first(find(t.raw, "catalognumber")) }
+func (t *Tagger) Comment() string       { return first(find(t.raw, "comment", "description")) }
+func (t *Tagger) DiscSubtitle() string  { return first(find(t.raw, "discsubtitle", "setsubtitle")) }
+func (t *Tagger) OriginalDate() string  { return first(find(t.raw, "originaldate", "originalyear")) }
+
+func (t *Tagger) BPM() int {
+	bpm, _ := strconv.ParseFloat(first(find(t.raw, "bpm")), 64)
+	return int(math.Round(bpm))
+}
+func (t *Tagger) Compilation() bool {
+	return parseBool(first(find(t.raw, "compilation")))
+}
+func (t *Tagger) ReleaseTypes() []string {
+	return splitValues(find(t.raw, "releasetype", "musicbrainz_albumtype"), ";", "/")
+}
 
 func (t *Tagger) TrackNumber() int {
 	return intSep("/" /* eg. 5/12 */, first(find(t.raw, "tracknumber")))
@@ -41,8 +108,55 @@ func (t *Tagger) Year() int {
 	return intSep("-" /* 2023-12-01 */, first(find(t.raw, "originaldate", "date", "year")))
 }
 
-func (t *Tagger) Length() int  { return t.props.Length }
-func (t *Tagger) Bitrate() int { return t.props.Bitrate }
+// https://wiki.hydrogenaud.io/index.php?title=ReplayGain_2.0_specification#Metadata_format
+
+func (t *Tagger) ReplayGainTrackGain() float32 {
+	return parseGain(first(find(t.raw, "replaygain_track_gain")))
+}
+func (t *Tagger) ReplayGainTrackPeak() float32 {
+	return parseGain(first(find(t.raw, "replaygain_track_peak")))
+}
+func (t *Tagger) ReplayGainAlbumGain() float32 {
+	return parseGain(first(find(t.raw, "replaygain_album_gain")))
+}
+func (t *Tagger) ReplayGainAlbumPeak() float32 {
+	return parseGain(first(find(t.raw, "replaygain_album_peak")))
+}
+
+// https://datatracker.ietf.org/doc/html/rfc7845#section-5.2.1
+
+func (t *Tagger) R128TrackGain() int {
+	out, _ := strconv.Atoi(first(find(t.raw, "r128_track_gain")))
+	return out
+}
+func (t *Tagger) R128AlbumGain() int {
+	out, _ := strconv.Atoi(first(find(t.raw, "r128_album_gain")))
+	return out
+}
+
+func (t *Tagger) Length() int     { return t.props.length }
+func (t *Tagger) Bitrate() int    { return t.props.bitrate }
+func (t *Tagger) SampleRate() int { return t.props.sampleRate }
+func (t *Tagger) BitDepth() int   { return t.props.bitDepth }
+func (t *Tagger) Channels() int   { return t.props.channels }
+
+// Picture reads the embedded picture from the file lazily, since it's only needed for some tracks
+func (t *Tagger) Picture() ([]byte, error) { return ReadPicture(t.abspath) }
+
+// HasPicture checks for an embedded picture without reading it
+func (t *Tagger) HasPicture() bool {
+	ok, _ := HasPicture(t.abspath)
+	return ok
+}
+
+// Lyrics finds unsynced lyrics in the tags, along with synced ones from ID3v2 SYLT frames
+func (t *Tagger) Lyrics() []string {
+	lyrics := find(t.raw, "lyrics", "unsyncedlyrics")
+	if synced, err := ReadSyncedLyrics(t.abspath); err == nil {
+		lyrics = append(lyrics, synced...)
+	}
+	return lyrics
+}
 
 type Reader interface {
 	Read(abspath string) (Parser, error)
@@ -52,17 +166,50 @@ type Parser interface {
 	Title() string
 	BrainzID() string
 	Artist() string
+	Artists() []string
 	Album() string
 	AlbumArtist() string
 	AlbumArtists() []string
 	AlbumBrainzID() string
+	ArtistBrainzIDs() []string // musicbrainz artist IDs, one for each of the track's artists
+	AlbumArtistBrainzIDs() []string
+	TitleSort() string
+	AlbumSort() string
+	ArtistSorts() []string // sort names like "Beatles, The", one for each of the track's artists
+	AlbumArtistSorts() []string
 	Genre() string
 	Genres() []string
 	TrackNumber() int
 	DiscNumber() int
 	Length() int
 	Bitrate() int
+	SampleRate() int
+	BitDepth() int
+	Channels() int
 	Year() int
+
+	Composer() string
+	Conductor() string
+	Lyricist() string
+	Label() string
+	CatalogNumber() string
+	Comment() string
+	BPM() int
+	Compilation() bool
+	ReleaseTypes() []string // musicbrainz release types like "album", "live"
+	OriginalDate() string   // like 2006, 2006-01, or 2006-01-02
+	DiscSubtitle() string
+
+	ReplayGainTrackGain() float32 // in dB
+	ReplayGainTrackPeak() float32
+	ReplayGainAlbumGain() float32
+	ReplayGainAlbumPeak() float32
+	R128TrackGain() int // in Q7.8 fixed point dB, relative to -23 LUFS
+	R128AlbumGain() int
+
+	Picture() ([]byte, error)
+	HasPicture() bool
+	Lyrics() []string
 }
 
 func fallback(or string, strs ...string) string {
@@ -103,12 +250,54 @@ func filterStr(ss []string) []string {
 	return r
 }
 
+// normaliseKey lower cases a tag name like taglib does, including its names for the MusicBrainz tags
+// which ID3v2 and MP4 store as free form text, like "MusicBrainz Album Id" for musicbrainz_albumid
+func normaliseKey(key string) string {
+	key = strings.ToLower(key)
+	if name, ok := strings.CutPrefix(key, "musicbrainz "); ok {
+		key = "musicbrainz_" + strings.ReplaceAll(name, " ", "")
+	}
+	return key
+}
+
 func intSep(sep, in string) int {
 	start, _, _ := strings.Cut(in, sep)
 	out, _ := strconv.Atoi(start)
 	return out
 }
 
+func parseBool(in string) bool {
+	out, _ := strconv.ParseBool(strings.TrimSpace(in))
+	return out
+}
+
+// splitValues splits values which some taggers write joined by a separator, instead of as
+// multiple values
+func splitValues(values []string, seps ...string) []string {
+	var out []string
+	for _, v := range values {
+		for _, sep := range seps {
+			v = strings.ReplaceAll(v, sep, "\x00")
+		}
+		for _, part := range strings.Split(v, "\x00") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, strings.ToLower(part))
+			}
+		}
+	}
+	return out
+}
+
+// parseGain parses a gain like "-6.54 dB", or a peak like "0.988212"
+func parseGain(in string) float32 {
+	in = strings.TrimSpace(in)
+	if len(in) > 2 && strings.EqualFold(in[len(in)-2:], "db") {
+		in = strings.TrimSpace(in[:len(in)-2])
+	}
+	out, _ := strconv.ParseFloat(in, 32)
+	return float32(out)
+}
+
 func MustAlbum(p Parser) string {
 	if r := p.Album(); r != "" {
 		return r
@@ -123,6 +312,13 @@ func MustArtist(p Parser) string {
 	return "Unknown Artist"
 }
 
+func MustArtists(p Parser) []string {
+	if r := p.Artists(); len(r) > 0 {
+		return r
+	}
+	return []string{MustArtist(p)}
+}
+
 func MustAlbumArtist(p Parser) string {
 	if r := p.AlbumArtist(); r != "" {
 		return r
@@ -89,6 +89,21 @@ func (c *Client) ArtistGetInfo(apiKey string, artistName string) (Artist, error)
 	return resp.Artist, nil
 }
 
+// ArtistGetInfoByMBID is like ArtistGetInfo, but looks the artist up by their musicbrainz ID. the
+// name is still sent, last.fm uses it when it doesn't know the ID
+func (c *Client) ArtistGetInfoByMBID(apiKey string, artistName, artistMBID string) (Artist, error) {
+	params := url.Values{}
+	params.Add("method", "artist.getInfo")
+	params.Add("api_key", apiKey)
+	params.Add("artist", artistName)
+	params.Add("mbid", artistMBID)
+	resp, err := c.makeRequest("GET", params)
+	if err != nil {
+		return Artist{}, fmt.Errorf("making artist GET: %w", err)
+	}
+	return resp.Artist, nil
+}
+
 func (c *Client) ArtistGetTopTracks(apiKey, artistName string) (TopTracks, error) {
 	params := url.Values{}
 	params.Add("method", "artist.getTopTracks")
@@ -145,6 +145,36 @@ func TestArtistGetInfo_clientRequestFails(t *testing.T) {
 	require.Zero(actual)
 }
 
+func TestArtistGetInfoByMBID(t *testing.T) {
+	// arrange
+	require := require.New(t)
+	httpClient, shutdown := httpClientMock(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(http.MethodGet, r.Method)
+		require.Equal(url.Values{
+			"method":  []string{"artist.getInfo"},
+			"api_key": []string{"apiKey1"},
+			"artist":  []string{"Artist 1"},
+			"mbid":    []string{"366c1119-ec4f-4312-b729-a5637d148e3e"},
+		}, r.URL.Query())
+		require.Equal("/2.0/", r.URL.Path)
+		require.Equal(baseURL, "https://"+r.Host+r.URL.Path)
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(artistGetInfoResponse))
+	}))
+	defer shutdown()
+
+	client := Client{&httpClient}
+
+	// act
+	actual, err := client.ArtistGetInfoByMBID("apiKey1", "Artist 1", "366c1119-ec4f-4312-b729-a5637d148e3e")
+
+	// assert
+	require.NoError(err)
+	require.Equal("Artist 1", actual.Name)
+	require.Equal("366c1119-ec4f-4312-b729-a5637d148e3e", actual.MBID)
+}
+
 //go:embed testdata/artist_get_top_tracks_response.xml
 var artistGetTopTracksResponse string
 
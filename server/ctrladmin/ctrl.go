@@ -24,6 +24,7 @@ import (
 	"go.senan.xyz/gonic"
 	"go.senan.xyz/gonic/db"
 	"go.senan.xyz/gonic/podcasts"
+	"go.senan.xyz/gonic/scanner"
 	"go.senan.xyz/gonic/scrobble/lastfm"
 	"go.senan.xyz/gonic/server/ctrladmin/adminui"
 	"go.senan.xyz/gonic/server/ctrlbase"
@@ -54,6 +55,16 @@ func funcMap() template.FuncMap {
 		},
 		"dateHuman": humanize.Time,
 		"base64":    base64.StdEncoding.EncodeToString,
+		"bytes": func(in int64) string {
+			return humanize.Bytes(uint64(in))
+		},
+		"duration": func(secs int) string {
+			d := time.Duration(secs) * time.Second
+			if d < time.Hour {
+				return fmt.Sprintf("%dm", int(d.Minutes()))
+			}
+			return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+		},
 		"props": func(parent any, values ...any) map[string]any {
 			if len(values)%2 != 0 {
 				panic("uneven number of key/value pairs")
@@ -80,9 +91,10 @@ type Controller struct {
 	sessDB       *gormstore.Store
 	Podcasts     *podcasts.Podcasts
 	lastfmClient *lastfm.Client
+	backups      *db.Backups // nil without a backup path
 }
 
-func New(b *ctrlbase.Controller, sessDB *gormstore.Store, podcasts *podcasts.Podcasts, lastfmClient *lastfm.Client) (*Controller, error) {
+func New(b *ctrlbase.Controller, sessDB *gormstore.Store, podcasts *podcasts.Podcasts, lastfmClient *lastfm.Client, backups *db.Backups) (*Controller, error) {
 	tmpl, err := template.
 		New("layout").
 		Funcs(template.FuncMap(sprig.FuncMap())).
@@ -101,6 +113,7 @@ func New(b *ctrlbase.Controller, sessDB *gormstore.Store, podcasts *podcasts.Pod
 		sessDB:       sessDB,
 		Podcasts:     podcasts,
 		lastfmClient: lastfmClient,
+		backups:      backups,
 	}, nil
 }
 
@@ -115,9 +128,12 @@ type templateData struct {
 	TrackCount           int
 	RequestRoot          string
 	RecentFolders        []*db.Album
+	MissingFolders       []*db.Album
+	MissingTrackCount    int
 	AllUsers             []*db.User
 	LastScanTime         time.Time
 	IsScanning           bool
+	ScanProgress         *scanner.ScanProgress
 	TranscodePreferences []*db.TranscodePreference
 	TranscodeProfiles    []string
 
@@ -129,8 +145,22 @@ type templateData struct {
 	Podcasts              []*db.Podcast
 	InternetRadioStations []*db.InternetRadioStation
 
+	BackupPath string
+	Backups    []*db.BackupFile
+
 	// avatar
 	Avatar []byte
+
+	// scan errors
+	ScanErrorCount  int
+	ScanErrors      []*db.ScanError
+	ScanErrorKinds  []db.ScanErrorKind
+	ScanErrorFilter db.ScanError // the kind and part of the path to filter by
+
+	// listening stats
+	ListenStats  *db.ListenStats
+	ListenRange  string
+	ListenRanges []string
 }
 
 type Response struct {
@@ -11,6 +11,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"time"
@@ -46,8 +47,8 @@ func (c *Controller) ServeHome(r *http.Request) *Response {
 	data := &templateData{}
 	// stats box
 	c.DB.Model(&db.Artist{}).Count(&data.ArtistCount)
-	c.DB.Model(&db.Album{}).Count(&data.AlbumCount)
-	c.DB.Table("tracks").Count(&data.TrackCount)
+	c.DB.Model(&db.Album{}).Where("missing_since IS NULL").Count(&data.AlbumCount)
+	c.DB.Table("tracks").Where("missing_since IS NULL").Count(&data.TrackCount)
 	// lastfm box
 	data.RequestRoot = c.BaseURL(r)
 	data.CurrentLastFMAPIKey, _ = c.DB.GetSetting("lastfm_api_key")
@@ -62,15 +63,28 @@ func (c *Controller) ServeHome(r *http.Request) *Response {
 
 	// recent folders box
 	c.DB.
+		Where("tag_group='' AND missing_since IS NULL").
 		Order("created_at DESC").
 		Limit(20).
 		Find(&data.RecentFolders)
 
+	// missing box
+	c.DB.Model(&db.Track{}).Where("missing_since IS NOT NULL").Count(&data.MissingTrackCount)
+	c.DB.
+		Where("tag_group='' AND missing_since IS NOT NULL").
+		Order("missing_since DESC, left_path, right_path").
+		Limit(20).
+		Find(&data.MissingFolders)
+
 	data.IsScanning = c.Scanner.IsScanning()
+	if progress, ok := c.Scanner.Progress(); ok {
+		data.ScanProgress = &progress
+	}
 	if tStr, _ := c.DB.GetSetting("last_scan_time"); tStr != "" {
 		i, _ := strconv.ParseInt(tStr, 10, 64)
 		data.LastScanTime = time.Unix(i, 0)
 	}
+	c.DB.Model(&db.ScanError{}).Count(&data.ScanErrorCount)
 
 	// transcoding box
 	c.DB.
@@ -86,6 +100,12 @@ func (c *Controller) ServeHome(r *http.Request) *Response {
 	// internet radio box
 	c.DB.Find(&data.InternetRadioStations)
 
+	// backups box
+	if c.backups != nil && user.IsAdmin {
+		data.BackupPath = c.backups.Dir()
+		data.Backups, _ = c.backups.List()
+	}
+
 	return &Response{
 		template: "home.tmpl",
 		data:     data,
@@ -384,6 +404,100 @@ func (c *Controller) ServeStartScanFullDo(_ *http.Request) *Response {
 	}
 }
 
+func (c *Controller) ServeBackupDBDo(_ *http.Request) *Response {
+	if c.backups == nil {
+		return &Response{redirect: "/admin/home", flashW: []string{"please set db-backup-path to back up the database"}}
+	}
+	backup, err := c.backups.Create()
+	if err != nil {
+		return &Response{redirect: "/admin/home", flashW: []string{fmt.Sprintf("couldn't back up database: %v", err)}}
+	}
+	return &Response{
+		redirect: "/admin/home",
+		flashN:   []string{fmt.Sprintf("backed up database to `%s`", backup.Path)},
+	}
+}
+
+func (c *Controller) ServeScanErrors(r *http.Request) *Response {
+	data := &templateData{}
+	data.ScanErrorFilter.Kind = db.ScanErrorKind(r.URL.Query().Get("kind"))
+	data.ScanErrorFilter.Path = r.URL.Query().Get("path")
+	data.ScanErrorKinds = []db.ScanErrorKind{
+		db.ScanErrorKindFolder,
+		db.ScanErrorKindFile,
+		db.ScanErrorKindTags,
+		db.ScanErrorKindWrite,
+	}
+
+	q := c.DB.Order("path")
+	if kind := data.ScanErrorFilter.Kind; kind != "" {
+		q = q.Where("kind=?", kind)
+	}
+	if path := data.ScanErrorFilter.Path; path != "" {
+		q = q.Where(fmt.Sprintf("path %s ?", c.DB.ILike()), "%"+path+"%")
+	}
+	if err := q.Find(&data.ScanErrors).Error; err != nil {
+		return &Response{redirect: "/admin/home", flashW: []string{fmt.Sprintf("couldn't find scan errors: %v", err)}}
+	}
+	return &Response{
+		template: "scan_errors.tmpl",
+		data:     data,
+	}
+}
+
+func (c *Controller) ServeStats(r *http.Request) *Response {
+	user := r.Context().Value(CtxUser).(*db.User)
+
+	data := &templateData{}
+	data.ListenRange = r.URL.Query().Get("range")
+	if data.ListenRange == "" {
+		data.ListenRange = "month"
+	}
+	now := time.Now()
+	from, to, err := db.ListenRange(data.ListenRange, now)
+	if err != nil {
+		return &Response{redirect: "/admin/stats", flashW: []string{fmt.Sprintf("couldn't find range: %v", err)}}
+	}
+	if data.ListenStats, err = c.DB.ListenStats(user.ID, from, to, now.Location(), 10); err != nil {
+		return &Response{redirect: "/admin/home", flashW: []string{fmt.Sprintf("couldn't find stats: %v", err)}}
+	}
+
+	// a year in review for every year since the first listen
+	data.ListenRanges = []string{"week", "month", "year", "all"}
+	var first db.Listen
+	if err := c.DB.Where("user_id=?", user.ID).Order("time").First(&first).Error; err == nil {
+		for year := now.Year(); year >= first.Time.Year(); year-- {
+			data.ListenRanges = append(data.ListenRanges, strconv.Itoa(year))
+		}
+	}
+	return &Response{
+		template: "stats.tmpl",
+		data:     data,
+	}
+}
+
+func (c *Controller) ServeRescanPathDo(r *http.Request) *Response {
+	path := r.FormValue("path")
+	if albumID, _ := strconv.Atoi(r.FormValue("album")); albumID != 0 {
+		var album db.Album
+		if err := c.DB.Where("id=?", albumID).First(&album).Error; err != nil {
+			return &Response{redirect: r.Referer(), flashW: []string{fmt.Sprintf("couldn't find album: %v", err)}}
+		}
+		path = album.AbsPath()
+	}
+	if path == "" {
+		return &Response{redirect: r.Referer(), flashW: []string{"please provide a path"}}
+	}
+	if _, err := c.Scanner.MusicDir(path); !filepath.IsAbs(path) || err != nil {
+		return &Response{redirect: r.Referer(), flashW: []string{fmt.Sprintf("%q is not in a music dir", path)}}
+	}
+	defer doScan(c.Scanner, scanner.ScanOptions{Paths: []string{path}})
+	return &Response{
+		redirect: r.Referer(),
+		flashN:   []string{fmt.Sprintf("scan of `%s` started. refresh for results", path)},
+	}
+}
+
 func (c *Controller) ServeCreateTranscodePrefDo(r *http.Request) *Response {
 	client := r.FormValue("client")
 	profile := r.FormValue("profile")
@@ -36,6 +36,7 @@ func AddRoutes(c *Controller, r *mux.Router) {
 	routUser.Handle("/unlink_listenbrainz_do", c.H(c.ServeUnlinkListenBrainzDo))
 	routUser.Handle("/create_transcode_pref_do", c.H(c.ServeCreateTranscodePrefDo))
 	routUser.Handle("/delete_transcode_pref_do", c.H(c.ServeDeleteTranscodePrefDo))
+	routUser.Handle("/stats", c.H(c.ServeStats))
 
 	// admin routes (if session is valid, and is admin)
 	routAdmin := routUser.NewRoute().Subrouter()
@@ -46,6 +47,9 @@ func AddRoutes(c *Controller, r *mux.Router) {
 	routAdmin.Handle("/update_lastfm_api_key_do", c.H(c.ServeUpdateLastFMAPIKeyDo))
 	routAdmin.Handle("/start_scan_inc_do", c.H(c.ServeStartScanIncDo))
 	routAdmin.Handle("/start_scan_full_do", c.H(c.ServeStartScanFullDo))
+	routAdmin.Handle("/scan_errors", c.H(c.ServeScanErrors))
+	routAdmin.Handle("/rescan_path_do", c.H(c.ServeRescanPathDo))
+	routAdmin.Handle("/backup_db_do", c.H(c.ServeBackupDBDo))
 	routAdmin.Handle("/add_podcast_do", c.H(c.ServePodcastAddDo))
 	routAdmin.Handle("/delete_podcast_do", c.H(c.ServePodcastDeleteDo))
 	routAdmin.Handle("/download_podcast_do", c.H(c.ServePodcastDownloadDo))
@@ -50,6 +50,9 @@ type Controller struct {
 	Podcasts       *podcasts.Podcasts
 	Transcoder     transcode.Transcoder
 	LastFMClient   *lastfm.Client
+
+	IgnoredArticles   []string // like "The", for music without sort tags
+	ListensFromStream bool     // record a listen when a track is streamed, for clients which don't scrobble
 }
 
 type metaResponse struct {
@@ -42,12 +42,13 @@ func (c *Controller) ServeGetBookmarks(r *http.Request) *spec.Response {
 			var track db.Track
 			err := c.DB.
 				Preload("Album").
+				Preload("TagAlbum").
 				Find(&track, "id=?", bookmark.EntryID).
 				Error
 			if err != nil {
 				return spec.NewError(10, "finding entry: %v", err)
 			}
-			respBookmark.Entry = spec.NewTrackByTags(&track, track.Album)
+			respBookmark.Entry = spec.NewTrackByTags(&track, track.AlbumByTags())
 		}
 
 		sub.Bookmarks.List = append(sub.Bookmarks.List, respBookmark)
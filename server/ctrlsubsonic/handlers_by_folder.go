@@ -1,6 +1,7 @@
 package ctrlsubsonic
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -31,19 +32,20 @@ func (c *Controller) ServeGetIndexes(r *http.Request) *spec.Response {
 	}
 	var folders []*db.Album
 	c.DB.
-		Select("*, count(sub.id) child_count").
+		Select("albums.*, count(sub.id) child_count").
 		Preload("AlbumStar", "user_id=?", user.ID).
 		Preload("AlbumRating", "user_id=?", user.ID).
-		Joins("LEFT JOIN albums sub ON albums.id=sub.parent_id").
+		Joins("LEFT JOIN albums sub ON albums.id=sub.parent_id AND sub.missing_since IS NULL").
 		Where("albums.parent_id IN ?", rootQ.SubQuery()).
+		Where(whereAlbumNotMissing).
 		Group("albums.id").
-		Order("albums.right_path COLLATE NOCASE").
+		Order(c.sortExpr("", "albums.right_path")).
 		Find(&folders)
 	// [a-z#] -> 27
 	indexMap := make(map[string]*spec.Index, 27)
 	resp := make([]*spec.Index, 0, 27)
 	for _, folder := range folders {
-		key := lowerUDecOrHash(folder.IndexRightPath())
+		key := lowerUDecOrHash(c.sortName("", folder.IndexRightPath()))
 		if _, ok := indexMap[key]; !ok {
 			indexMap[key] = &spec.Index{
 				Name:    key,
@@ -55,8 +57,9 @@ func (c *Controller) ServeGetIndexes(r *http.Request) *spec.Response {
 	}
 	sub := spec.NewResponse()
 	sub.Indexes = &spec.Indexes{
-		LastModified: 0,
-		Index:        resp,
+		LastModified:    0,
+		IgnoredArticles: strings.Join(c.IgnoredArticles, " "),
+		Index:           resp,
 	}
 	return sub
 }
@@ -70,17 +73,23 @@ func (c *Controller) ServeGetMusicDirectory(r *http.Request) *spec.Response {
 	user := r.Context().Value(CtxUser).(*db.User)
 	childrenObj := []*spec.TrackChild{}
 	folder := &db.Album{}
-	c.DB.
+	err = c.DB.
+		Where(whereAlbumNotMissing).
 		Preload("AlbumStar", "user_id=?", user.ID).
 		Preload("AlbumRating", "user_id=?", user.ID).
-		First(folder, id.Value)
+		First(folder, id.Value).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return spec.NewError(70, "couldn't find a folder with that id")
+	}
 	// start looking for child childFolders in the current dir
 	var childFolders []*db.Album
 	c.DB.
 		Where("parent_id=?", id.Value).
+		Where(whereAlbumNotMissing).
 		Preload("AlbumStar", "user_id=?", user.ID).
 		Preload("AlbumRating", "user_id=?", user.ID).
-		Order("albums.right_path COLLATE NOCASE").
+		Order(c.DB.NoCase("albums.right_path")).
 		Find(&childFolders)
 	for _, ch := range childFolders {
 		childrenObj = append(childrenObj, spec.NewTCAlbumByFolder(ch))
@@ -89,10 +98,12 @@ func (c *Controller) ServeGetMusicDirectory(r *http.Request) *spec.Response {
 	var childTracks []*db.Track
 	c.DB.
 		Where("album_id=?", id.Value).
+		Where(whereTrackNotMissing).
 		Preload("Album").
 		Preload("Album.Artists").
 		Preload("TrackStar", "user_id=?", user.ID).
 		Preload("TrackRating", "user_id=?", user.ID).
+		Preload("TrackPlay", "user_id=?", user.ID).
 		Order("filename").
 		Find(&childTracks)
 
@@ -105,8 +116,7 @@ func (c *Controller) ServeGetMusicDirectory(r *http.Request) *spec.Response {
 			toAppend.ContentType = "audio/mpeg"
 			toAppend.Suffix = "mp3"
 		}
-		toAppend.TranscodedContentType = transcodeMIME
-		toAppend.TranscodedSuffix = transcodeSuffix
+		toAppend.SetTranscoded(transcodeMIME, transcodeSuffix)
 		childrenObj = append(childrenObj, toAppend)
 	}
 	// respond section
@@ -115,6 +125,9 @@ func (c *Controller) ServeGetMusicDirectory(r *http.Request) *spec.Response {
 	return sub
 }
 
+// whereFolder leaves out the albums which only group a folder's tracks by their tags
+const whereFolder = "albums.tag_group=''"
+
 // ServeGetAlbumList handles the getAlbumList view.
 // changes to this function should be reflected in in _by_tags.go's
 // getAlbumListTwo() function
@@ -127,9 +140,9 @@ func (c *Controller) ServeGetAlbumList(r *http.Request) *spec.Response {
 		q = q.Joins(`
 			JOIN albums parent_albums
 			ON albums.parent_id=parent_albums.id`)
-		q = q.Order("parent_albums.right_path")
+		q = q.Order(fmt.Sprintf("min(%s)", c.sortExpr("", "parent_albums.right_path")))
 	case "alphabeticalByName":
-		q = q.Order("right_path")
+		q = q.Order(c.sortExpr("", "albums.right_path"))
 	case "byYear":
 		y1, y2 :=
 			params.GetOrInt("fromYear", 1800),
@@ -143,21 +156,15 @@ func (c *Controller) ServeGetAlbumList(r *http.Request) *spec.Response {
 		q = q.Joins("JOIN genres ON genres.id=album_genres.genre_id AND genres.name=?", genre)
 		q = q.Order("right_path")
 	case "frequent":
-		q = q.Joins(`
-			JOIN plays
-			ON albums.id=plays.album_id AND plays.user_id=?`,
-			user.ID)
-		q = q.Order("plays.length DESC")
+		q = q.Joins(joinAlbumListens, user.ID)
+		q = q.Order("max(listens.length) DESC")
 	case "newest":
 		q = q.Order("created_at DESC")
 	case "random":
 		q = q.Order(gorm.Expr("random()"))
 	case "recent":
-		q = q.Joins(`
-			JOIN plays
-			ON albums.id=plays.album_id AND plays.user_id=?`,
-			user.ID)
-		q = q.Order("plays.time DESC")
+		q = q.Joins(joinAlbumListens, user.ID)
+		q = q.Order("max(listens.time) DESC")
 	case "starred":
 		q = q.Joins("JOIN album_stars ON albums.id=album_stars.album_id AND album_stars.user_id=?", user.ID)
 		q = q.Order("right_path")
@@ -173,7 +180,9 @@ func (c *Controller) ServeGetAlbumList(r *http.Request) *spec.Response {
 	// of children. it might make sense to store that in the db
 	q.
 		Select("albums.*, count(tracks.id) child_count, sum(tracks.length) duration").
-		Joins("LEFT JOIN tracks ON tracks.album_id=albums.id").
+		Joins("LEFT JOIN tracks ON tracks.album_id=albums.id AND tracks.missing_since IS NULL").
+		Where(whereFolder).
+		Where(whereAlbumNotMissing).
 		Group("albums.id").
 		Joins("JOIN album_artists ON album_artists.album_id=albums.id").
 		Offset(params.GetOrInt("offset", 0)).
@@ -196,13 +205,9 @@ func (c *Controller) ServeSearchTwo(r *http.Request) *spec.Response {
 	params := r.Context().Value(CtxParams).(params.Params)
 	user := r.Context().Value(CtxUser).(*db.User)
 	query, err := params.Get("query")
-	var queries []string
 	if err != nil {
 		return spec.NewError(10, "please provide a `query` parameter")
 	}
-	for _, s := range strings.Fields(query) {
-		queries = append(queries, fmt.Sprintf("%%%s%%", strings.Trim(s, `*"'`)))
-	}
 
 	results := &spec.SearchResultTwo{}
 
@@ -216,11 +221,11 @@ func (c *Controller) ServeSearchTwo(r *http.Request) *spec.Response {
 	}
 
 	var artists []*db.Album
-	q := c.DB.Where(`parent_id IN ?`, rootQ.SubQuery())
-	for _, s := range queries {
-		q = q.Where(`right_path LIKE ? OR right_path_u_dec LIKE ?`, s, s)
-	}
-	q = q.Preload("AlbumStar", "user_id=?", user.ID).
+	q := c.DB.
+		Where(`parent_id IN ?`, rootQ.SubQuery()).
+		Where(whereAlbumNotMissing)
+	q = c.whereSearch(q, "albums", query, "albums.right_path", "albums.right_path_u_dec").
+		Preload("AlbumStar", "user_id=?", user.ID).
 		Preload("AlbumRating", "user_id=?", user.ID).
 		Offset(params.GetOrInt("artistOffset", 0)).
 		Limit(params.GetOrInt("artistCount", 20))
@@ -233,11 +238,12 @@ func (c *Controller) ServeSearchTwo(r *http.Request) *spec.Response {
 
 	// search "albums"
 	var albums []*db.Album
-	q = c.DB.Joins("JOIN album_artists ON album_artists.album_id=albums.id")
-	for _, s := range queries {
-		q = q.Where(`right_path LIKE ? OR right_path_u_dec LIKE ?`, s, s)
-	}
-	q = q.Preload("AlbumStar", "user_id=?", user.ID).
+	q = c.DB.
+		Joins("JOIN album_artists ON album_artists.album_id=albums.id").
+		Where(whereFolder).
+		Where(whereAlbumNotMissing)
+	q = c.whereSearch(q, "albums", query, "albums.right_path", "albums.right_path_u_dec").
+		Preload("AlbumStar", "user_id=?", user.ID).
 		Preload("AlbumRating", "user_id=?", user.ID).
 		Offset(params.GetOrInt("albumOffset", 0)).
 		Limit(params.GetOrInt("albumCount", 20))
@@ -254,11 +260,11 @@ func (c *Controller) ServeSearchTwo(r *http.Request) *spec.Response {
 	// search tracks
 	var tracks []*db.Track
 	q = c.DB.Preload("Album")
-	for _, s := range queries {
-		q = q.Where(`filename LIKE ? OR filename LIKE ?`, s, s)
-	}
-	q = q.Preload("TrackStar", "user_id=?", user.ID).
+	q = c.whereSearch(q, "tracks", query, "tracks.filename", "tracks.filename_u_dec").
+		Where(whereTrackNotMissing).
+		Preload("TrackStar", "user_id=?", user.ID).
 		Preload("TrackRating", "user_id=?", user.ID).
+		Preload("TrackPlay", "user_id=?", user.ID).
 		Offset(params.GetOrInt("songOffset", 0)).
 		Limit(params.GetOrInt("songCount", 20))
 	if m := getMusicFolder(c.MusicPaths, params); m != "" {
@@ -274,8 +280,7 @@ func (c *Controller) ServeSearchTwo(r *http.Request) *spec.Response {
 
 	for _, t := range tracks {
 		track := spec.NewTCTrackByFolder(t, t.Album)
-		track.TranscodedContentType = transcodeMIME
-		track.TranscodedSuffix = transcodeSuffix
+		track.SetTranscoded(transcodeMIME, transcodeSuffix)
 		results.Tracks = append(results.Tracks, track)
 	}
 
@@ -308,6 +313,8 @@ func (c *Controller) ServeGetStarred(r *http.Request) *spec.Response {
 		Where(`parent_id IN ?`, rootQ.SubQuery()).
 		Joins("JOIN album_stars ON albums.id=album_stars.album_id").
 		Where("album_stars.user_id=?", user.ID).
+		Where(whereFolder).
+		Where(whereAlbumNotMissing).
 		Preload("AlbumStar", "user_id=?", user.ID).
 		Preload("AlbumRating", "user_id=?", user.ID)
 	if err := q.Find(&artists).Error; err != nil {
@@ -323,6 +330,7 @@ func (c *Controller) ServeGetStarred(r *http.Request) *spec.Response {
 		Joins("JOIN album_artists ON album_artists.album_id=albums.id").
 		Joins("JOIN album_stars ON albums.id=album_stars.album_id").
 		Where("album_stars.user_id=?", user.ID).
+		Where(whereAlbumNotMissing).
 		Preload("AlbumStar", "user_id=?", user.ID).
 		Preload("AlbumRating", "user_id=?", user.ID)
 	if m := getMusicFolder(c.MusicPaths, params); m != "" {
@@ -341,8 +349,10 @@ func (c *Controller) ServeGetStarred(r *http.Request) *spec.Response {
 		Preload("Album").
 		Joins("JOIN track_stars ON tracks.id=track_stars.track_id").
 		Where("track_stars.user_id=?", user.ID).
+		Where(whereTrackNotMissing).
 		Preload("TrackStar", "user_id=?", user.ID).
-		Preload("TrackRating", "user_id=?", user.ID)
+		Preload("TrackRating", "user_id=?", user.ID).
+		Preload("TrackPlay", "user_id=?", user.ID)
 	if m := getMusicFolder(c.MusicPaths, params); m != "" {
 		q = q.
 			Joins("JOIN albums ON albums.id=tracks.album_id").
@@ -356,8 +366,7 @@ func (c *Controller) ServeGetStarred(r *http.Request) *spec.Response {
 
 	for _, t := range tracks {
 		track := spec.NewTCTrackByFolder(t, t.Album)
-		track.TranscodedContentType = transcodeMIME
-		track.TranscodedSuffix = transcodeSuffix
+		track.SetTranscoded(transcodeMIME, transcodeSuffix)
 		results.Tracks = append(results.Tracks, track)
 	}
 
@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"testing"
 
+	_ "github.com/jinzhu/gorm/dialects/postgres"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
 
@@ -42,9 +43,15 @@ func TestSearchTwo(t *testing.T) {
 	t.Parallel()
 	contr := makeController(t)
 
-	runQueryCases(t, contr, contr.ServeSearchTwo, []*queryCase{
+	cases := []*queryCase{
 		{url.Values{"query": {"art"}}, "q_art", false},
 		{url.Values{"query": {"alb"}}, "q_alb", false},
 		{url.Values{"query": {"tra"}}, "q_tra", false},
-	})
+	}
+	// the search index matches every field, and ranks by relevance, so its results have goldens of their own
+	if contr.DB.HasSearchIndex() {
+		t.Run("index", func(t *testing.T) { runQueryCases(t, contr, contr.ServeSearchTwo, cases) })
+		return
+	}
+	runQueryCases(t, contr, contr.ServeSearchTwo, cases)
 }
@@ -13,23 +13,38 @@ import (
 	"github.com/jinzhu/gorm"
 
 	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/scrobble/lastfm"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/params"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/spec"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/specid"
 )
 
+// joinArtistAlbums joins artists to the albums they're an album artist of, along with the albums
+// they only appear on as a track artist. the later discs of multi-disc albums are left out for the first
+const joinArtistAlbums = `JOIN (
+	SELECT album_artists.artist_id, album_artists.album_id FROM album_artists JOIN albums ON albums.id=album_artists.album_id WHERE albums.merged_into_id IS NULL AND albums.missing_since IS NULL
+	UNION SELECT track_artists.artist_id, COALESCE(albums.merged_into_id, albums.id) FROM track_artists JOIN tracks ON tracks.id=track_artists.track_id JOIN albums ON albums.id=tracks.tag_album_id WHERE tracks.missing_since IS NULL
+) artist_albums ON artist_albums.artist_id=artists.id`
+
+// joinAlbumTracks joins albums to their tracks, along with the tracks of the discs merged into them
+const joinAlbumTracks = `LEFT JOIN albums discs ON discs.id=albums.id OR discs.merged_into_id=albums.id
+LEFT JOIN tracks ON tracks.tag_album_id=discs.id AND tracks.missing_since IS NULL`
+
+// whereNotMergedDisc leaves out the later discs of multi-disc albums, which are shown as part of the first
+const whereNotMergedDisc = "albums.merged_into_id IS NULL"
+
 func (c *Controller) ServeGetArtists(r *http.Request) *spec.Response {
 	params := r.Context().Value(CtxParams).(params.Params)
 	user := r.Context().Value(CtxUser).(*db.User)
 	var artists []*db.Artist
 	q := c.DB.
-		Select("*, count(sub.id) album_count").
-		Joins("JOIN album_artists ON album_artists.artist_id=artists.id").
-		Joins("JOIN albums sub ON sub.id=album_artists.album_id").
+		Select("artists.*, count(sub.id) album_count").
+		Joins(joinArtistAlbums).
+		Joins("JOIN albums sub ON sub.id=artist_albums.album_id").
 		Preload("ArtistStar", "user_id=?", user.ID).
 		Preload("ArtistRating", "user_id=?", user.ID).
 		Group("artists.id").
-		Order("artists.name COLLATE NOCASE")
+		Order(c.sortExpr("artists.name_sort", "artists.name"))
 	if m := getMusicFolder(c.MusicPaths, params); m != "" {
 		q = q.Where("sub.root_dir=?", m)
 	}
@@ -40,7 +55,7 @@ func (c *Controller) ServeGetArtists(r *http.Request) *spec.Response {
 	indexMap := make(map[string]*spec.Index, 27)
 	resp := make([]*spec.Index, 0, 27)
 	for _, artist := range artists {
-		key := lowerUDecOrHash(artist.IndexName())
+		key := lowerUDecOrHash(c.sortName(artist.NameSort, artist.IndexName()))
 		if _, ok := indexMap[key]; !ok {
 			indexMap[key] = &spec.Index{
 				Name:    key,
@@ -52,7 +67,8 @@ func (c *Controller) ServeGetArtists(r *http.Request) *spec.Response {
 	}
 	sub := spec.NewResponse()
 	sub.Artists = &spec.Artists{
-		List: resp,
+		IgnoredArticles: strings.Join(c.IgnoredArticles, " "),
+		List:            resp,
 	}
 	return sub
 }
@@ -68,23 +84,55 @@ func (c *Controller) ServeGetArtist(r *http.Request) *spec.Response {
 	c.DB.
 		Preload("Albums", func(db *gorm.DB) *gorm.DB {
 			return db.
-				Select("*, count(sub.id) child_count, sum(sub.length) duration").
-				Joins("LEFT JOIN tracks sub ON albums.id=sub.album_id").
+				// with the join table's artist ID, which the preload needs
+				Select("albums.*, album_artists.artist_id, count(tracks.id) child_count, sum(tracks.length) duration").
+				Joins(joinAlbumTracks).
+				Where(whereNotMergedDisc).
+				Where(whereAlbumNotMissing).
 				Order("albums.right_path").
-				Group("albums.id")
+				Group("albums.id, album_artists.artist_id")
 		}).
 		Preload("Albums.Artists").
 		Preload("Albums.Genres").
 		Preload("ArtistStar", "user_id=?", user.ID).
 		Preload("ArtistRating", "user_id=?", user.ID).
 		First(artist, id.Value)
+
+	// then the albums they only appear on as a track artist, like features and compilations
+	var appearsOn []*db.Album
+	err = c.DB.
+		Select("albums.*, count(tracks.id) child_count, sum(tracks.length) duration").
+		Joins(joinAlbumTracks).
+		Where("albums.id IN ?", c.DB.
+			Table("track_artists").
+			Select("COALESCE(albums.merged_into_id, albums.id)").
+			Joins("JOIN tracks ON tracks.id=track_artists.track_id").
+			Joins("JOIN albums ON albums.id=tracks.tag_album_id").
+			Where("track_artists.artist_id=?", artist.ID).
+			Where(whereTrackNotMissing).
+			SubQuery()).
+		Where("albums.id NOT IN ?", c.DB.
+			Table("album_artists").
+			Select("album_artists.album_id").
+			Where("album_artists.artist_id=?", artist.ID).
+			SubQuery()).
+		Preload("Artists").
+		Preload("Genres").
+		Order("albums.right_path").
+		Group("albums.id").
+		Find(&appearsOn).
+		Error
+	if err != nil {
+		return spec.NewError(0, "find albums appeared on: %v", err)
+	}
+
 	sub := spec.NewResponse()
 	sub.Artist = spec.NewArtistByTags(artist)
-	sub.Artist.Albums = make([]*spec.Album, len(artist.Albums))
-	for i, album := range artist.Albums {
-		sub.Artist.Albums[i] = spec.NewAlbumByTags(album, album.Artists)
+	sub.Artist.Albums = make([]*spec.Album, 0, len(artist.Albums)+len(appearsOn))
+	for _, album := range append(artist.Albums, appearsOn...) {
+		sub.Artist.Albums = append(sub.Artist.Albums, spec.NewAlbumByTags(album, album.Artists))
 	}
-	sub.Artist.AlbumCount = len(artist.Albums)
+	sub.Artist.AlbumCount = len(sub.Artist.Albums)
 	return sub
 }
 
@@ -98,15 +146,11 @@ func (c *Controller) ServeGetAlbum(r *http.Request) *spec.Response {
 	album := &db.Album{}
 	err = c.DB.
 		Select("albums.*, count(tracks.id) child_count, sum(tracks.length) duration").
-		Joins("LEFT JOIN tracks ON tracks.album_id=albums.id").
+		Joins(joinAlbumTracks).
+		Where(whereAlbumNotMissing).
+		Group("albums.id").
 		Preload("Artists").
 		Preload("Genres").
-		Preload("Tracks", func(db *gorm.DB) *gorm.DB {
-			return db.
-				Order("tracks.tag_disc_number, tracks.tag_track_number").
-				Preload("TrackStar", "user_id=?", user.ID).
-				Preload("TrackRating", "user_id=?", user.ID)
-		}).
 		Preload("AlbumStar", "user_id=?", user.ID).
 		Preload("AlbumRating", "user_id=?", user.ID).
 		First(album, id.Value).
@@ -114,6 +158,22 @@ func (c *Controller) ServeGetAlbum(r *http.Request) *spec.Response {
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return spec.NewError(10, "couldn't find an album with that id")
 	}
+	// the tracks of any discs merged into the album too
+	err = c.DB.
+		Joins("JOIN albums ON albums.id=tracks.tag_album_id").
+		Where("albums.id=? OR albums.merged_into_id=?", album.ID, album.ID).
+		Where(whereTrackNotMissing).
+		Order("tracks.tag_disc_number, tracks.tag_track_number").
+		Preload("Album").
+		Preload("Artists").
+		Preload("TrackStar", "user_id=?", user.ID).
+		Preload("TrackRating", "user_id=?", user.ID).
+		Preload("TrackPlay", "user_id=?", user.ID).
+		Find(&album.Tracks).
+		Error
+	if err != nil {
+		return spec.NewError(0, "find tracks: %v", err)
+	}
 	sub := spec.NewResponse()
 	sub.Album = spec.NewAlbumByTags(album, album.Artists)
 	sub.Album.Tracks = make([]*spec.TrackChild, len(album.Tracks))
@@ -122,8 +182,7 @@ func (c *Controller) ServeGetAlbum(r *http.Request) *spec.Response {
 
 	for i, track := range album.Tracks {
 		sub.Album.Tracks[i] = spec.NewTrackByTags(track, album)
-		sub.Album.Tracks[i].TranscodedContentType = transcodeMIME
-		sub.Album.Tracks[i].TranscodedSuffix = transcodeSuffix
+		sub.Album.Tracks[i].SetTranscoded(transcodeMIME, transcodeSuffix)
 	}
 	return sub
 }
@@ -142,9 +201,9 @@ func (c *Controller) ServeGetAlbumListTwo(r *http.Request) *spec.Response {
 	switch listType {
 	case "alphabeticalByArtist":
 		q = q.Joins("JOIN artists ON artists.id=album_artists.artist_id")
-		q = q.Order("artists.name")
+		q = q.Order(fmt.Sprintf("min(%s)", c.sortExpr("artists.name_sort", "artists.name")))
 	case "alphabeticalByName":
-		q = q.Order("tag_title")
+		q = q.Order(c.sortExpr("albums.tag_title_sort", "albums.tag_title"))
 	case "byYear":
 		y1, y2 :=
 			params.GetOrInt("fromYear", 1800),
@@ -158,16 +217,15 @@ func (c *Controller) ServeGetAlbumListTwo(r *http.Request) *spec.Response {
 		q = q.Joins("JOIN genres ON genres.id=album_genres.genre_id AND genres.name=?", genre)
 		q = q.Order("tag_title")
 	case "frequent":
-		user := r.Context().Value(CtxUser).(*db.User)
-		q = q.Joins("JOIN plays ON albums.id=plays.album_id AND plays.user_id=?", user.ID)
-		q = q.Order("plays.length DESC")
+		q = q.Joins(joinAlbumListens, user.ID)
+		q = q.Order("max(listens.length) DESC")
 	case "newest":
 		q = q.Order("created_at DESC")
 	case "random":
 		q = q.Order(gorm.Expr("random()"))
 	case "recent":
-		q = q.Joins("JOIN plays ON albums.id=plays.album_id AND plays.user_id=?", user.ID)
-		q = q.Order("plays.time DESC")
+		q = q.Joins(joinAlbumListens, user.ID)
+		q = q.Order("max(listens.time) DESC")
 	case "starred":
 		q = q.Joins("JOIN album_stars ON albums.id=album_stars.album_id AND album_stars.user_id=?", user.ID)
 		q = q.Order("tag_title")
@@ -182,7 +240,9 @@ func (c *Controller) ServeGetAlbumListTwo(r *http.Request) *spec.Response {
 	// of children. it might make sense to store that in the db
 	q.
 		Select("albums.*, count(tracks.id) child_count, sum(tracks.length) duration").
-		Joins("LEFT JOIN tracks ON tracks.album_id=albums.id").
+		Joins(joinAlbumTracks).
+		Where(whereNotMergedDisc).
+		Where(whereAlbumNotMissing).
 		Group("albums.id").
 		Joins("JOIN album_artists ON album_artists.album_id=albums.id").
 		Offset(params.GetOrInt("offset", 0)).
@@ -205,29 +265,23 @@ func (c *Controller) ServeSearchThree(r *http.Request) *spec.Response {
 	params := r.Context().Value(CtxParams).(params.Params)
 	user := r.Context().Value(CtxUser).(*db.User)
 	query, err := params.Get("query")
-	var queries []string
 	if err != nil {
 		return spec.NewError(10, "please provide a `query` parameter")
 	}
-	for _, s := range strings.Fields(query) {
-		queries = append(queries, fmt.Sprintf("%%%s%%", strings.Trim(s, `*"'`)))
-	}
 
 	results := &spec.SearchResultThree{}
 
 	// search artists
 	var artists []*db.Artist
 	q := c.DB.
-		Select("*, count(albums.id) album_count").
+		Select("artists.*, count(albums.id) album_count").
 		Group("artists.id")
-	for _, s := range queries {
-		q = q.Where(`name LIKE ? OR name_u_dec LIKE ?`, s, s)
-	}
-	q = q.
-		Joins("JOIN album_artists ON album_artists.artist_id=artists.id").
-		Joins("JOIN albums ON albums.id=album_artists.album_id").
+	q = c.whereSearch(q, "artists", query, "artists.name", "artists.name_u_dec").
+		Joins(joinArtistAlbums).
+		Joins("JOIN albums ON albums.id=artist_albums.album_id").
 		Preload("ArtistStar", "user_id=?", user.ID).
 		Preload("ArtistRating", "user_id=?", user.ID).
+		Order(c.sortExpr("artists.name_sort", "artists.name")).
 		Offset(params.GetOrInt("artistOffset", 0)).
 		Limit(params.GetOrInt("artistCount", 20))
 	if m := getMusicFolder(c.MusicPaths, params); m != "" {
@@ -243,14 +297,14 @@ func (c *Controller) ServeSearchThree(r *http.Request) *spec.Response {
 	// search albums
 	var albums []*db.Album
 	q = c.DB.
+		Where(whereNotMergedDisc).
+		Where(whereAlbumNotMissing).
 		Preload("Artists").
 		Preload("Genres").
 		Preload("AlbumStar", "user_id=?", user.ID).
 		Preload("AlbumRating", "user_id=?", user.ID)
-	for _, s := range queries {
-		q = q.Where(`tag_title LIKE ? OR tag_title_u_dec LIKE ?`, s, s)
-	}
-	q = q.
+	q = c.whereSearch(q, "albums", query, "albums.tag_title", "albums.tag_title_u_dec").
+		Order(c.sortExpr("albums.tag_title_sort", "albums.tag_title")).
 		Offset(params.GetOrInt("albumOffset", 0)).
 		Limit(params.GetOrInt("albumCount", 20))
 	if m := getMusicFolder(c.MusicPaths, params); m != "" {
@@ -267,14 +321,17 @@ func (c *Controller) ServeSearchThree(r *http.Request) *spec.Response {
 	var tracks []*db.Track
 	q = c.DB.
 		Preload("Album").
+		Preload("TagAlbum").
 		Preload("Album.Artists").
+		Preload("TagAlbum.Artists").
 		Preload("Genres").
 		Preload("TrackStar", "user_id=?", user.ID).
-		Preload("TrackRating", "user_id=?", user.ID)
-	for _, s := range queries {
-		q = q.Where(`tracks.tag_title LIKE ? OR tracks.tag_title_u_dec LIKE ?`, s, s)
-	}
-	q = q.Offset(params.GetOrInt("songOffset", 0)).
+		Preload("TrackRating", "user_id=?", user.ID).
+		Preload("TrackPlay", "user_id=?", user.ID)
+	q = c.whereSearch(q, "tracks", query, "tracks.tag_title", "tracks.tag_title_u_dec").
+		Where(whereTrackNotMissing).
+		Order(c.sortExpr("tracks.tag_title_sort", "tracks.tag_title")).
+		Offset(params.GetOrInt("songOffset", 0)).
 		Limit(params.GetOrInt("songCount", 20))
 	if m := getMusicFolder(c.MusicPaths, params); m != "" {
 		q = q.
@@ -288,9 +345,8 @@ func (c *Controller) ServeSearchThree(r *http.Request) *spec.Response {
 	transcodeMIME, transcodeSuffix := streamGetTransPrefProfile(c.DB, user.ID, params.GetOr("c", ""))
 
 	for _, t := range tracks {
-		track := spec.NewTrackByTags(t, t.Album)
-		track.TranscodedContentType = transcodeMIME
-		track.TranscodedSuffix = transcodeSuffix
+		track := spec.NewTrackByTags(t, t.AlbumByTags())
+		track.SetTranscoded(transcodeMIME, transcodeSuffix)
 		results.Tracks = append(results.Tracks, track)
 	}
 
@@ -316,19 +372,28 @@ func (c *Controller) ServeGetArtistInfoTwo(r *http.Request) *spec.Response {
 	}
 
 	sub := spec.NewResponse()
-	sub.ArtistInfoTwo = &spec.ArtistInfo{}
+	sub.ArtistInfoTwo = &spec.ArtistInfo{
+		MusicBrainzID: artist.BrainzID,
+	}
 
 	apiKey, _ := c.DB.GetSetting("lastfm_api_key")
 	if apiKey == "" {
 		return sub
 	}
-	info, err := c.LastFMClient.ArtistGetInfo(apiKey, artist.Name)
+	var info lastfm.Artist
+	if artist.BrainzID != "" {
+		info, err = c.LastFMClient.ArtistGetInfoByMBID(apiKey, artist.Name, artist.BrainzID)
+	} else {
+		info, err = c.LastFMClient.ArtistGetInfo(apiKey, artist.Name)
+	}
 	if err != nil {
 		return spec.NewError(0, "fetching artist info: %v", err)
 	}
 
 	sub.ArtistInfoTwo.Biography = info.Bio.Summary
-	sub.ArtistInfoTwo.MusicBrainzID = info.MBID
+	if sub.ArtistInfoTwo.MusicBrainzID == "" {
+		sub.ArtistInfoTwo.MusicBrainzID = info.MBID
+	}
 	sub.ArtistInfoTwo.LastFMURL = info.URL
 
 	sub.ArtistInfoTwo.SmallImageURL = c.genArtistCoverURL(r, &artist, 64)
@@ -383,8 +448,8 @@ func (c *Controller) ServeGetGenres(_ *http.Request) *spec.Response {
 	var genres []*db.Genre
 	c.DB.
 		Select(`*,
-			(SELECT count(1) FROM album_genres WHERE genre_id=genres.id) album_count,
-			(SELECT count(1) FROM track_genres WHERE genre_id=genres.id) track_count`).
+			(SELECT count(1) FROM album_genres JOIN albums ON albums.id=album_genres.album_id WHERE genre_id=genres.id AND albums.merged_into_id IS NULL AND albums.missing_since IS NULL) album_count,
+			(SELECT count(1) FROM track_genres JOIN tracks ON tracks.id=track_genres.track_id WHERE genre_id=genres.id AND tracks.missing_since IS NULL) track_count`).
 		Group("genres.id").
 		Find(&genres)
 	sub := spec.NewResponse()
@@ -409,10 +474,14 @@ func (c *Controller) ServeGetSongsByGenre(r *http.Request) *spec.Response {
 		Joins("JOIN albums ON tracks.album_id=albums.id").
 		Joins("JOIN track_genres ON track_genres.track_id=tracks.id").
 		Joins("JOIN genres ON track_genres.genre_id=genres.id AND genres.name=?", genre).
+		Where(whereTrackNotMissing).
 		Preload("Album").
+		Preload("TagAlbum").
 		Preload("Album.Artists").
+		Preload("TagAlbum.Artists").
 		Preload("TrackStar", "user_id=?", user.ID).
 		Preload("TrackRating", "user_id=?", user.ID).
+		Preload("TrackPlay", "user_id=?", user.ID).
 		Offset(params.GetOrInt("offset", 0)).
 		Limit(params.GetOrInt("count", 10))
 	if m := getMusicFolder(c.MusicPaths, params); m != "" {
@@ -430,9 +499,8 @@ func (c *Controller) ServeGetSongsByGenre(r *http.Request) *spec.Response {
 	transcodeMIME, transcodeSuffix := streamGetTransPrefProfile(c.DB, user.ID, params.GetOr("c", ""))
 
 	for i, t := range tracks {
-		sub.TracksByGenre.List[i] = spec.NewTrackByTags(t, t.Album)
-		sub.TracksByGenre.List[i].TranscodedContentType = transcodeMIME
-		sub.TracksByGenre.List[i].TranscodedSuffix = transcodeSuffix
+		sub.TracksByGenre.List[i] = spec.NewTrackByTags(t, t.AlbumByTags())
+		sub.TracksByGenre.List[i].SetTranscoded(transcodeMIME, transcodeSuffix)
 	}
 
 	return sub
@@ -449,8 +517,8 @@ func (c *Controller) ServeGetStarredTwo(r *http.Request) *spec.Response {
 	q := c.DB.
 		Joins("JOIN artist_stars ON artist_stars.artist_id=artists.id").
 		Where("artist_stars.user_id=?", user.ID).
-		Joins("JOIN album_artists ON album_artists.artist_id=artists.id").
-		Joins("JOIN albums ON albums.id=album_artists.album_id").
+		Joins(joinArtistAlbums).
+		Joins("JOIN albums ON albums.id=artist_albums.album_id").
 		Preload("ArtistStar", "user_id=?", user.ID).
 		Preload("ArtistRating", "user_id=?", user.ID).
 		Group("artists.id")
@@ -469,6 +537,8 @@ func (c *Controller) ServeGetStarredTwo(r *http.Request) *spec.Response {
 	q = c.DB.
 		Joins("JOIN album_stars ON album_stars.album_id=albums.id").
 		Where("album_stars.user_id=?", user.ID).
+		Where(whereNotMergedDisc).
+		Where(whereAlbumNotMissing).
 		Preload("Artists").
 		Preload("AlbumStar", "user_id=?", user.ID).
 		Preload("AlbumRating", "user_id=?", user.ID)
@@ -487,9 +557,12 @@ func (c *Controller) ServeGetStarredTwo(r *http.Request) *spec.Response {
 	q = c.DB.
 		Joins("JOIN track_stars ON tracks.id=track_stars.track_id").
 		Where("track_stars.user_id=?", user.ID).
+		Where(whereTrackNotMissing).
 		Preload("Album").
+		Preload("TagAlbum").
 		Preload("TrackStar", "user_id=?", user.ID).
-		Preload("TrackRating", "user_id=?", user.ID)
+		Preload("TrackRating", "user_id=?", user.ID).
+		Preload("TrackPlay", "user_id=?", user.ID)
 	if m := getMusicFolder(c.MusicPaths, params); m != "" {
 		q = q.
 			Joins("JOIN albums ON albums.id=tracks.album_id").
@@ -502,9 +575,8 @@ func (c *Controller) ServeGetStarredTwo(r *http.Request) *spec.Response {
 	transcodeMIME, transcodeSuffix := streamGetTransPrefProfile(c.DB, user.ID, params.GetOr("c", ""))
 
 	for _, t := range tracks {
-		track := spec.NewTrackByTags(t, t.Album)
-		track.TranscodedContentType = transcodeMIME
-		track.TranscodedSuffix = transcodeSuffix
+		track := spec.NewTrackByTags(t, t.AlbumByTags())
+		track.SetTranscoded(transcodeMIME, transcodeSuffix)
 		results.Tracks = append(results.Tracks, track)
 	}
 
@@ -564,12 +636,15 @@ func (c *Controller) ServeGetTopSongs(r *http.Request) *spec.Response {
 	var tracks []*db.Track
 	err = c.DB.
 		Preload("Album").
+		Preload("TagAlbum").
 		Joins("JOIN albums ON albums.id=tracks.album_id").
 		Joins("JOIN album_artists ON album_artists.album_id=albums.id").
 		Where("album_artists.artist_id=? AND tracks.tag_title IN (?)", artist.ID, topTrackNames).
+		Where(whereTrackNotMissing).
 		Limit(count).
 		Preload("TrackStar", "user_id=?", user.ID).
 		Preload("TrackRating", "user_id=?", user.ID).
+		Preload("TrackPlay", "user_id=?", user.ID).
 		Group("tracks.id").
 		Find(&tracks).
 		Error
@@ -583,9 +658,8 @@ func (c *Controller) ServeGetTopSongs(r *http.Request) *spec.Response {
 	transcodeMIME, transcodeSuffix := streamGetTransPrefProfile(c.DB, user.ID, params.GetOr("c", ""))
 
 	for _, track := range tracks {
-		tc := spec.NewTrackByTags(track, track.Album)
-		tc.TranscodedContentType = transcodeMIME
-		tc.TranscodedSuffix = transcodeSuffix
+		tc := spec.NewTrackByTags(track, track.AlbumByTags())
+		tc.SetTranscoded(transcodeMIME, transcodeSuffix)
 		sub.TopSongs.Tracks = append(sub.TopSongs.Tracks, tc)
 	}
 	return sub
@@ -631,9 +705,12 @@ func (c *Controller) ServeGetSimilarSongs(r *http.Request) *spec.Response {
 	err = c.DB.
 		Select("tracks.*").
 		Preload("Album").
+		Preload("TagAlbum").
 		Preload("TrackStar", "user_id=?", user.ID).
 		Preload("TrackRating", "user_id=?", user.ID).
+		Preload("TrackPlay", "user_id=?", user.ID).
 		Where("tracks.tag_title IN (?)", similarTrackNames).
+		Where(whereTrackNotMissing).
 		Order(gorm.Expr("random()")).
 		Limit(count).
 		Find(&tracks).
@@ -653,9 +730,8 @@ func (c *Controller) ServeGetSimilarSongs(r *http.Request) *spec.Response {
 	transcodeMIME, transcodeSuffix := streamGetTransPrefProfile(c.DB, user.ID, params.GetOr("c", ""))
 
 	for i, track := range tracks {
-		sub.SimilarSongs.Tracks[i] = spec.NewTrackByTags(track, track.Album)
-		sub.SimilarSongs.Tracks[i].TranscodedContentType = transcodeMIME
-		sub.SimilarSongs.Tracks[i].TranscodedSuffix = transcodeSuffix
+		sub.SimilarSongs.Tracks[i] = spec.NewTrackByTags(track, track.AlbumByTags())
+		sub.SimilarSongs.Tracks[i].SetTranscoded(transcodeMIME, transcodeSuffix)
 	}
 	return sub
 }
@@ -699,11 +775,14 @@ func (c *Controller) ServeGetSimilarSongsTwo(r *http.Request) *spec.Response {
 	var tracks []*db.Track
 	err = c.DB.
 		Preload("Album").
+		Preload("TagAlbum").
 		Preload("TrackStar", "user_id=?", user.ID).
 		Preload("TrackRating", "user_id=?", user.ID).
+		Preload("TrackPlay", "user_id=?", user.ID).
 		Joins("JOIN album_artists ON album_artists.album_id=tracks.album_id").
 		Joins("JOIN artists ON artists.id=album_artists.artist_id").
 		Where("artists.name IN (?)", artistNames).
+		Where(whereTrackNotMissing).
 		Order(gorm.Expr("random()")).
 		Group("tracks.id").
 		Limit(count).
@@ -724,9 +803,8 @@ func (c *Controller) ServeGetSimilarSongsTwo(r *http.Request) *spec.Response {
 	transcodeMIME, transcodeSuffix := streamGetTransPrefProfile(c.DB, user.ID, params.GetOr("c", ""))
 
 	for i, track := range tracks {
-		sub.SimilarSongsTwo.Tracks[i] = spec.NewTrackByTags(track, track.Album)
-		sub.SimilarSongsTwo.Tracks[i].TranscodedContentType = transcodeMIME
-		sub.SimilarSongsTwo.Tracks[i].TranscodedSuffix = transcodeSuffix
+		sub.SimilarSongsTwo.Tracks[i] = spec.NewTrackByTags(track, track.AlbumByTags())
+		sub.SimilarSongsTwo.Tracks[i].SetTranscoded(transcodeMIME, transcodeSuffix)
 	}
 	return sub
 }
@@ -1,8 +1,15 @@
 package ctrlsubsonic
 
 import (
+	"context"
 	"net/url"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/server/ctrlsubsonic/spec"
 )
 
 func TestGetArtists(t *testing.T) {
@@ -16,6 +23,19 @@ func TestGetArtists(t *testing.T) {
 	})
 }
 
+func TestGetArtistsSortNames(t *testing.T) {
+	t.Parallel()
+	contr := makeController(t)
+	contr.IgnoredArticles = []string{"The", "A"}
+
+	require.NoError(t, contr.DB.Model(db.Artist{}).Where("name=?", "artist-0").Updates(db.Artist{Name: "The Zombies"}).Error)
+	require.NoError(t, contr.DB.Model(db.Artist{}).Where("name=?", "artist-2").Updates(db.Artist{NameSort: "Aardvarks, The"}).Error)
+
+	runQueryCases(t, contr, contr.ServeGetArtists, []*queryCase{
+		{url.Values{}, "sort_tags_and_ignored_articles", false},
+	})
+}
+
 func TestGetArtist(t *testing.T) {
 	t.Parallel()
 	contr := makeController(t)
@@ -37,6 +57,29 @@ func TestGetAlbum(t *testing.T) {
 	})
 }
 
+func TestGetAlbumExtendedTags(t *testing.T) {
+	t.Parallel()
+	contr := makeController(t)
+
+	require.NoError(t, contr.DB.Model(db.Album{}).Where("id=?", 3).Updates(db.Album{
+		TagLabel:         "label",
+		TagCatalogNumber: "CAT-001",
+		TagCompilation:   true,
+		TagReleaseTypes:  "album;live",
+		TagOriginalDate:  "1997-05",
+	}).Error)
+	require.NoError(t, contr.DB.Model(db.Track{}).Where("album_id=? AND tag_title=?", 3, "title-0").Updates(db.Track{
+		TagComposer:     "composer",
+		TagBPM:          128,
+		TagComment:      "comment",
+		TagDiscSubtitle: "disc subtitle",
+	}).Error)
+
+	runQueryCases(t, contr, contr.ServeGetAlbum, []*queryCase{
+		{url.Values{"id": {"al-3"}}, "with_extended_tags", false},
+	})
+}
+
 func TestGetAlbumListTwo(t *testing.T) {
 	t.Parallel()
 	contr := makeController(t)
@@ -53,9 +96,65 @@ func TestSearchThree(t *testing.T) {
 	t.Parallel()
 	contr := makeController(t)
 
-	runQueryCases(t, contr, contr.ServeSearchThree, []*queryCase{
+	cases := []*queryCase{
 		{url.Values{"query": {"art"}}, "q_art", false},
 		{url.Values{"query": {"alb"}}, "q_alb", false},
 		{url.Values{"query": {"tit"}}, "q_tra", false},
-	})
+	}
+	// the search index matches every field, and ranks by relevance, so its results have goldens of their own
+	if contr.DB.HasSearchIndex() {
+		t.Run("index", func(t *testing.T) { runQueryCases(t, contr, contr.ServeSearchThree, cases) })
+		return
+	}
+	runQueryCases(t, contr, contr.ServeSearchThree, cases)
+}
+
+func TestMissingHidden(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	contr := makeController(t)
+
+	var user db.User
+	require.NoError(contr.DB.Where("name=?", mockUsername).First(&user).Error)
+	var album db.Album
+	require.NoError(contr.DB.Preload("Artists").Where("left_path=? AND right_path=?", "artist-0/", "album-0").First(&album).Error)
+	var track db.Track
+	require.NoError(contr.DB.Where("album_id=?", album.ID).First(&track).Error)
+	require.NoError(contr.DB.Create(&db.TrackLyrics{TrackID: track.ID, Text: "lyrics"}).Error)
+
+	serve := func(h handlerSubsonic, params url.Values) *spec.Response {
+		_, req := makeHTTPMock(params)
+		req = req.WithContext(context.WithValue(req.Context(), CtxUser, &user))
+		return h(req)
+	}
+	visible := func() (albums, songs, artistAlbums int) {
+		albumList := serve(contr.ServeGetAlbumListTwo, url.Values{"type": {"alphabeticalByName"}, "size": {"100"}})
+		require.Nil(albumList.Error)
+		randomSongs := serve(contr.ServeGetRandomSongs, url.Values{"size": {"100"}})
+		require.Nil(randomSongs.Error)
+		artist := serve(contr.ServeGetArtist, url.Values{"id": {album.Artists[0].SID().String()}})
+		require.Nil(artist.Error)
+		return len(albumList.AlbumsTwo.List), len(randomSongs.RandomTracks.List), artist.Artist.AlbumCount
+	}
+
+	albums, songs, artistAlbums := visible()
+	require.Equal(9, albums)
+	require.Equal(27, songs)
+	require.Equal(3, artistAlbums)
+	require.Equal("lyrics", serve(contr.ServeGetLyrics, url.Values{"title": {track.TagTitle}}).Lyrics.Value)
+
+	now := time.Now()
+	require.NoError(contr.DB.Model(&db.Album{}).Where("id=?", album.ID).UpdateColumn("missing_since", now).Error)
+	require.NoError(contr.DB.Model(&db.Track{}).Where("album_id=?", album.ID).UpdateColumn("missing_since", now).Error)
+
+	albums, songs, artistAlbums = visible()
+	require.Equal(8, albums)
+	require.Equal(24, songs)
+	require.Equal(2, artistAlbums)
+
+	require.NotNil(serve(contr.ServeGetAlbum, url.Values{"id": {album.SID().String()}}).Error)
+	require.NotNil(serve(contr.ServeGetSong, url.Values{"id": {track.SID().String()}}).Error)
+	require.NotNil(serve(contr.ServeGetMusicDirectory, url.Values{"id": {album.SID().String()}}).Error)
+	require.NotNil(serve(contr.ServeGetLyricsBySongID, url.Values{"id": {track.SID().String()}}).Error)
+	require.Empty(serve(contr.ServeGetLyrics, url.Values{"title": {track.TagTitle}}).Lyrics.Value)
 }
@@ -7,12 +7,15 @@ import (
 	"math"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/jinzhu/gorm"
 
 	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/lyrics"
 	"go.senan.xyz/gonic/multierr"
 	"go.senan.xyz/gonic/scanner"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/params"
@@ -21,6 +24,19 @@ import (
 	"go.senan.xyz/gonic/server/ctrlsubsonic/specidpaths"
 )
 
+// joinAlbumListens joins albums to the total length of a user's listens of them, and the time of their last,
+// for the frequent and recent album lists
+const joinAlbumListens = `JOIN (
+	SELECT album_id, sum(length) length, max(time) time FROM listens WHERE user_id=? GROUP BY album_id
+) listens ON listens.album_id=albums.id`
+
+// whereAlbumNotMissing and whereTrackNotMissing leave out what the last scan couldn't find. it's kept for
+// a while by the scanner, in case it comes back
+const (
+	whereAlbumNotMissing = "albums.missing_since IS NULL"
+	whereTrackNotMissing = "tracks.missing_since IS NULL"
+)
+
 func lowerUDecOrHash(in string) string {
 	lower := unicode.ToLower(rune(in[0]))
 	if !unicode.IsLetter(lower) {
@@ -29,6 +45,67 @@ func lowerUDecOrHash(in string) string {
 	return string(lower)
 }
 
+// sortName is the name to sort and index by. that's the sort tag if there is one, otherwise the name
+// without any leading ignored article, so "The Beatles" is indexed under "B"
+func (c *Controller) sortName(sortTag, name string) string {
+	if sortTag != "" {
+		return sortTag
+	}
+	for _, article := range c.IgnoredArticles {
+		prefix := article + " "
+		if len(name) > len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+			return name[len(prefix):]
+		}
+	}
+	return name
+}
+
+// likeEscaper escapes a string to match itself in a LIKE pattern with ESCAPE '\', quoted as an sql string
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `'`, `''`)
+
+// sortExpr is sortName as a case insensitive ORDER BY expression, with sortCol being the sort tag's
+// column, if any
+func (c *Controller) sortExpr(sortCol, nameCol string) string {
+	var expr strings.Builder
+	if len(c.IgnoredArticles) > 0 {
+		expr.WriteString("CASE")
+		for _, article := range c.IgnoredArticles {
+			pattern := likeEscaper.Replace(article)
+			fmt.Fprintf(&expr, ` WHEN %s %s '%s %%' ESCAPE '\' THEN substr(%s, %d)`, nameCol, c.DB.ILike(), pattern, nameCol, utf8.RuneCountInString(article)+2)
+		}
+		fmt.Fprintf(&expr, " ELSE %s END", nameCol)
+	} else {
+		expr.WriteString(nameCol)
+	}
+	if sortCol != "" {
+		return c.DB.NoCase(fmt.Sprintf("COALESCE(NULLIF(%s, ''), %s)", sortCol, expr.String()))
+	}
+	return c.DB.NoCase(expr.String())
+}
+
+// whereSearch restricts q to the rows of table matching a search query. with the search index, the query's
+// words can start words in any of the indexed columns, and the rows are ordered by how well they match.
+// otherwise each word must be in one of likeCols
+func (c *Controller) whereSearch(q *gorm.DB, table string, query string, likeCols ...string) *gorm.DB {
+	if match := db.SearchMatch(query); match != "" && c.DB.HasSearchIndex() {
+		fts := db.SearchTable(table)
+		return q.
+			Joins(fmt.Sprintf("JOIN (SELECT rowid, rank FROM %[1]s WHERE %[1]s MATCH ?) search ON search.rowid=%[2]s.id", fts, table), match).
+			Order("search.rank")
+	}
+	for _, word := range strings.Fields(query) {
+		word = fmt.Sprintf("%%%s%%", strings.Trim(word, `*"'`))
+		var conds []string
+		var args []interface{}
+		for _, col := range likeCols {
+			conds = append(conds, fmt.Sprintf("%s %s ?", col, c.DB.ILike()))
+			args = append(args, word)
+		}
+		q = q.Where(strings.Join(conds, " OR "), args...)
+	}
+	return q
+}
+
 func getMusicFolder(musicPaths []MusicPath, p params.Params) string {
 	idx, err := p.GetInt("musicFolderId")
 	if err != nil {
@@ -62,15 +139,18 @@ func (c *Controller) ServeScrobble(r *http.Request) *spec.Response {
 	}
 
 	track := &db.Track{}
-	if err := c.DB.Preload("Album").Preload("Album.Artists").First(track, id.Value).Error; err != nil {
+	if err := c.DB.Preload("Album").Preload("Album.Artists").Preload("TagAlbum").First(track, id.Value).Error; err != nil {
 		return spec.NewError(0, "error finding track: %v", err)
 	}
 
 	optStamp := params.GetOrTime("time", time.Now())
 	optSubmission := params.GetOrBool("submission", true)
 
-	if err := streamUpdateStats(c.DB, user.ID, track, optStamp); err != nil {
-		return spec.NewError(0, "error updating stats: %v", err)
+	// now playing notifications aren't listens
+	if optSubmission {
+		if err := streamRecordListen(c.DB, user.ID, track, params.GetOr("c", ""), optStamp); err != nil {
+			return spec.NewError(0, "error recording listen: %v", err)
+		}
 	}
 
 	var scrobbleErrs multierr.Err
@@ -100,8 +180,32 @@ func (c *Controller) ServeGetMusicFolders(_ *http.Request) *spec.Response {
 }
 
 func (c *Controller) ServeStartScan(r *http.Request) *spec.Response {
+	params := r.Context().Value(CtxParams).(params.Params)
+
+	// optionally rescan just a path, or the folder of an album, instead of everything
+	var opts scanner.ScanOptions
+	if id, err := params.GetID("id"); err == nil {
+		if id.Type != specid.Album {
+			return spec.NewError(10, "please provide an album `id` parameter")
+		}
+		var album db.Album
+		if err := c.DB.Where("id=?", id.Value).First(&album).Error; err != nil {
+			return spec.NewError(70, "album with id `%s` not found", id)
+		}
+		opts.Paths = append(opts.Paths, album.AbsPath())
+	}
+	if path, err := params.Get("path"); err == nil {
+		if !filepath.IsAbs(path) {
+			return spec.NewError(10, "please provide an absolute `path` parameter")
+		}
+		if _, err := c.Scanner.MusicDir(path); err != nil {
+			return spec.NewError(70, "path not found: %v", err)
+		}
+		opts.Paths = append(opts.Paths, path)
+	}
+
 	go func() {
-		if _, err := c.Scanner.ScanAndClean(scanner.ScanOptions{}); err != nil {
+		if _, err := c.Scanner.ScanAndClean(opts); err != nil {
 			log.Printf("error while scanning: %v\n", err)
 		}
 	}()
@@ -109,8 +213,23 @@ func (c *Controller) ServeStartScan(r *http.Request) *spec.Response {
 }
 
 func (c *Controller) ServeGetScanStatus(_ *http.Request) *spec.Response {
+	if progress, ok := c.Scanner.Progress(); ok {
+		sub := spec.NewResponse()
+		sub.ScanStatus = &spec.ScanStatus{
+			Scanning:       true,
+			Count:          progress.TracksSeen,
+			CurrentFolder:  progress.CurrentDir,
+			FolderCount:    progress.DirsDone,
+			FolderTotal:    progress.DirsFound,
+			NewCount:       progress.TracksNew,
+			ErrorCount:     progress.Errors,
+			ElapsedSeconds: int(progress.Elapsed.Seconds()),
+		}
+		return sub
+	}
+
 	var trackCount int
-	if err := c.DB.Model(db.Track{}).Count(&trackCount).Error; err != nil {
+	if err := c.DB.Model(db.Track{}).Where(whereTrackNotMissing).Count(&trackCount).Error; err != nil {
 		return spec.NewError(0, "error finding track count: %v", err)
 	}
 
@@ -177,10 +296,10 @@ func (c *Controller) ServeGetPlayQueue(r *http.Request) *spec.Response {
 				Preload("Album").
 				Preload("TrackStar", "user_id=?", user.ID).
 				Preload("TrackRating", "user_id=?", user.ID).
+				Preload("TrackPlay", "user_id=?", user.ID).
 				Find(&track)
 			sub.PlayQueue.List[i] = spec.NewTCTrackByFolder(&track, track.Album)
-			sub.PlayQueue.List[i].TranscodedContentType = transcodeMIME
-			sub.PlayQueue.List[i].TranscodedSuffix = transcodeSuffix
+			sub.PlayQueue.List[i].SetTranscoded(transcodeMIME, transcodeSuffix)
 		case specid.PodcastEpisode:
 			pe := db.PodcastEpisode{}
 			c.DB.
@@ -191,8 +310,7 @@ func (c *Controller) ServeGetPlayQueue(r *http.Request) *spec.Response {
 				Where("id=?", pe.PodcastID).
 				Find(&p)
 			sub.PlayQueue.List[i] = spec.NewTCPodcastEpisode(&pe, &p)
-			sub.PlayQueue.List[i].TranscodedContentType = transcodeMIME
-			sub.PlayQueue.List[i].TranscodedSuffix = transcodeSuffix
+			sub.PlayQueue.List[i].SetTranscoded(transcodeMIME, transcodeSuffix)
 		}
 	}
 	return sub
@@ -235,17 +353,22 @@ func (c *Controller) ServeGetSong(r *http.Request) *spec.Response {
 	var track db.Track
 	err = c.DB.
 		Where("id=?", id.Value).
+		Where(whereTrackNotMissing).
 		Preload("Album").
 		Preload("Album.Artists").
+		Preload("TagAlbum").
+		Preload("TagAlbum.Artists").
+		Preload("Artists").
 		Preload("TrackStar", "user_id=?", user.ID).
 		Preload("TrackRating", "user_id=?", user.ID).
+		Preload("TrackPlay", "user_id=?", user.ID).
 		First(&track).
 		Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return spec.NewError(10, "couldn't find a track with that id")
 	}
 	sub := spec.NewResponse()
-	sub.Track = spec.NewTrackByTags(&track, track.Album)
+	sub.Track = spec.NewTrackByTags(&track, track.AlbumByTags())
 	return sub
 }
 
@@ -257,9 +380,13 @@ func (c *Controller) ServeGetRandomSongs(r *http.Request) *spec.Response {
 		Limit(params.GetOrInt("size", 10)).
 		Preload("Album").
 		Preload("Album.Artists").
+		Preload("TagAlbum").
+		Preload("TagAlbum.Artists").
 		Preload("TrackStar", "user_id=?", user.ID).
 		Preload("TrackRating", "user_id=?", user.ID).
+		Preload("TrackPlay", "user_id=?", user.ID).
 		Joins("JOIN albums ON tracks.album_id=albums.id").
+		Where(whereTrackNotMissing).
 		Order(gorm.Expr("random()"))
 	if year, err := params.GetInt("fromYear"); err == nil {
 		q = q.Where("albums.tag_year >= ?", year)
@@ -284,9 +411,8 @@ func (c *Controller) ServeGetRandomSongs(r *http.Request) *spec.Response {
 	transcodeMIME, transcodeSuffix := streamGetTransPrefProfile(c.DB, user.ID, params.GetOr("c", ""))
 
 	for i, track := range tracks {
-		sub.RandomTracks.List[i] = spec.NewTrackByTags(track, track.Album)
-		sub.RandomTracks.List[i].TranscodedContentType = transcodeMIME
-		sub.RandomTracks.List[i].TranscodedSuffix = transcodeSuffix
+		sub.RandomTracks.List[i] = spec.NewTrackByTags(track, track.AlbumByTags())
+		sub.RandomTracks.List[i].SetTranscoded(transcodeMIME, transcodeSuffix)
 	}
 	return sub
 }
@@ -333,7 +459,7 @@ func (c *Controller) ServeJukebox(r *http.Request) *spec.Response { // nolint:go
 			if !ok {
 				return nil, fmt.Errorf("%q: %w", path, errNotATrack)
 			}
-			ret = append(ret, spec.NewTrackByTags(track, track.Album))
+			ret = append(ret, spec.NewTrackByTags(track, track.AlbumByTags()))
 		}
 		return ret, nil
 	}
@@ -420,8 +546,109 @@ func (c *Controller) ServeJukebox(r *http.Request) *spec.Response { // nolint:go
 	return sub
 }
 
-func (c *Controller) ServeGetLyrics(_ *http.Request) *spec.Response {
+func (c *Controller) ServeGetLyrics(r *http.Request) *spec.Response {
+	params := r.Context().Value(CtxParams).(params.Params)
 	sub := spec.NewResponse()
 	sub.Lyrics = &spec.Lyrics{}
+	title, err := params.Get("title")
+	if err != nil {
+		return sub
+	}
+	q := c.DB.
+		Joins("JOIN tracks ON tracks.id=track_lyrics.track_id").
+		Preload("Track").
+		Where(whereTrackNotMissing).
+		Where(fmt.Sprintf("%s=%s", c.DB.NoCase("tracks.tag_title"), c.DB.NoCase("?")), title).
+		Order("track_lyrics.id")
+	if artist, err := params.Get("artist"); err == nil {
+		q = q.Where(fmt.Sprintf("%s=%s", c.DB.NoCase("tracks.tag_track_artist"), c.DB.NoCase("?")), artist)
+	}
+	var trackLyrics []*db.TrackLyrics
+	if err := q.Find(&trackLyrics).Error; err != nil {
+		return spec.NewError(0, "error finding lyrics: %v", err)
+	}
+	for _, tl := range trackLyrics {
+		text := lyrics.Parse(tl.Text).String()
+		if text == "" {
+			continue
+		}
+		sub.Lyrics = &spec.Lyrics{
+			Value:  text,
+			Artist: tl.Track.TagTrackArtist,
+			Title:  tl.Track.TagTitle,
+		}
+		break
+	}
+	return sub
+}
+
+func (c *Controller) ServeGetLyricsBySongID(r *http.Request) *spec.Response {
+	params := r.Context().Value(CtxParams).(params.Params)
+	id, err := params.GetID("id")
+	if err != nil || id.Type != specid.Track {
+		return spec.NewError(10, "please provide a track `id`")
+	}
+	var track db.Track
+	err = c.DB.
+		Where("id=?", id.Value).
+		Where(whereTrackNotMissing).
+		First(&track).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return spec.NewError(70, "couldn't find a track with that id")
+	}
+	if err != nil {
+		return spec.NewError(0, "error finding track: %v", err)
+	}
+	var trackLyrics []*db.TrackLyrics
+	err = c.DB.
+		Where("track_id=?", track.ID).
+		Order("id").
+		Find(&trackLyrics).
+		Error
+	if err != nil {
+		return spec.NewError(0, "error finding lyrics: %v", err)
+	}
+	sub := spec.NewResponse()
+	sub.LyricsList = &spec.LyricsList{
+		StructuredLyrics: []*spec.StructuredLyrics{},
+	}
+	for _, tl := range trackLyrics {
+		parsed := lyrics.Parse(tl.Text)
+		if len(parsed.Lines) == 0 {
+			continue
+		}
+		sub.LyricsList.StructuredLyrics = append(sub.LyricsList.StructuredLyrics, spec.NewStructuredLyrics(&track, parsed))
+	}
+	return sub
+}
+
+// ServeGetListeningStats is gonic's own. it summarises the user's listens over the last week, month, or year,
+// all time, or a calendar year
+func (c *Controller) ServeGetListeningStats(r *http.Request) *spec.Response {
+	params := r.Context().Value(CtxParams).(params.Params)
+	user := r.Context().Value(CtxUser).(*db.User)
+
+	rangeName := params.GetOr("range", "month")
+	now := time.Now()
+	from, to, err := db.ListenRange(rangeName, now)
+	if err != nil {
+		return spec.NewError(10, "please provide a `range` parameter of week, month, year, all, or a year like 2023")
+	}
+	stats, err := c.DB.ListenStats(user.ID, from, to, now.Location(), params.GetOrInt("count", 10))
+	if err != nil {
+		return spec.NewError(0, "error finding listening stats: %v", err)
+	}
+
+	sub := spec.NewResponse()
+	sub.ListeningStats = spec.NewListeningStats(rangeName, stats)
+	return sub
+}
+
+func (c *Controller) ServeGetOpenSubsonicExtensions(_ *http.Request) *spec.Response {
+	sub := spec.NewResponse()
+	sub.OpenSubsonicExtensions = []*spec.OpenSubsonicExtension{
+		{Name: "songLyrics", Versions: []int{1}},
+	}
 	return sub
 }
@@ -0,0 +1,185 @@
+package ctrlsubsonic
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/server/ctrlsubsonic/spec"
+)
+
+func TestGetLyrics(t *testing.T) {
+	t.Parallel()
+	contr := makeController(t)
+	addLyrics(t, contr)
+
+	runQueryCases(t, contr, contr.ServeGetLyrics, []*queryCase{
+		{url.Values{"artist": {"artist-1"}, "title": {"title-1"}}, "artist_and_title", false},
+		{url.Values{"title": {"TITLE-1"}}, "title_only", false},
+		{url.Values{"artist": {"artist-2"}, "title": {"title-1"}}, "not_found", false},
+	})
+}
+
+func TestGetLyricsBySongID(t *testing.T) {
+	t.Parallel()
+	contr := makeController(t)
+	trackID := addLyrics(t, contr)
+
+	runQueryCases(t, contr, contr.ServeGetLyricsBySongID, []*queryCase{
+		{url.Values{"id": {trackID}}, "synced_and_unsynced", false},
+		{url.Values{"id": {"tr-1"}}, "none", false},
+	})
+}
+
+func addLyrics(t *testing.T, contr *Controller) string {
+	t.Helper()
+
+	var track db.Track
+	require.NoError(t, contr.DB.
+		Joins("JOIN albums ON albums.id=tracks.album_id").
+		Where("albums.left_path=? AND albums.right_path=? AND tracks.filename=?", "artist-1/", "album-0", "track-1.flac").
+		First(&track).
+		Error)
+	require.NoError(t, contr.DB.Create(&db.TrackLyrics{
+		TrackID: track.ID,
+		Source:  "track-1.lrc",
+		Text:    "[la:eng]\n[offset:-250]\n[00:01.50]first line\n[00:04.00]second line\n",
+	}).Error)
+	require.NoError(t, contr.DB.Create(&db.TrackLyrics{
+		TrackID: track.ID,
+		Text:    "first line\nsecond line\n",
+	}).Error)
+	return track.SID().String()
+}
+
+func TestScrobbleListens(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	contr := makeController(t)
+
+	var user db.User
+	require.NoError(contr.DB.Where("name=?", mockUsername).First(&user).Error)
+	var track db.Track
+	require.NoError(contr.DB.Preload("Album").Where("filename=?", "track-1.flac").First(&track).Error)
+
+	serve := func(h handlerSubsonic, params url.Values) *spec.Response {
+		_, req := makeHTTPMock(params)
+		req = req.WithContext(context.WithValue(req.Context(), CtxUser, &user))
+		resp := h(req)
+		require.Nil(resp.Error)
+		return resp
+	}
+
+	// a now playing notification isn't a listen
+	serve(contr.ServeScrobble, url.Values{"id": {track.SID().String()}, "submission": {"true"}})
+	serve(contr.ServeScrobble, url.Values{"id": {track.SID().String()}, "submission": {"false"}})
+	serve(contr.ServeScrobble, url.Values{"id": {track.SID().String()}, "submission": {"true"}})
+
+	var listens []*db.Listen
+	require.NoError(contr.DB.Where("user_id=?", user.ID).Find(&listens).Error)
+	require.Len(listens, 2)
+	require.Equal(track.ID, listens[0].TrackID)
+	require.Equal(track.AlbumID, listens[0].AlbumID)
+	require.Equal(mockClientName, listens[0].Client)
+
+	song := serve(contr.ServeGetSong, url.Values{"id": {track.SID().String()}}).Track
+	require.Equal(2, song.PlayCount)
+	require.NotNil(song.Played)
+
+	for _, listType := range []string{"frequent", "recent"} {
+		albums := serve(contr.ServeGetAlbumListTwo, url.Values{"type": {listType}}).AlbumsTwo.List
+		require.Len(albums, 1)
+		require.Equal(track.AlbumID, albums[0].ID.Value)
+	}
+}
+
+func TestListeningStats(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	contr := makeController(t)
+
+	var user db.User
+	require.NoError(contr.DB.Where("name=?", mockUsername).First(&user).Error)
+	var tracks []*db.Track
+	require.NoError(contr.DB.Where("filename=?", "track-1.flac").Order("album_id").Limit(2).Find(&tracks).Error)
+	require.Len(tracks, 2)
+
+	now := time.Now()
+	for _, listen := range []struct {
+		track *db.Track
+		time  time.Time
+	}{
+		{tracks[0], now.Add(-1 * time.Hour)},
+		{tracks[0], now.Add(-2 * time.Hour)},
+		{tracks[1], now.AddDate(0, 0, -20)},
+		{tracks[0], time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC)},
+	} {
+		require.NoError(contr.DB.Create(&db.Listen{
+			UserID:  user.ID,
+			TrackID: listen.track.ID,
+			AlbumID: listen.track.AlbumID,
+			Time:    listen.time,
+			Length:  100,
+		}).Error)
+	}
+
+	serve := func(params url.Values) *spec.Response {
+		_, req := makeHTTPMock(params)
+		req = req.WithContext(context.WithValue(req.Context(), CtxUser, &user))
+		return contr.ServeGetListeningStats(req)
+	}
+
+	week := serve(url.Values{"range": {"week"}}).ListeningStats
+	require.Equal(2, week.Listens)
+	require.Equal(200, week.ListeningTime)
+	require.Len(week.Songs, 1)
+	require.Equal(tracks[0].ID, week.Songs[0].ID.Value)
+	require.Equal(2, week.Songs[0].Listens)
+
+	month := serve(url.Values{}).ListeningStats
+	require.Equal("month", month.Range)
+	require.Equal(3, month.Listens)
+	require.Equal(2, month.SongCount)
+	require.Equal(2, month.AlbumCount)
+	require.Len(month.Songs, 2)
+	require.Equal(tracks[1].ID, month.Songs[1].ID.Value)
+
+	review := serve(url.Values{"range": {"2020"}}).ListeningStats
+	require.Equal(1, review.Listens)
+	require.Len(review.Days, 1)
+	require.Equal("2020-06-01", review.Days[0].Date)
+	require.Equal("2020-06-01", review.BusiestDay.Date)
+	require.Len(review.Months, 1)
+	require.Equal("2020-06", review.Months[0].Date)
+
+	all := serve(url.Values{"range": {"all"}, "count": {"1"}}).ListeningStats
+	require.Equal(4, all.Listens)
+	require.Len(all.Albums, 1)
+	require.Equal(tracks[0].AlbumID, all.Albums[0].ID.Value)
+
+	require.Equal(10, serve(url.Values{"range": {"decade"}}).Error.Code)
+}
+
+func TestSortExprEscapesArticles(t *testing.T) {
+	t.Parallel()
+	contr := makeController(t)
+	contr.IgnoredArticles = []string{"_"} // not a wildcard
+
+	names := []string{"_ Xylophone", "A Zebra", "B Yak"}
+	for _, name := range names {
+		require.NoError(t, contr.DB.Create(&db.Artist{Name: name}).Error)
+	}
+
+	var artists []*db.Artist
+	require.NoError(t, contr.DB.
+		Where("name IN (?)", names).
+		Order(contr.sortExpr("", "artists.name")).
+		Find(&artists).
+		Error)
+	require.Len(t, artists, 3)
+	require.Equal(t, []string{"A Zebra", "B Yak", "_ Xylophone"}, []string{artists[0].Name, artists[1].Name, artists[2].Name})
+}
@@ -4,16 +4,21 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"image"
 	"log"
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/disintegration/imaging"
 	"github.com/jinzhu/gorm"
 
 	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/mime"
+	"go.senan.xyz/gonic/scanner/tags"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/params"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/spec"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/specid"
@@ -31,7 +36,7 @@ func streamGetTransPref(dbc *db.DB, userID int, client string) (*db.TranscodePre
 	var pref db.TranscodePreference
 	err := dbc.
 		Where("user_id=?", userID).
-		Where("client COLLATE NOCASE IN (?)", []string{"*", client}).
+		Where(dbc.NoCase("client")+" IN (?)", []string{"*", strings.ToLower(client)}).
 		Order("client DESC"). // ensure "*" is last if it's there
 		First(&pref).
 		Error
@@ -58,28 +63,47 @@ func streamGetTransPrefProfile(dbc *db.DB, userID int, client string) (mime stri
 
 var errUnknownMediaType = fmt.Errorf("media type is unknown")
 
-func streamUpdateStats(dbc *db.DB, userID int, track *db.Track, playTime time.Time) error {
-	var play db.Play
-	err := dbc.
-		Where("album_id=? AND user_id=?", track.AlbumID, userID).
-		First(&play).
-		Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return fmt.Errorf("find stat: %w", err)
-	}
-
-	play.AlbumID = track.AlbumID
-	play.UserID = userID
-	play.Count++ // for getAlbumList?type=frequent
-	play.Length += track.Length
-	if playTime.After(play.Time) {
-		play.Time = playTime // for getAlbumList?type=recent
-	}
+func streamRecordListen(dbc *db.DB, userID int, track *db.Track, client string, playTime time.Time) error {
+	// listens count for the album the track is in when browsing by tags, like the first disc of a
+	// multi-disc album
+	albumID := track.AlbumID
+	if album := track.AlbumByTags(); album != nil {
+		albumID = album.TagAlbumID()
+	}
+
+	return dbc.Transaction(func(tx *gorm.DB) error {
+		listen := db.Listen{
+			UserID:  userID,
+			TrackID: track.ID,
+			AlbumID: albumID,
+			Time:    playTime,
+			Client:  client,
+			Length:  track.Length, // clients don't say how much they played, only that it counts as a listen
+			Count:   1,
+		}
+		if err := tx.Save(&listen).Error; err != nil {
+			return fmt.Errorf("save listen: %w", err)
+		}
 
-	if err := dbc.Save(&play).Error; err != nil {
-		return fmt.Errorf("save stat: %w", err)
-	}
-	return nil
+		var play db.TrackPlay
+		err := tx.
+			Where("track_id=? AND user_id=?", track.ID, userID).
+			First(&play).
+			Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("find play: %w", err)
+		}
+		play.TrackID = track.ID
+		play.UserID = userID
+		play.Count++
+		if playTime.After(play.Time) {
+			play.Time = playTime
+		}
+		if err := tx.Save(&play).Error; err != nil {
+			return fmt.Errorf("save play: %w", err)
+		}
+		return nil
+	})
 }
 
 func streamUpdatePodcastEpisodeStats(dbc *db.DB, peID int) error {
@@ -129,27 +153,36 @@ func coverGetPath(dbc *db.DB, podcastPath string, id specid.ID) (string, error)
 func coverGetPathAlbum(dbc *db.DB, id int) (string, error) {
 	folder := &db.Album{}
 	err := dbc.DB.
-		Select("id, root_dir, left_path, right_path, cover").
+		Select("id, root_dir, left_path, right_path, cover, embedded_cover").
 		First(folder, id).
 		Error
 	if err != nil {
 		return "", fmt.Errorf("select album: %w", err)
 	}
-	if folder.Cover == "" {
+	return coverGetPathFolder(folder)
+}
+
+// coverGetPathFolder finds a folder's cover file, or else the track with an embedded cover
+func coverGetPathFolder(folder *db.Album) (string, error) {
+	cover := folder.Cover
+	if cover == "" {
+		cover = folder.EmbeddedCover
+	}
+	if cover == "" {
 		return "", errCoverEmpty
 	}
 	return path.Join(
 		folder.RootDir,
 		folder.LeftPath,
 		folder.RightPath,
-		folder.Cover,
+		cover,
 	), nil
 }
 
 func coverGetPathArtist(dbc *db.DB, id int) (string, error) {
 	folder := &db.Album{}
 	err := dbc.DB.
-		Select("albums.id, albums.root_dir, albums.left_path, albums.right_path, albums.cover").
+		Select("albums.id, albums.root_dir, albums.left_path, albums.right_path, albums.cover, albums.embedded_cover").
 		Joins("JOIN album_artists ON album_artists.album_id=albums.id").
 		Where("album_artists.artist_id=?", id).
 		Group("albums.id").
@@ -158,15 +191,7 @@ func coverGetPathArtist(dbc *db.DB, id int) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("select guessed artist folder: %w", err)
 	}
-	if folder.Cover == "" {
-		return "", errCoverEmpty
-	}
-	return path.Join(
-		folder.RootDir,
-		folder.LeftPath,
-		folder.RightPath,
-		folder.Cover,
-	), nil
+	return coverGetPathFolder(folder)
 }
 
 func coverGetPathPodcast(dbc *db.DB, podcastPath string, id int) (string, error) {
@@ -204,8 +229,20 @@ func coverGetPathPodcastEpisode(dbc *db.DB, podcastPath string, id int) (string,
 	return path.Join(podcastPath, podcast.ImagePath), nil
 }
 
+// coverOpen opens a cover file, or extracts the cover embedded in an audio file
+func coverOpen(absPath string) (image.Image, error) {
+	if mime.TypeByAudioExtension(filepath.Ext(absPath)) == "" {
+		return imaging.Open(absPath)
+	}
+	picture, err := tags.ReadPicture(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("read embedded: %w", err)
+	}
+	return imaging.Decode(bytes.NewReader(picture))
+}
+
 func coverScaleAndSave(absPath, cachePath string, size int) error {
-	src, err := imaging.Open(absPath)
+	src, err := coverOpen(absPath)
 	if err != nil {
 		return fmt.Errorf("resizing `%s`: %w", absPath, err)
 	}
@@ -269,10 +306,19 @@ func (c *Controller) ServeStream(w http.ResponseWriter, r *http.Request) *spec.R
 		return spec.NewError(0, "type of id does not contain audio")
 	}
 
-	if track, ok := audioFile.(*db.Track); ok && track.Album != nil {
+	// tracks split from a file by a cue sheet can only be served by transcoding their part of the file. so
+	// they're flac even with format=raw, as their transcodedContentType and transcodedSuffix say
+	var cueStart, cueDuration time.Duration
+	var isCue bool
+	if track, ok := audioFile.(*db.Track); ok && track.CueTrack > 0 {
+		cueStart, cueDuration = track.CueRange()
+		isCue = true
+	}
+
+	if track, ok := audioFile.(*db.Track); ok && track.Album != nil && c.ListensFromStream {
 		defer func() {
-			if err := streamUpdateStats(c.DB, user.ID, track, time.Now()); err != nil {
-				log.Printf("error updating track status: %v", err)
+			if err := streamRecordListen(c.DB, user.ID, track, params.GetOr("c", ""), time.Now()); err != nil {
+				log.Printf("error recording listen: %v", err)
 			}
 		}()
 	}
@@ -288,26 +334,32 @@ func (c *Controller) ServeStream(w http.ResponseWriter, r *http.Request) *spec.R
 	maxBitRate, _ := params.GetInt("maxBitRate")
 	format, _ := params.Get("format")
 
-	if format == "raw" || maxBitRate >= audioFile.AudioBitrate() {
-		http.ServeFile(w, r, file.AbsPath())
-		return nil
-	}
+	// formats like dsf and ape which clients can't play are transcoded too, unless asked for raw
+	canServeRaw := !isCue && (format == "raw" || mime.IsNativeAudioExtension(filepath.Ext(file.AbsPath())))
 
-	pref, err := streamGetTransPref(c.DB, user.ID, params.GetOr("c", ""))
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	var profile transcode.Profile
+	switch pref, err := streamGetTransPref(c.DB, user.ID, params.GetOr("c", "")); {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
 		return spec.NewError(0, "couldn't find transcode preference: %v", err)
+	case format == "raw" || (canServeRaw && maxBitRate >= audioFile.AudioBitrate()) || pref == nil:
+		if canServeRaw {
+			http.ServeFile(w, r, file.AbsPath())
+			return nil
+		}
+		profile = transcode.FLAC
+	default:
+		var ok bool
+		profile, ok = transcode.UserProfiles[pref.Profile]
+		if !ok {
+			return spec.NewError(0, "unknown transcode user profile %q", pref.Profile)
+		}
+		if maxBitRate > 0 && int(profile.BitRate()) > maxBitRate {
+			profile = transcode.WithBitrate(profile, transcode.BitRate(maxBitRate))
+		}
 	}
-	if pref == nil {
-		http.ServeFile(w, r, file.AbsPath())
-		return nil
-	}
-
-	profile, ok := transcode.UserProfiles[pref.Profile]
-	if !ok {
-		return spec.NewError(0, "unknown transcode user profile %q", pref.Profile)
-	}
-	if maxBitRate > 0 && int(profile.BitRate()) > maxBitRate {
-		profile = transcode.WithBitrate(profile, transcode.BitRate(maxBitRate))
+	if isCue {
+		profile = transcode.WithSeek(profile, cueStart)
+		profile = transcode.WithDuration(profile, cueDuration)
 	}
 
 	log.Printf("trancoding to %q with max bitrate %dk", profile.MIME(), profile.BitRate())
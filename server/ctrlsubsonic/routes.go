@@ -33,6 +33,9 @@ func AddRoutes(c *Controller, r *mux.Router) {
 	r.Handle("/getSimilarSongs{_:(?:\\.view)?}", c.H(c.ServeGetSimilarSongs))
 	r.Handle("/getSimilarSongs2{_:(?:\\.view)?}", c.H(c.ServeGetSimilarSongsTwo))
 	r.Handle("/getLyrics{_:(?:\\.view)?}", c.H(c.ServeGetLyrics))
+	r.Handle("/getLyricsBySongId{_:(?:\\.view)?}", c.H(c.ServeGetLyricsBySongID))
+	r.Handle("/getOpenSubsonicExtensions{_:(?:\\.view)?}", c.H(c.ServeGetOpenSubsonicExtensions))
+	r.Handle("/getListeningStats{_:(?:\\.view)?}", c.H(c.ServeGetListeningStats))
 
 	// raw
 	r.Handle("/getCoverArt{_:(?:\\.view)?}", c.HR(c.ServeGetCoverArt))
@@ -25,7 +25,7 @@ func NewAlbumByFolder(f *db.Album) *Album {
 	if f.AlbumRating != nil {
 		a.UserRating = f.AlbumRating.Rating
 	}
-	if f.Cover != "" {
+	if f.HasCover() {
 		a.CoverID = f.SID()
 	}
 	return a
@@ -46,7 +46,7 @@ func NewTCAlbumByFolder(f *db.Album) *TrackChild {
 	if f.AlbumRating != nil {
 		trCh.UserRating = f.AlbumRating.Rating
 	}
-	if f.Cover != "" {
+	if f.HasCover() {
 		trCh.CoverID = f.SID()
 	}
 	return trCh
@@ -67,20 +67,29 @@ func NewTCTrackByFolder(t *db.Track, parent *db.Album) *TrackChild {
 			parent.RightPath,
 			t.Filename,
 		),
-		ParentID:      parent.SID(),
-		Duration:      t.Length,
-		Genre:         strings.Join(t.GenreStrings(), ", "),
-		Year:          parent.TagYear,
-		Bitrate:       t.Bitrate,
-		IsDir:         false,
-		Type:          "music",
-		CreatedAt:     t.CreatedAt,
-		AverageRating: formatRating(t.AverageRating),
+		ParentID:        parent.SID(),
+		Duration:        t.Length,
+		Genre:           strings.Join(t.GenreStrings(), ", "),
+		Year:            parent.TagYear,
+		Bitrate:         t.Bitrate,
+		IsDir:           false,
+		Type:            "music",
+		CreatedAt:       t.CreatedAt,
+		AverageRating:   formatRating(t.AverageRating),
+		ReplayGain:      newReplayGain(t),
+		BPM:             t.TagBPM,
+		Comment:         t.TagComment,
+		DisplayComposer: t.TagComposer,
+		Conductor:       t.TagConductor,
+		Lyricist:        t.TagLyricist,
+		SamplingRate:    t.SampleRate,
+		BitDepth:        t.BitDepth,
+		ChannelCount:    t.Channels,
 	}
 	if trCh.Title == "" {
 		trCh.Title = t.Filename
 	}
-	if parent.Cover != "" {
+	if parent.HasCover() {
 		trCh.CoverID = parent.SID()
 	}
 	if t.Album != nil {
@@ -92,6 +101,11 @@ func NewTCTrackByFolder(t *db.Track, parent *db.Album) *TrackChild {
 	if t.TrackRating != nil {
 		trCh.UserRating = t.TrackRating.Rating
 	}
+	if t.TrackPlay != nil {
+		trCh.PlayCount = t.TrackPlay.Count
+		trCh.Played = &t.TrackPlay.Time
+	}
+	trCh.TranscodedContentType, trCh.TranscodedSuffix = newDefaultTranscoded(t)
 	return trCh
 }
 
@@ -130,7 +144,7 @@ func NewArtistByFolder(f *db.Album) *Artist {
 	if f.AlbumRating != nil {
 		a.UserRating = f.AlbumRating.Rating
 	}
-	if f.Cover != "" {
+	if f.HasCover() {
 		a.CoverID = f.SID()
 	}
 	return a
@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/lyrics"
+	"go.senan.xyz/gonic/server/ctrlsubsonic/specid"
 )
 
 func NewAlbumByTags(a *db.Album, artists []*db.Artist) *Album {
@@ -17,8 +19,24 @@ func NewAlbumByTags(a *db.Album, artists []*db.Artist) *Album {
 		TrackCount:    a.ChildCount,
 		Duration:      a.Duration,
 		AverageRating: formatRating(a.AverageRating),
+		// opensubsonic
+		CatalogNumber:       a.TagCatalogNumber,
+		IsCompilation:       a.TagCompilation,
+		ReleaseTypes:        a.ReleaseTypes(),
+		OriginalReleaseDate: newItemDate(a.TagOriginalDate),
 	}
-	if a.Cover != "" {
+	if a.TagLabel != "" {
+		ret.RecordLabels = []*RecordLabel{{Name: a.TagLabel}}
+	}
+	seenDiscs := map[int]struct{}{}
+	for _, t := range a.Tracks {
+		if _, ok := seenDiscs[t.TagDiscNumber]; ok || t.TagDiscSubtitle == "" {
+			continue
+		}
+		seenDiscs[t.TagDiscNumber] = struct{}{}
+		ret.DiscTitles = append(ret.DiscTitles, &DiscTitle{Disc: t.TagDiscNumber, Title: t.TagDiscSubtitle})
+	}
+	if a.HasCover() {
 		ret.CoverID = a.SID()
 	}
 	if a.AlbumStar != nil {
@@ -50,6 +68,11 @@ func NewAlbumByTags(a *db.Album, artists []*db.Artist) *Album {
 }
 
 func NewTrackByTags(t *db.Track, album *db.Album) *TrackChild {
+	// the track's own folder, which is different to album's if it's from a disc merged into album
+	folder := album
+	if t.Album != nil {
+		folder = t.Album
+	}
 	ret := &TrackChild{
 		ID:          t.SID(),
 		ContentType: t.MIME(),
@@ -62,20 +85,29 @@ func NewTrackByTags(t *db.Track, album *db.Album) *TrackChild {
 		TrackNumber: t.TagTrackNumber,
 		DiscNumber:  t.TagDiscNumber,
 		Path: path.Join(
-			album.LeftPath,
-			album.RightPath,
+			folder.LeftPath,
+			folder.RightPath,
 			t.Filename,
 		),
-		Album:         album.TagTitle,
-		AlbumID:       album.SID(),
-		Genre:         strings.Join(t.GenreStrings(), ", "),
-		Duration:      t.Length,
-		Bitrate:       t.Bitrate,
-		Type:          "music",
-		Year:          album.TagYear,
-		AverageRating: formatRating(t.AverageRating),
-	}
-	if album.Cover != "" {
+		Album:           album.TagTitle,
+		AlbumID:         album.TagSID(),
+		Genre:           strings.Join(t.GenreStrings(), ", "),
+		Duration:        t.Length,
+		Bitrate:         t.Bitrate,
+		Type:            "music",
+		Year:            album.TagYear,
+		AverageRating:   formatRating(t.AverageRating),
+		ReplayGain:      newReplayGain(t),
+		BPM:             t.TagBPM,
+		Comment:         t.TagComment,
+		DisplayComposer: t.TagComposer,
+		Conductor:       t.TagConductor,
+		Lyricist:        t.TagLyricist,
+		SamplingRate:    t.SampleRate,
+		BitDepth:        t.BitDepth,
+		ChannelCount:    t.Channels,
+	}
+	if album.HasCover() {
 		ret.CoverID = album.SID()
 	}
 	if t.TrackStar != nil {
@@ -84,15 +116,54 @@ func NewTrackByTags(t *db.Track, album *db.Album) *TrackChild {
 	if t.TrackRating != nil {
 		ret.UserRating = t.TrackRating.Rating
 	}
+	if t.TrackPlay != nil {
+		ret.PlayCount = t.TrackPlay.Count
+		ret.Played = &t.TrackPlay.Time
+	}
 	if len(album.Artists) > 0 {
 		sort.Slice(album.Artists, func(i, j int) bool {
 			return album.Artists[i].ID < album.Artists[j].ID
 		})
 		ret.ArtistID = album.Artists[0].SID()
 	}
+	sort.Slice(t.Artists, func(i, j int) bool {
+		return t.Artists[i].ID < t.Artists[j].ID
+	})
+	for _, a := range t.Artists {
+		ret.Artists = append(ret.Artists, &ArtistRef{
+			ID:   a.SID(),
+			Name: a.Name,
+		})
+	}
+	ret.TranscodedContentType, ret.TranscodedSuffix = newDefaultTranscoded(t)
 	return ret
 }
 
+func newReplayGain(t *db.Track) *ReplayGain {
+	ret := &ReplayGain{
+		TrackGain: t.ReplayGainTrackGain,
+		AlbumGain: t.ReplayGainAlbumGain,
+		TrackPeak: t.ReplayGainTrackPeak,
+		AlbumPeak: t.ReplayGainAlbumPeak,
+	}
+	if ret.TrackGain == 0 && t.R128TrackGain != 0 {
+		ret.TrackGain = r128ToReplayGain(t.R128TrackGain)
+	}
+	if ret.AlbumGain == 0 && t.R128AlbumGain != 0 {
+		ret.AlbumGain = r128ToReplayGain(t.R128AlbumGain)
+	}
+	if *ret == (ReplayGain{}) {
+		return nil
+	}
+	return ret
+}
+
+// r128ToReplayGain converts an R128 gain, which is in Q7.8 fixed point relative to -23 LUFS, to
+// one relative to ReplayGain's -18 LUFS
+func r128ToReplayGain(gain int) float32 {
+	return float32(gain)/256 + 5
+}
+
 func NewArtistByTags(a *db.Artist) *Artist {
 	r := &Artist{
 		ID:            a.SID(),
@@ -100,6 +171,7 @@ func NewArtistByTags(a *db.Artist) *Artist {
 		AlbumCount:    a.AlbumCount,
 		AverageRating: formatRating(a.AverageRating),
 		CoverID:       a.SID(),
+		MusicBrainzID: a.BrainzID,
 	}
 	if a.ArtistStar != nil {
 		r.Starred = &a.ArtistStar.StarDate
@@ -117,3 +189,80 @@ func NewGenre(g *db.Genre) *Genre {
 		SongCount:  g.TrackCount,
 	}
 }
+
+func NewStructuredLyrics(t *db.Track, l *lyrics.Lyrics) *StructuredLyrics {
+	ret := &StructuredLyrics{
+		DisplayArtist: t.TagTrackArtist,
+		DisplayTitle:  t.TagTitle,
+		Lang:          l.Lang,
+		Synced:        l.Synced,
+		Offset:        l.Offset.Milliseconds(),
+		Lines:         make([]*LyricsLine, 0, len(l.Lines)),
+	}
+	if ret.Lang == "" {
+		ret.Lang = "xxx" // undetermined, as in ID3 and the opensubsonic spec
+	}
+	for _, line := range l.Lines {
+		specLine := &LyricsLine{Value: line.Value}
+		if l.Synced {
+			start := line.Start.Milliseconds()
+			specLine.Start = &start
+		}
+		ret.Lines = append(ret.Lines, specLine)
+	}
+	return ret
+}
+
+func NewListeningStats(rangeName string, stats *db.ListenStats) *ListeningStats {
+	ret := &ListeningStats{
+		Range:         rangeName,
+		Listens:       stats.Listens,
+		ListeningTime: stats.Length,
+		SongCount:     stats.Tracks,
+		AlbumCount:    stats.Albums,
+		ArtistCount:   stats.Artists,
+		Artists:       newListeningStats(specid.Artist, stats.TopArtists),
+		Albums:        newListeningStats(specid.Album, stats.TopAlbums),
+		Songs:         newListeningStats(specid.Track, stats.TopTracks),
+		Genres:        newListeningStats("", stats.TopGenres),
+		Days:          newListeningPeriods(stats.Days),
+		Months:        newListeningPeriods(stats.Months),
+	}
+	if stats.BusiestDay != nil {
+		ret.BusiestDay = newListeningPeriod(stats.BusiestDay)
+	}
+	return ret
+}
+
+func newListeningStats(idType specid.IDT, stats []*db.ListenStat) []*ListeningStat {
+	ret := make([]*ListeningStat, 0, len(stats))
+	for _, stat := range stats {
+		r := &ListeningStat{
+			Name:          stat.Name,
+			Artist:        stat.Artist,
+			Listens:       stat.Listens,
+			ListeningTime: stat.Length,
+		}
+		if idType != "" {
+			r.ID = &specid.ID{Type: idType, Value: stat.ID}
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+func newListeningPeriods(periods []*db.ListenPeriod) []*ListeningPeriod {
+	ret := make([]*ListeningPeriod, 0, len(periods))
+	for _, p := range periods {
+		ret = append(ret, newListeningPeriod(p))
+	}
+	return ret
+}
+
+func newListeningPeriod(p *db.ListenPeriod) *ListeningPeriod {
+	return &ListeningPeriod{
+		Date:          p.Period,
+		Listens:       p.Listens,
+		ListeningTime: p.Length,
+	}
+}
@@ -2,11 +2,15 @@ package spec
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"go.senan.xyz/gonic"
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/mime"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/specid"
+	"go.senan.xyz/gonic/transcode"
 )
 
 // https://web.archive.org/web/20220707025402/https://www.subsonic.org/pages/api.jsp
@@ -28,6 +32,7 @@ type Response struct {
 	// https://opensubsonic.netlify.app/docs/responses/subsonic-response/
 	Type          string `xml:"type,attr"          json:"type"`
 	ServerVersion string `xml:"serverVersion,attr" json:"serverVersion"`
+	OpenSubsonic  bool   `xml:"openSubsonic,attr"  json:"openSubsonic"`
 
 	Error                 *Error                 `xml:"error"                 json:"error,omitempty"`
 	Albums                *Albums                `xml:"albumList"             json:"albumList,omitempty"`
@@ -64,6 +69,10 @@ type Response struct {
 	SimilarSongsTwo       *SimilarSongsTwo       `xml:"similarSongs2"         json:"similarSongs2,omitempty"`
 	InternetRadioStations *InternetRadioStations `xml:"internetRadioStations" json:"internetRadioStations,omitempty"`
 	Lyrics                *Lyrics                `xml:"lyrics"                json:"lyrics,omitempty"`
+
+	LyricsList             *LyricsList              `xml:"lyricsList"             json:"lyricsList,omitempty"`
+	OpenSubsonicExtensions []*OpenSubsonicExtension `xml:"openSubsonicExtensions" json:"openSubsonicExtensions,omitempty"`
+	ListeningStats         *ListeningStats          `xml:"listeningStats"         json:"listeningStats,omitempty"`
 }
 
 func NewResponse() *Response {
@@ -73,6 +82,7 @@ func NewResponse() *Response {
 		Version:       apiVersion,
 		Type:          gonic.Name,
 		ServerVersion: gonic.Version,
+		OpenSubsonic:  true,
 	}
 }
 
@@ -104,6 +114,7 @@ func NewError(code int, message string, a ...interface{}) *Response {
 		},
 		Type:          gonic.Name,
 		ServerVersion: gonic.Version,
+		OpenSubsonic:  true,
 	}
 }
 
@@ -141,6 +152,31 @@ type Album struct {
 	Starred       *time.Time `xml:"starred,attr,omitempty"         json:"starred,omitempty"`
 	UserRating    int        `xml:"userRating,attr,omitempty"      json:"userRating,omitempty"`
 	AverageRating string     `xml:"averageRating,attr,omitempty"   json:"averageRating,omitempty"`
+	// opensubsonic
+	RecordLabels        []*RecordLabel `xml:"recordLabels,omitempty"        json:"recordLabels,omitempty"`
+	CatalogNumber       string         `xml:"catalogNumber,attr,omitempty"  json:"catalogNumber,omitempty"`
+	IsCompilation       bool           `xml:"isCompilation,attr,omitempty"  json:"isCompilation,omitempty"`
+	ReleaseTypes        []string       `xml:"releaseTypes,omitempty"        json:"releaseTypes,omitempty"`
+	OriginalReleaseDate *ItemDate      `xml:"originalReleaseDate,omitempty" json:"originalReleaseDate,omitempty"`
+	DiscTitles          []*DiscTitle   `xml:"discTitles,omitempty"          json:"discTitles,omitempty"`
+}
+
+// https://opensubsonic.netlify.app/docs/responses/recordlabel/
+type RecordLabel struct {
+	Name string `xml:"name,attr" json:"name"`
+}
+
+// https://opensubsonic.netlify.app/docs/responses/itemdate/
+type ItemDate struct {
+	Year  int `xml:"year,attr,omitempty"  json:"year,omitempty"`
+	Month int `xml:"month,attr,omitempty" json:"month,omitempty"`
+	Day   int `xml:"day,attr,omitempty"   json:"day,omitempty"`
+}
+
+// https://opensubsonic.netlify.app/docs/responses/disctitle/
+type DiscTitle struct {
+	Disc  int    `xml:"disc,attr"  json:"disc"`
+	Title string `xml:"title,attr" json:"title"`
 }
 
 type RandomTracks struct {
@@ -180,6 +216,44 @@ type TrackChild struct {
 	Starred       *time.Time `xml:"starred,attr,omitempty"         json:"starred,omitempty"`
 	UserRating    int        `xml:"userRating,attr,omitempty"      json:"userRating,omitempty"`
 	AverageRating string     `xml:"averageRating,attr,omitempty"   json:"averageRating,omitempty"`
+	// opensubsonic
+	Artists         []*ArtistRef `xml:"artists,omitempty"              json:"artists,omitempty"`
+	ReplayGain      *ReplayGain  `xml:"replayGain,omitempty"           json:"replayGain,omitempty"`
+	BPM             int          `xml:"bpm,attr,omitempty"             json:"bpm,omitempty"`
+	Comment         string       `xml:"comment,attr,omitempty"         json:"comment,omitempty"`
+	DisplayComposer string       `xml:"displayComposer,attr,omitempty" json:"displayComposer,omitempty"`
+	Conductor       string       `xml:"conductor,attr,omitempty"       json:"conductor,omitempty"`
+	Lyricist        string       `xml:"lyricist,attr,omitempty"        json:"lyricist,omitempty"`
+	SamplingRate    int          `xml:"samplingRate,attr,omitempty"    json:"samplingRate,omitempty"`
+	BitDepth        int          `xml:"bitDepth,attr,omitempty"        json:"bitDepth,omitempty"`
+	ChannelCount    int          `xml:"channelCount,attr,omitempty"    json:"channelCount,omitempty"`
+	PlayCount       int          `xml:"playCount,attr,omitempty"       json:"playCount,omitempty"`
+	Played          *time.Time   `xml:"played,attr,omitempty"          json:"played,omitempty"`
+}
+
+// SetTranscoded sets what the track is streamed as with the user's transcode preference. without one
+// it's left as the default, which is flac for formats clients can't play and for cue tracks
+func (t *TrackChild) SetTranscoded(contentType, suffix string) {
+	if contentType == "" {
+		return
+	}
+	t.TranscodedContentType = contentType
+	t.TranscodedSuffix = suffix
+}
+
+func newDefaultTranscoded(t *db.Track) (contentType, suffix string) {
+	if t.CueTrack > 0 || !mime.IsNativeAudioExtension(t.Ext()) {
+		return transcode.FLAC.MIME(), transcode.FLAC.Suffix()
+	}
+	return "", ""
+}
+
+// https://opensubsonic.netlify.app/docs/responses/replaygain/
+type ReplayGain struct {
+	TrackGain float32 `xml:"trackGain,attr,omitempty" json:"trackGain,omitempty"`
+	AlbumGain float32 `xml:"albumGain,attr,omitempty" json:"albumGain,omitempty"`
+	TrackPeak float32 `xml:"trackPeak,attr,omitempty" json:"trackPeak,omitempty"`
+	AlbumPeak float32 `xml:"albumPeak,attr,omitempty" json:"albumPeak,omitempty"`
 }
 
 type Artists struct {
@@ -197,6 +271,8 @@ type Artist struct {
 	Starred       *time.Time `xml:"starred,attr,omitempty"       json:"starred,omitempty"`
 	UserRating    int        `xml:"userRating,attr,omitempty"    json:"userRating,omitempty"`
 	AverageRating string     `xml:"averageRating,attr,omitempty" json:"averageRating,omitempty"`
+	// opensubsonic
+	MusicBrainzID string `xml:"musicBrainzId,attr,omitempty" json:"musicBrainzId,omitempty"`
 }
 
 type Indexes struct {
@@ -236,6 +312,13 @@ type Licence struct {
 type ScanStatus struct {
 	Scanning bool `xml:"scanning,attr"        json:"scanning"`
 	Count    int  `xml:"count,attr,omitempty" json:"count,omitempty"`
+	// gonic specific, only set while scanning
+	CurrentFolder  string `xml:"currentFolder,attr,omitempty"  json:"currentFolder,omitempty"`
+	FolderCount    int    `xml:"folderCount,attr,omitempty"    json:"folderCount,omitempty"`
+	FolderTotal    int    `xml:"folderTotal,attr,omitempty"    json:"folderTotal,omitempty"`
+	NewCount       int    `xml:"newCount,attr,omitempty"       json:"newCount,omitempty"`
+	ErrorCount     int    `xml:"errorCount,attr,omitempty"     json:"errorCount,omitempty"`
+	ElapsedSeconds int    `xml:"elapsedSeconds,attr,omitempty" json:"elapsedSeconds,omitempty"`
 }
 
 type SearchResultTwo struct {
@@ -426,6 +509,74 @@ type Lyrics struct {
 	Title  string `xml:"title,attr,omitempty"  json:"title,omitempty"`
 }
 
+// https://opensubsonic.netlify.app/docs/endpoints/getlyricsbysongid/
+type LyricsList struct {
+	StructuredLyrics []*StructuredLyrics `xml:"structuredLyrics" json:"structuredLyrics"`
+}
+
+type StructuredLyrics struct {
+	DisplayArtist string        `xml:"displayArtist,attr,omitempty" json:"displayArtist,omitempty"`
+	DisplayTitle  string        `xml:"displayTitle,attr,omitempty"  json:"displayTitle,omitempty"`
+	Lang          string        `xml:"lang,attr"                    json:"lang"`
+	Synced        bool          `xml:"synced,attr"                  json:"synced"`
+	Offset        int64         `xml:"offset,attr,omitempty"        json:"offset,omitempty"`
+	Lines         []*LyricsLine `xml:"line"                         json:"line"`
+}
+
+type LyricsLine struct {
+	Start *int64 `xml:"start,attr,omitempty" json:"start,omitempty"` // in milliseconds, only for synced lyrics
+	Value string `xml:",chardata"            json:"value"`
+}
+
+// https://opensubsonic.netlify.app/docs/endpoints/getopensubsonicextensions/
+type OpenSubsonicExtension struct {
+	Name     string `xml:"name,attr" json:"name"`
+	Versions []int  `xml:"versions"  json:"versions"`
+}
+
+// ListeningStats is gonic's own, for getListeningStats
+type ListeningStats struct {
+	Range         string             `xml:"range,attr"           json:"range"`
+	Listens       int                `xml:"listens,attr"         json:"listens"`
+	ListeningTime int                `xml:"listeningTime,attr"   json:"listeningTime"` // in seconds
+	SongCount     int                `xml:"songCount,attr"       json:"songCount"`
+	AlbumCount    int                `xml:"albumCount,attr"      json:"albumCount"`
+	ArtistCount   int                `xml:"artistCount,attr"     json:"artistCount"`
+	BusiestDay    *ListeningPeriod   `xml:"busiestDay,omitempty" json:"busiestDay,omitempty"`
+	Artists       []*ListeningStat   `xml:"artist"               json:"artist"`
+	Albums        []*ListeningStat   `xml:"album"                json:"album"`
+	Songs         []*ListeningStat   `xml:"song"                 json:"song"`
+	Genres        []*ListeningStat   `xml:"genre"                json:"genre"`
+	Days          []*ListeningPeriod `xml:"day"                  json:"day"`
+	Months        []*ListeningPeriod `xml:"month"                json:"month"`
+}
+
+type ListeningStat struct {
+	ID            *specid.ID `xml:"id,attr,omitempty"     json:"id,omitempty"` // except for genres
+	Name          string     `xml:"name,attr"             json:"name"`
+	Artist        string     `xml:"artist,attr,omitempty" json:"artist,omitempty"`
+	Listens       int        `xml:"listens,attr"          json:"listens"`
+	ListeningTime int        `xml:"listeningTime,attr"    json:"listeningTime"`
+}
+
+type ListeningPeriod struct {
+	Date          string `xml:"date,attr"          json:"date"` // like 2006-01-02, or 2006-01 for months
+	Listens       int    `xml:"listens,attr"       json:"listens"`
+	ListeningTime int    `xml:"listeningTime,attr" json:"listeningTime"`
+}
+
+// newItemDate parses a date tag like 2006, 2006-01, or 2006-01-02
+func newItemDate(date string) *ItemDate {
+	var parts [3]int
+	for i, part := range strings.SplitN(date, "-", 3) {
+		parts[i], _ = strconv.Atoi(strings.TrimSpace(part))
+	}
+	if parts[0] == 0 {
+		return nil
+	}
+	return &ItemDate{Year: parts[0], Month: parts[1], Day: parts[2]}
+}
+
 func formatRating(rating float64) string {
 	if rating == 0 {
 		return ""
@@ -22,7 +22,7 @@ func Locate(dbc *db.DB, podcastsPath string, id specid.ID) (Result, error) {
 	switch id.Type {
 	case specid.Track:
 		var track db.Track
-		if err := dbc.Preload("Album").Where("id=?", id.Value).Find(&track).Error; err == nil {
+		if err := dbc.Preload("Album").Preload("TagAlbum").Where("id=?", id.Value).Find(&track).Error; err == nil {
 			return &track, nil
 		}
 	case specid.PodcastEpisode:
@@ -67,7 +67,8 @@ func Lookup(dbc *db.DB, musicPaths []string, podcastsPath string, path string) (
 	q := dbc.
 		Where(`albums.root_dir=? AND albums.left_path=? AND albums.right_path=? AND tracks.filename=?`, musicPath, leftPath, rightPath, filename).
 		Joins(`JOIN albums ON tracks.album_id=albums.id`).
-		Preload("Album")
+		Preload("Album").
+		Preload("TagAlbum")
 
 	var track db.Track
 	if err := q.First(&track).Error; err == nil {
@@ -20,7 +20,7 @@ type Transcoder interface {
 
 var UserProfiles = map[string]Profile{
 	"mp3":          MP3,
-  "mp3_320":      MP3320,
+	"mp3_320":      MP3320,
 	"mp3_rg":       MP3RG,
 	"opus_car":     OpusRGLoud,
 	"opus":         Opus,
@@ -45,23 +45,28 @@ var (
 	Opus128RG     = NewProfile("audio/ogg", "opus", 128, `ffmpeg -v 0 -i <file> -ss <seek> -map 0:a:0 -vn -b:a <bitrate> -c:a libopus -vbr on -af "volume=replaygain=track:replaygain_preamp=6dB:replaygain_noclip=0, alimiter=level=disabled, asidedata=mode=delete:type=REPLAYGAIN" -metadata replaygain_album_gain= -metadata replaygain_album_peak= -metadata replaygain_track_gain= -metadata replaygain_track_peak= -metadata r128_album_gain= -metadata r128_track_gain= -f opus -`)
 	Opus128RGLoud = NewProfile("audio/ogg", "opus", 128, `ffmpeg -v 0 -i <file> -ss <seek> -map 0:a:0 -vn -b:a <bitrate> -c:a libopus -vbr on -af "aresample=96000:resampler=soxr, volume=replaygain=track:replaygain_preamp=15dB:replaygain_noclip=0, alimiter=level=disabled, asidedata=mode=delete:type=REPLAYGAIN" -metadata replaygain_album_gain= -metadata replaygain_album_peak= -metadata replaygain_track_gain= -metadata replaygain_track_peak= -metadata r128_album_gain= -metadata r128_track_gain= -f opus -`)
 
-	Opus192       = NewProfile("audio/ogg", "opus", 192, `ffmpeg -v 0 -i <file> -ss <seek> -map 0:a:0 -vn -b:a <bitrate> -c:a libopus -vbr on -f opus -`)
+	Opus192 = NewProfile("audio/ogg", "opus", 192, `ffmpeg -v 0 -i <file> -ss <seek> -map 0:a:0 -vn -b:a <bitrate> -c:a libopus -vbr on -f opus -`)
+
+	// FLAC is lossless, for serving part of a file when the client didn't ask for a transcode
+	FLAC = NewProfile("audio/flac", "flac", 0, `ffmpeg -v 0 -i <file> -ss <seek> -map 0:a:0 -vn -c:a flac -f flac -`)
 )
 
 type BitRate uint // kilobits/s
 
 type Profile struct {
-	bitrate BitRate // the default bitrate, but the user can request a different one
-	seek    time.Duration
-	mime    string
-	suffix  string
-	exec    string
+	bitrate  BitRate // the default bitrate, but the user can request a different one
+	seek     time.Duration
+	duration time.Duration // zero for the rest of the file
+	mime     string
+	suffix   string
+	exec     string
 }
 
-func (p *Profile) BitRate() BitRate    { return p.bitrate }
-func (p *Profile) Seek() time.Duration { return p.seek }
-func (p *Profile) Suffix() string      { return p.suffix }
-func (p *Profile) MIME() string        { return p.mime }
+func (p *Profile) BitRate() BitRate        { return p.bitrate }
+func (p *Profile) Seek() time.Duration     { return p.seek }
+func (p *Profile) Duration() time.Duration { return p.duration }
+func (p *Profile) Suffix() string          { return p.suffix }
+func (p *Profile) MIME() string            { return p.mime }
 
 func NewProfile(mime string, suffix string, bitrate BitRate, exec string) Profile {
 	return Profile{mime: mime, suffix: suffix, bitrate: bitrate, exec: exec}
@@ -77,7 +82,13 @@ func WithSeek(p Profile, seek time.Duration) Profile {
 	return p
 }
 
+func WithDuration(p Profile, duration time.Duration) Profile {
+	p.duration = duration
+	return p
+}
+
 var ErrNoProfileParts = fmt.Errorf("not enough profile parts")
+var ErrNoProfileSeek = fmt.Errorf("profile has no <seek> for part of a file")
 
 func parseProfile(profile Profile, in string) (string, []string, error) {
 	parts, err := shlex.Split(profile.exec)
@@ -93,18 +104,27 @@ func parseProfile(profile Profile, in string) (string, []string, error) {
 	}
 
 	var args []string
+	var seeks bool
 	for _, p := range parts[1:] {
 		switch p {
 		case "<file>":
 			args = append(args, in)
 		case "<seek>":
+			seeks = true
 			args = append(args, fmt.Sprintf("%dus", profile.Seek().Microseconds()))
+			if profile.Duration() > 0 {
+				args = append(args, "-t", fmt.Sprintf("%dus", profile.Duration().Microseconds()))
+			}
 		case "<bitrate>":
 			args = append(args, fmt.Sprintf("%dk", profile.BitRate()))
 		default:
 			args = append(args, p)
 		}
 	}
+	// without it, every part would be the whole file, and share a cache key
+	if !seeks && (profile.Seek() > 0 || profile.Duration() > 0) {
+		return "", nil, ErrNoProfileSeek
+	}
 
 	return name, args, nil
 }
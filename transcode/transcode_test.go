@@ -0,0 +1,39 @@
+package transcode
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCueTrackCacheKeys(t *testing.T) {
+	// a fake ffmpeg on the PATH, since it's only looked up
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte("#!/bin/sh\n"), 0o700)) //nolint:gosec
+	t.Setenv("PATH", bin)
+
+	key := func(profile Profile, seek, duration time.Duration) string {
+		profile = WithSeek(profile, seek)
+		profile = WithDuration(profile, duration)
+		name, args, err := parseProfile(profile, "/music/album.flac")
+		require.NoError(t, err)
+		return cacheKey(name, args)
+	}
+
+	// two tracks of one file
+	first := key(FLAC, 0, 3*time.Minute)
+	second := key(FLAC, 3*time.Minute, 4*time.Minute)
+	require.NotEqual(t, first, second)
+	require.NotEqual(t, first, key(FLAC, 0, 0))
+	require.Equal(t, second, key(FLAC, 3*time.Minute, 4*time.Minute))
+
+	// a profile which can't seek can't serve part of a file
+	noSeek := NewProfile("audio/flac", "flac", 0, `ffmpeg -v 0 -i <file> -map 0:a:0 -vn -c:a flac -f flac -`)
+	_, _, err := parseProfile(WithSeek(noSeek, 3*time.Minute), "/music/album.flac")
+	require.ErrorIs(t, err, ErrNoProfileSeek)
+	_, _, err = parseProfile(noSeek, "/music/album.flac")
+	require.NoError(t, err)
+}